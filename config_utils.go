@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// name of the project configuration file
+const projectConfigFileName = "pvm.toml"
+
+// default name of the virtual environment directory created by pvm
+const defaultVenvDir = ".venv"
+
+// default manifest files when the project has no pyproject.toml
+const (
+	defaultManifest      = "requirements.txt"
+	defaultGroupManifest = "requirements-{group}.txt"
+)
+
+// settings of the project, read from the user configuration,
+// the [tool.pvm] table of pyproject.toml and the pvm.toml file
+// in that order, later files overriding earlier ones
+type projectConfig struct {
+	Venv           string                  `toml:"venv"`             // virtual environment directory, relative to the project root
+	Manifest       string                  `toml:"manifest"`         // requirements file of the main dependencies
+	GroupManifest  string                  `toml:"group-manifest"`   // requirements file of a group, {group} is replaced by its name
+	Pin            string                  `toml:"pin"`              // default pin policy for pvm install
+	IndexURL       string                  `toml:"index-url"`        // package index used instead of PyPI
+	ExtraIndexURLs []string                `toml:"extra-index-urls"` // package indexes searched besides the main one
+	Python         string                  `toml:"python"`           // python version for new virtual environments
+	Gitignore      []string                `toml:"gitignore"`        // lines of the .gitignore written by pvm init
+	Scripts        map[string]scriptConfig `toml:"scripts"`          // named tasks run by pvm run
+}
+
+// a named task of the project, written either as a command string
+// or as a table with the command and the tasks it depends on
+type scriptConfig struct {
+	Command string   // command line run in the virtual environment
+	Depends []string // tasks run before this one
+}
+
+// decodes a task from its string or table form
+func (s *scriptConfig) UnmarshalTOML(data any) error {
+	switch value := data.(type) {
+	case string:
+		s.Command = value
+		return nil
+	case map[string]any:
+		for key, field := range value {
+			switch key {
+			case "cmd":
+				command, ok := field.(string)
+				if !ok {
+					return fmt.Errorf("cmd must be a string")
+				}
+				s.Command = command
+			case "depends":
+				depends, ok := field.([]any)
+				if !ok {
+					return fmt.Errorf("depends must be an array of task names")
+				}
+				for _, dependency := range depends {
+					name, ok := dependency.(string)
+					if !ok {
+						return fmt.Errorf("depends must be an array of task names")
+					}
+					s.Depends = append(s.Depends, name)
+				}
+			default:
+				return fmt.Errorf("unknown task setting %s", key)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("a task must be a command string or a table with cmd and depends")
+}
+
+// the [tool.pvm] table of a pyproject.toml file
+type pyprojectToolConfig struct {
+	Tool struct {
+		Pvm projectConfig `toml:"pvm"`
+	} `toml:"tool"`
+}
+
+// a configuration already loaded for a project root
+type cachedProjectConfig struct {
+	stamp  string // modification times and sizes of the files it was read from
+	config projectConfig
+}
+
+// configurations already loaded, keyed by project root
+var projectConfigCache = make(map[string]cachedProjectConfig)
+
+// returns a string that changes whenever one of the files is
+// created, removed or modified
+func configFilesStamp(paths []string) string {
+	var stamp strings.Builder
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&stamp, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return stamp.String()
+}
+
+// returns the path of the user configuration file, following
+// the XDG base directory specification
+func getUserConfigPath() (string, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "pvm", "config.toml"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", "pvm", "config.toml"), nil
+}
+
+// returns an error naming the keys of the file that are not settings
+// only keys below prefix are checked
+func checkUndecodedKeys(meta toml.MetaData, path string, prefix string) error {
+	var unknown []string
+	for _, key := range meta.Undecoded() {
+		name := key.String()
+		if prefix != "" {
+			var found bool
+			if name, found = strings.CutPrefix(name, prefix+"."); !found {
+				continue
+			}
+		}
+		// scripts hold arbitrary names
+		if strings.HasPrefix(name, "scripts.") {
+			continue
+		}
+		unknown = append(unknown, name)
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown setting(s) in %s: %s", path, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// reads the settings of the file into the configuration,
+// keeping the settings the file does not mention
+// a missing file leaves the configuration unchanged
+func decodeConfigFile(path string, config *projectConfig) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	meta, err := toml.DecodeFile(path, config)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	return checkUndecodedKeys(meta, path, "")
+}
+
+// reads the [tool.pvm] table of pyproject.toml into the configuration
+func decodePyprojectConfig(path string, config *projectConfig) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	var pyproject pyprojectToolConfig
+	pyproject.Tool.Pvm = *config
+
+	meta, err := toml.DecodeFile(path, &pyproject)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := checkUndecodedKeys(meta, path, "tool.pvm"); err != nil {
+		return err
+	}
+
+	*config = pyproject.Tool.Pvm
+	return nil
+}
+
+// reads the configuration of the project, combining the user
+// defaults with the settings of the project
+// the configuration is read once per project root and only read
+// again when one of its files changes
+func loadProjectConfig() (projectConfig, error) {
+	root, err := getProjectRoot()
+	if err != nil {
+		return projectConfig{}, err
+	}
+
+	userConfig, err := getUserConfigPath()
+	if err != nil {
+		return projectConfig{}, err
+	}
+
+	pyprojectFile := filepath.Join(root, "pyproject.toml")
+	configFile := filepath.Join(root, projectConfigFileName)
+
+	stamp := configFilesStamp([]string{userConfig, pyprojectFile, configFile})
+	if cached, found := projectConfigCache[root]; found && cached.stamp == stamp {
+		return cached.config, nil
+	}
+
+	var config projectConfig
+
+	if err := decodeConfigFile(userConfig, &config); err != nil {
+		return projectConfig{}, err
+	}
+	if err := decodePyprojectConfig(pyprojectFile, &config); err != nil {
+		return projectConfig{}, err
+	}
+	if err := decodeConfigFile(configFile, &config); err != nil {
+		return projectConfig{}, err
+	}
+
+	if err := config.validate(); err != nil {
+		return projectConfig{}, err
+	}
+
+	projectConfigCache[root] = cachedProjectConfig{stamp: stamp, config: config}
+	return config, nil
+}
+
+// checks the settings that cannot be checked when they are used
+func (c projectConfig) validate() error {
+	if c.Pin != "" {
+		if _, err := parsePinPolicy(c.Pin); err != nil {
+			return err
+		}
+	}
+
+	if c.GroupManifest != "" && !strings.Contains(c.GroupManifest, "{group}") {
+		return fmt.Errorf("group-manifest %q must contain {group}", c.GroupManifest)
+	}
+
+	for _, path := range []string{c.Venv, c.Manifest, c.GroupManifest} {
+		if filepath.IsAbs(path) {
+			return fmt.Errorf("%s must be relative to the project root", path)
+		}
+	}
+
+	return nil
+}
+
+// returns the virtual environment directories pvm looks for,
+// relative to the project root
+func (c projectConfig) venvDirs() []string {
+	if c.Venv != "" {
+		return []string{c.Venv}
+	}
+	return []string{"venv", ".venv", "env"}
+}
+
+// returns the directory a new virtual environment is created in
+func (c projectConfig) newVenvDir() string {
+	if c.Venv != "" {
+		return c.Venv
+	}
+	return defaultVenvDir
+}
+
+// returns the requirements file of the main dependencies
+func (c projectConfig) manifest() string {
+	if c.Manifest != "" {
+		return filepath.FromSlash(c.Manifest)
+	}
+	return defaultManifest
+}
+
+// returns the requirements file of the dependency group
+func (c projectConfig) groupManifest(group string) string {
+	pattern := defaultGroupManifest
+	if c.GroupManifest != "" {
+		pattern = c.GroupManifest
+	}
+	return filepath.FromSlash(strings.ReplaceAll(pattern, "{group}", group))
+}
+
+// returns the pip options selecting the configured package indexes
+func (c projectConfig) indexOptions() []string {
+	var options []string
+	if c.IndexURL != "" {
+		options = append(options, "--index-url", c.IndexURL)
+	}
+	for _, url := range c.ExtraIndexURLs {
+		options = append(options, "--extra-index-url", url)
+	}
+	return options
+}
+
+// returns the lines of the .gitignore file written by pvm init
+func (c projectConfig) gitignore() []string {
+	if c.Gitignore != nil {
+		return c.Gitignore
+	}
+
+	lines := slices.Clone(defaultGitignore)
+	if venv := c.newVenvDir(); venv != defaultVenvDir {
+		lines[slices.Index(lines, defaultVenvDir)] = filepath.ToSlash(venv)
+	}
+	return lines
+}
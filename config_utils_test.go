@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// points the user configuration at a temporary directory
+func setupUserConfig(t *testing.T, content string) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	if content == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Join(configHome, "pvm"), 0755); err != nil {
+		t.Fatalf("failed to create user configuration directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(configHome, "pvm", "config.toml"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write user configuration: %v", err)
+	}
+}
+
+func TestLoadProjectConfigLayers(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "pin = \"compatible\"\nindex-url = \"https://mirror.example/simple\"\n\n[scripts]\nserve = \"python -m http.server\"\n")
+
+	pyproject := "[project]\nname = \"service\"\n\n[tool.pvm]\npin = \"lower-bound\"\npython = \"3.11\"\n\n[tool.pvm.scripts]\ntest = \"pytest -q\"\n\n[tool.black]\nline-length = 100\n"
+	if err := os.WriteFile("pyproject.toml", []byte(pyproject), 0644); err != nil {
+		t.Fatalf("failed to write pyproject.toml: %v", err)
+	}
+	if err := os.WriteFile("pvm.toml", []byte("venv = \"build/venv\"\n\n[scripts]\ntest = \"pytest -x\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	config, err := loadProjectConfig()
+	if err != nil {
+		t.Fatalf("loadProjectConfig failed: %v", err)
+	}
+
+	if config.Pin != "lower-bound" || config.Python != "3.11" || config.Venv != "build/venv" {
+		t.Errorf("unexpected settings: %+v", config)
+	}
+	if !reflect.DeepEqual(config.indexOptions(), []string{"--index-url", "https://mirror.example/simple"}) {
+		t.Errorf("expected the user index to be kept: %v", config.indexOptions())
+	}
+
+	expected := map[string]scriptConfig{"serve": {Command: "python -m http.server"}, "test": {Command: "pytest -x"}}
+	if !reflect.DeepEqual(config.Scripts, expected) {
+		t.Errorf("expected scripts to be merged, received %v", config.Scripts)
+	}
+
+	if config.venvDirs()[0] != "build/venv" || config.newVenvDir() != "build/venv" {
+		t.Errorf("expected the configured virtual environment directory")
+	}
+	if !strings.Contains(strings.Join(config.gitignore(), "\n"), "\nbuild/venv\n") {
+		t.Errorf("expected the configured virtual environment to be ignored")
+	}
+}
+
+func TestLoadProjectConfigRejectsUnknownSettings(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	if err := os.WriteFile("pvm.toml", []byte("pin = \"exact\"\nvenv-dir = \".env\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	_, err := loadProjectConfig()
+	if err == nil || !strings.Contains(err.Error(), "venv-dir") {
+		t.Errorf("expected the unknown setting to be reported, received %v", err)
+	}
+
+	if err := os.WriteFile("pvm.toml", []byte("pin = \"loose\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+	if _, err := loadProjectConfig(); err == nil {
+		t.Errorf("expected an invalid pin policy to fail")
+	}
+}
+
+func TestConfiguredManifests(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	config := "manifest = \"requirements/base.txt\"\ngroup-manifest = \"requirements/{group}.txt\"\n"
+	if err := os.WriteFile("pvm.toml", []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	if err := createRequirementsFile(); err != nil {
+		t.Fatalf("createRequirementsFile failed: %v", err)
+	}
+	if getManifestName() != "requirements/base.txt" {
+		t.Errorf("unexpected manifest name: %s", getManifestName())
+	}
+
+	if err := addPackagesToManifest([]string{"requests"}, dependencySection{}); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+	if err := addPackagesToManifest([]string{"pytest"}, groupSection("test")); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join("requirements", "base.txt"))
+	if err != nil || string(data) != "requests\n" {
+		t.Errorf("unexpected requirements/base.txt: %q, %v", data, err)
+	}
+
+	groups, err := listDependencyGroups()
+	if err != nil {
+		t.Fatalf("listDependencyGroups failed: %v", err)
+	}
+	if !reflect.DeepEqual(groups, []string{"test"}) {
+		t.Errorf("expected only the test group, received %q", groups)
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// a distribution installed in the virtual environment
+type installedDistribution struct {
+	Name           string
+	Version        string
+	RequiresDist   []string // Requires-Dist metadata entries
+	RequiresPython string   // Requires-Python metadata entry
+	Installer      string
+	Requested      bool       // installed directly instead of as a dependency
+	DirectURL      *directURL // set for distributions installed from a url or path
+	Path           string     // the .dist-info or .egg-info directory
+}
+
+// the PEP 610 direct_url.json of a distribution
+type directURL struct {
+	URL         string       `json:"url"`
+	ArchiveInfo *archiveInfo `json:"archive_info"`
+	DirInfo     *dirInfo     `json:"dir_info"`
+	VCSInfo     *vcsInfo     `json:"vcs_info"`
+}
+
+type archiveInfo struct {
+	Hash   string            `json:"hash"`
+	Hashes map[string]string `json:"hashes"`
+}
+
+type dirInfo struct {
+	Editable bool `json:"editable"`
+}
+
+type vcsInfo struct {
+	VCS      string `json:"vcs"`
+	CommitID string `json:"commit_id"`
+}
+
+// a file installed by a distribution, as listed in its RECORD file
+type recordedFile struct {
+	Path string // relative to the site-packages directory
+	Hash string // algorithm=urlsafe-base64 digest, empty for the RECORD file itself
+	Size int64  // -1 when unknown
+}
+
+// an entry of the entry_points.txt file of a distribution
+type entryPoint struct {
+	Group  string // such as console_scripts
+	Name   string
+	Object string // module:attribute the entry point refers to
+}
+
+// returns the site-packages directories of the virtual environment
+// lib64 is usually a link to lib, directories are returned once
+func getSitePackagesDirs() ([]string, error) {
+	venvPath, err := getVenvPath()
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{
+		filepath.Join(venvPath, "lib", "*", "site-packages"),
+		filepath.Join(venvPath, "lib64", "*", "site-packages"),
+		filepath.Join(venvPath, "Lib", "site-packages"),
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range matches {
+			resolved, err := filepath.EvalSymlinks(dir)
+			if err != nil || seen[resolved] {
+				continue
+			}
+			seen[resolved] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs, nil
+}
+
+// returns every distribution installed in the virtual environment,
+// read from the metadata in its site-packages directories
+func inspectVirtualEnvironment() ([]installedDistribution, error) {
+	dirs, err := getSitePackagesDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	return readInstalledDistributions(dirs)
+}
+
+// reads the .dist-info and .egg-info directories of the
+// site-packages directories
+// the first directory wins when a distribution is found in several,
+// like it does on sys.path; directories without metadata are skipped
+func readInstalledDistributions(dirs []string) ([]installedDistribution, error) {
+	var distributions []installedDistribution
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || (!strings.HasSuffix(name, ".dist-info") && !strings.HasSuffix(name, ".egg-info")) {
+				continue
+			}
+
+			dist, err := readDistribution(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+
+			key := normalizeName(dist.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			distributions = append(distributions, dist)
+		}
+	}
+
+	return distributions, nil
+}
+
+// reads an installed distribution from its .dist-info or .egg-info directory
+func readDistribution(path string) (installedDistribution, error) {
+	metadataFile := "METADATA"
+	if strings.HasSuffix(path, ".egg-info") {
+		metadataFile = "PKG-INFO"
+	}
+
+	file, err := os.Open(filepath.Join(path, metadataFile))
+	if err != nil {
+		return installedDistribution{}, err
+	}
+	defer file.Close()
+
+	dist, err := parseDistributionMetadata(file)
+	if err != nil {
+		return installedDistribution{}, fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	dist.Path = path
+
+	// egg-info keeps the requirements out of the metadata
+	if requires, err := os.ReadFile(filepath.Join(path, "requires.txt")); err == nil && len(dist.RequiresDist) == 0 {
+		dist.RequiresDist = parseEggRequires(string(requires))
+	}
+
+	if installer, err := os.ReadFile(filepath.Join(path, "INSTALLER")); err == nil {
+		dist.Installer = strings.TrimSpace(string(installer))
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "REQUESTED")); err == nil {
+		dist.Requested = true
+	}
+
+	if data, err := os.ReadFile(filepath.Join(path, "direct_url.json")); err == nil {
+		var url directURL
+		if err := json.Unmarshal(data, &url); err != nil {
+			return installedDistribution{}, fmt.Errorf("%s: direct_url.json: %v", filepath.Base(path), err)
+		}
+		dist.DirectURL = &url
+	}
+
+	return dist, nil
+}
+
+// parses the email header style core metadata of a distribution,
+// stopping at the description that follows the headers
+func parseDistributionMetadata(reader io.Reader) (installedDistribution, error) {
+	var dist installedDistribution
+	var key, value string
+
+	store := func() {
+		switch strings.ToLower(key) {
+		case "name":
+			dist.Name = value
+		case "version":
+			dist.Version = value
+		case "requires-dist":
+			dist.RequiresDist = append(dist.RequiresDist, value)
+		case "requires-python":
+			dist.RequiresPython = value
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+
+		// folded header lines continue the previous header
+		if line[0] == ' ' || line[0] == '\t' {
+			value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		if key != "" {
+			store()
+		}
+
+		var found bool
+		key, value, found = strings.Cut(line, ":")
+		if !found {
+			return installedDistribution{}, fmt.Errorf("invalid metadata line %q", line)
+		}
+		value = strings.TrimSpace(value)
+	}
+	if key != "" {
+		store()
+	}
+
+	if err := scanner.Err(); err != nil {
+		return installedDistribution{}, err
+	}
+	if dist.Name == "" || dist.Version == "" {
+		return installedDistribution{}, fmt.Errorf("metadata without a name or version")
+	}
+
+	return dist, nil
+}
+
+// converts the requires.txt file of an egg-info directory into
+// Requires-Dist entries
+// requirements below an [extra] or [extra:marker] section only apply
+// with the extra or marker
+func parseEggRequires(content string) []string {
+	var requires []string
+	marker := ""
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			extra, condition, _ := strings.Cut(line[1:len(line)-1], ":")
+			var clauses []string
+			if condition != "" {
+				clauses = append(clauses, "("+condition+")")
+			}
+			if extra != "" {
+				clauses = append(clauses, fmt.Sprintf("extra == %q", extra))
+			}
+			marker = strings.Join(clauses, " and ")
+			continue
+		}
+
+		if marker != "" {
+			line += "; " + marker
+		}
+		requires = append(requires, line)
+	}
+
+	return requires
+}
+
+// returns the files the distribution installed, read from its RECORD file
+func (dist installedDistribution) recordedFiles() ([]recordedFile, error) {
+	file, err := os.Open(filepath.Join(dist.Path, "RECORD"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseRecord(file)
+}
+
+// parses the path,hash,size lines of a RECORD file
+func parseRecord(reader io.Reader) ([]recordedFile, error) {
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = -1
+
+	var files []recordedFile
+	for {
+		fields, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 || fields[0] == "" {
+			continue
+		}
+
+		file := recordedFile{Path: fields[0], Size: -1}
+		if len(fields) > 1 {
+			file.Hash = fields[1]
+		}
+		if len(fields) > 2 && fields[2] != "" {
+			size, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size of %s in RECORD", fields[0])
+			}
+			file.Size = size
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// returns the entry points the distribution declares, read from
+// its entry_points.txt file, none when it has no such file
+func (dist installedDistribution) entryPoints() ([]entryPoint, error) {
+	data, err := os.ReadFile(filepath.Join(dist.Path, "entry_points.txt"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEntryPoints(string(data))
+}
+
+// returns the names of the commands the distribution installed in the
+// scripts directory of the virtual environment, read from its RECORD file
+// distributions without one, such as .egg-info installs, fall back to the
+// console and gui scripts declared in entry_points.txt
+func (dist installedDistribution) installedScripts() ([]string, error) {
+	files, err := dist.recordedFiles()
+	if os.IsNotExist(err) {
+		points, err := dist.entryPoints()
+		if err != nil {
+			return nil, err
+		}
+
+		var scripts []string
+		for _, point := range points {
+			if point.Group == "console_scripts" || point.Group == "gui_scripts" {
+				scripts = append(scripts, point.Name)
+			}
+		}
+		return scripts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// scripts are recorded relative to site-packages, such as ../../../bin/black
+	var scripts []string
+	for _, file := range files {
+		dir, name := path.Split(file.Path)
+		if strings.HasPrefix(dir, "../") && (path.Base(dir) == "bin" || path.Base(dir) == "Scripts") {
+			scripts = append(scripts, strings.TrimSuffix(name, ".exe"))
+		}
+	}
+
+	return scripts, nil
+}
+
+// returns the path of a file listed in the RECORD file of the
+// distribution, which is relative to its site-packages directory
+func (dist installedDistribution) recordedPath(file recordedFile) string {
+	recorded := filepath.FromSlash(file.Path)
+	if filepath.IsAbs(recorded) {
+		return filepath.Clean(recorded)
+	}
+	return filepath.Join(filepath.Dir(dist.Path), recorded)
+}
+
+// removes the distribution from the virtual environment without pip,
+// deleting the files listed in its RECORD file, their compiled modules
+// and the directories left empty
+// files recorded outside of the virtual environment are refused
+func removeDistribution(dist installedDistribution, venvPath string) error {
+	files, err := dist.recordedFiles()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, file := range files {
+		recorded := dist.recordedPath(file)
+		if relative, err := filepath.Rel(venvPath, recorded); err != nil || !filepath.IsLocal(relative) {
+			return fmt.Errorf("the RECORD file of %s lists %s outside of the virtual environment", dist.Name, file.Path)
+		}
+		paths = append(paths, recorded)
+
+		if module, found := strings.CutSuffix(recorded, ".py"); found {
+			compiled, err := filepath.Glob(filepath.Join(filepath.Dir(recorded), "__pycache__", filepath.Base(module)+".*.pyc"))
+			if err != nil {
+				return err
+			}
+			paths = append(paths, compiled...)
+		}
+	}
+
+	dirs := make(map[string]struct{})
+	for _, file := range paths {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+
+	if err := os.RemoveAll(dist.Path); err != nil {
+		return err
+	}
+
+	// the deepest directories go first so that their parents can be left empty too
+	sitePackages := filepath.Dir(dist.Path)
+	sorted := slices.SortedFunc(maps.Keys(dirs), func(a, b string) int {
+		return len(b) - len(a)
+	})
+	for _, dir := range sorted {
+		for dir != sitePackages && dir != venvPath && strings.HasPrefix(dir, venvPath) {
+			if os.Remove(dir) != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	return nil
+}
+
+// parses the ini style sections of an entry_points.txt file
+func parseEntryPoints(content string) ([]entryPoint, error) {
+	var points []entryPoint
+	group := ""
+
+	for number, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		name, object, found := strings.Cut(line, "=")
+		if !found || group == "" {
+			return nil, fmt.Errorf("entry_points.txt line %d: expected name = module:attribute", number+1)
+		}
+		points = append(points, entryPoint{Group: group, Name: strings.TrimSpace(name), Object: strings.TrimSpace(object)})
+	}
+
+	return points, nil
+}
+
+// returns true if the passed python package is installed
+// false otherwise
+func isPythonPackageInstalled(pkg string) (bool, error) {
+	versions, err := getInstalledPackageVersions([]string{pkg})
+	if err != nil {
+		return false, err
+	}
+
+	_, found := versions[normalizeName(pkg)]
+	return found, nil
+}
+
+// returns the installed versions of the passed packages
+// keyed by their normalized name, packages that are
+// not installed are missing from the result
+func getInstalledPackageVersions(packages []string) (map[string]string, error) {
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, pkg := range packages {
+		wanted[normalizeName(pkg)] = true
+	}
+
+	versions := make(map[string]string)
+	for _, dist := range distributions {
+		if key := normalizeName(dist.Name); wanted[key] {
+			versions[key] = dist.Version
+		}
+	}
+
+	return versions, nil
+}
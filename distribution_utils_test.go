@@ -0,0 +1,273 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writes the files of a distribution metadata directory
+func writeDistribution(t *testing.T, dir string, name string, files map[string]string) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", name, err)
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s/%s: %v", name, file, err)
+		}
+	}
+}
+
+func TestParseDistributionMetadata(t *testing.T) {
+	metadata := "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\nSummary: Python HTTP for Humans.\n" +
+		"License: Apache 2.0\n        continued license text\nRequires-Python: >=3.7\n" +
+		"Requires-Dist: charset-normalizer<4,>=2\nRequires-Dist: idna<4,>=2.5\n" +
+		"Requires-Dist: PySocks!=1.5.7,>=1.5.6; extra == \"socks\"\n\n" +
+		"Requires-Dist: not-a-header\n# Requests\n"
+
+	dist, err := parseDistributionMetadata(strings.NewReader(metadata))
+	if err != nil {
+		t.Fatalf("parseDistributionMetadata failed: %v", err)
+	}
+
+	expected := installedDistribution{
+		Name:           "requests",
+		Version:        "2.31.0",
+		RequiresPython: ">=3.7",
+		RequiresDist:   []string{"charset-normalizer<4,>=2", "idna<4,>=2.5", "PySocks!=1.5.7,>=1.5.6; extra == \"socks\""},
+	}
+	if !reflect.DeepEqual(dist, expected) {
+		t.Errorf("expected %+v, received %+v", expected, dist)
+	}
+
+	if _, err := parseDistributionMetadata(strings.NewReader("Metadata-Version: 2.1\nName: broken\n")); err == nil {
+		t.Errorf("expected metadata without a version to fail")
+	}
+}
+
+func TestReadInstalledDistributions(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+
+	writeDistribution(t, first, "requests-2.31.0.dist-info", map[string]string{
+		"METADATA":  "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\nRequires-Dist: idna<4,>=2.5\n",
+		"INSTALLER": "pip\n",
+		"REQUESTED": "",
+	})
+	writeDistribution(t, first, "tool-1.0.dist-info", map[string]string{
+		"METADATA":        "Metadata-Version: 2.1\nName: tool\nVersion: 1.0\n",
+		"direct_url.json": `{"url": "file:///tmp/tool", "dir_info": {"editable": true}}`,
+	})
+	writeDistribution(t, first, "legacy.egg-info", map[string]string{
+		"PKG-INFO":     "Metadata-Version: 1.1\nName: legacy\nVersion: 0.3\n",
+		"requires.txt": "six\n\n[tests]\npytest\n\n[:python_version < \"3.8\"]\nimportlib-metadata\n",
+	})
+	writeDistribution(t, first, "incomplete-1.0.dist-info", map[string]string{"RECORD": ""})
+	writeDistribution(t, second, "Requests-2.0.0.dist-info", map[string]string{
+		"METADATA": "Metadata-Version: 2.1\nName: Requests\nVersion: 2.0.0\n",
+	})
+	writeDistribution(t, second, "idna-3.6.dist-info", map[string]string{
+		"METADATA": "Metadata-Version: 2.1\nName: idna\nVersion: 3.6\n",
+	})
+
+	distributions, err := readInstalledDistributions([]string{first, second})
+	if err != nil {
+		t.Fatalf("readInstalledDistributions failed: %v", err)
+	}
+
+	byName := make(map[string]installedDistribution)
+	for _, dist := range distributions {
+		byName[dist.Name] = dist
+	}
+	if len(distributions) != 4 || len(byName) != 4 {
+		t.Fatalf("expected requests, tool, legacy and idna, received %+v", distributions)
+	}
+
+	requests := byName["requests"]
+	if requests.Version != "2.31.0" || !requests.Requested || requests.Installer != "pip" ||
+		len(requests.RequiresDist) != 1 || requests.DirectURL != nil {
+		t.Errorf("unexpected distribution: %+v", requests)
+	}
+
+	tool := byName["tool"]
+	if tool.Requested || tool.DirectURL == nil || tool.DirectURL.URL != "file:///tmp/tool" || !tool.DirectURL.DirInfo.Editable {
+		t.Errorf("expected direct url to be parsed: %+v", tool)
+	}
+
+	expectedRequires := []string{"six", "pytest; extra == \"tests\"", "importlib-metadata; (python_version < \"3.8\")"}
+	if legacy := byName["legacy"]; legacy.Version != "0.3" || !reflect.DeepEqual(legacy.RequiresDist, expectedRequires) {
+		t.Errorf("unexpected egg-info distribution: %+v", legacy)
+	}
+}
+
+func TestDistributionRecordAndEntryPoints(t *testing.T) {
+	dir := t.TempDir()
+	writeDistribution(t, dir, "black-24.1.0.dist-info", map[string]string{
+		"METADATA": "Metadata-Version: 2.1\nName: black\nVersion: 24.1.0\n",
+		"RECORD": "black/__init__.py,sha256=abc,1024\n" +
+			"\"black/file,with comma.py\",sha256=def,12\n" +
+			"black-24.1.0.dist-info/RECORD,,\n",
+		"entry_points.txt": "[console_scripts]\nblack = black:patched_main\nblackd = blackd:patched_main [d]\n\n" +
+			"[pygments.lexers]\n; comment\nblack = black.lexer:Lexer\n",
+	})
+
+	dist, err := readDistribution(filepath.Join(dir, "black-24.1.0.dist-info"))
+	if err != nil {
+		t.Fatalf("readDistribution failed: %v", err)
+	}
+
+	files, err := dist.recordedFiles()
+	if err != nil {
+		t.Fatalf("recordedFiles failed: %v", err)
+	}
+	expectedFiles := []recordedFile{
+		{Path: "black/__init__.py", Hash: "sha256=abc", Size: 1024},
+		{Path: "black/file,with comma.py", Hash: "sha256=def", Size: 12},
+		{Path: "black-24.1.0.dist-info/RECORD", Size: -1},
+	}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("expected %+v, received %+v", expectedFiles, files)
+	}
+
+	points, err := dist.entryPoints()
+	if err != nil {
+		t.Fatalf("entryPoints failed: %v", err)
+	}
+	expectedPoints := []entryPoint{
+		{Group: "console_scripts", Name: "black", Object: "black:patched_main"},
+		{Group: "console_scripts", Name: "blackd", Object: "blackd:patched_main [d]"},
+		{Group: "pygments.lexers", Name: "black", Object: "black.lexer:Lexer"},
+	}
+	if !reflect.DeepEqual(points, expectedPoints) {
+		t.Errorf("expected %+v, received %+v", expectedPoints, points)
+	}
+
+	if _, err := parseEntryPoints("black = black:main\n"); err == nil {
+		t.Errorf("expected an entry point outside of a section to fail")
+	}
+}
+
+func TestInstalledPackageVersionsFromSitePackages(t *testing.T) {
+	setupTempDirectory(t)
+
+	sitePackages := filepath.Join(".venv", "lib", "python3.12", "site-packages")
+	if err := os.MkdirAll(filepath.Join(".venv", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".venv", "bin", "python"), nil, 0755); err != nil {
+		t.Fatalf("failed to create venv python: %v", err)
+	}
+	writeDistribution(t, sitePackages, "Flask_Login-0.6.3.dist-info", map[string]string{
+		"METADATA": "Metadata-Version: 2.1\nName: Flask-Login\nVersion: 0.6.3\n",
+	})
+
+	versions, err := getInstalledPackageVersions([]string{"flask_login", "requests"})
+	if err != nil {
+		t.Fatalf("getInstalledPackageVersions failed: %v", err)
+	}
+	if !reflect.DeepEqual(versions, map[string]string{"flask-login": "0.6.3"}) {
+		t.Errorf("unexpected versions: %v", versions)
+	}
+
+	if installed, err := isPythonPackageInstalled("Flask.Login"); err != nil || !installed {
+		t.Errorf("expected Flask.Login to be installed, received %v, %v", installed, err)
+	}
+	if installed, err := isPythonPackageInstalled("requests"); err != nil || installed {
+		t.Errorf("expected requests not to be installed, received %v, %v", installed, err)
+	}
+}
+
+func TestRemoveDistribution(t *testing.T) {
+	setupTempDirectory(t)
+
+	venvPath, err := filepath.Abs(".venv")
+	if err != nil {
+		t.Fatalf("failed to resolve the venv path: %v", err)
+	}
+	sitePackages := filepath.Join(venvPath, "lib", "python3.12", "site-packages")
+
+	for _, file := range []string{
+		"bin/python",
+		"bin/black",
+		"lib/python3.12/site-packages/black/__init__.py",
+		"lib/python3.12/site-packages/black/__pycache__/__init__.cpython-312.pyc",
+		"lib/python3.12/site-packages/blib2to3/pgen2/grammar.txt",
+		"lib/python3.12/site-packages/idna/__init__.py",
+	} {
+		path := filepath.Join(venvPath, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", file, err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", file, err)
+		}
+	}
+
+	writeDistribution(t, sitePackages, "black-24.1.0.dist-info", map[string]string{
+		"METADATA":  "Metadata-Version: 2.1\nName: black\nVersion: 24.1.0\n",
+		"INSTALLER": "pip\n",
+		"RECORD": "../../../bin/black,sha256=abc,10\n" +
+			"black/__init__.py,sha256=def,0\n" +
+			"blib2to3/pgen2/grammar.txt,sha256=ghi,0\n" +
+			"black-24.1.0.dist-info/METADATA,sha256=jkl,50\n" +
+			"black-24.1.0.dist-info/RECORD,,\n",
+	})
+
+	dist, err := readDistribution(filepath.Join(sitePackages, "black-24.1.0.dist-info"))
+	if err != nil {
+		t.Fatalf("readDistribution failed: %v", err)
+	}
+
+	scripts, err := dist.installedScripts()
+	if err != nil || !reflect.DeepEqual(scripts, []string{"black"}) {
+		t.Errorf("expected the black script, received %q, %v", scripts, err)
+	}
+
+	if err := removeDistribution(dist, venvPath); err != nil {
+		t.Fatalf("removeDistribution failed: %v", err)
+	}
+
+	for _, removed := range []string{"bin/black", "lib/python3.12/site-packages/black", "lib/python3.12/site-packages/blib2to3", "lib/python3.12/site-packages/black-24.1.0.dist-info"} {
+		if _, err := os.Stat(filepath.Join(venvPath, filepath.FromSlash(removed))); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", removed)
+		}
+	}
+	for _, kept := range []string{"bin/python", "lib/python3.12/site-packages/idna/__init__.py"} {
+		if _, err := os.Stat(filepath.Join(venvPath, filepath.FromSlash(kept))); err != nil {
+			t.Errorf("expected %s to be kept: %v", kept, err)
+		}
+	}
+
+	writeDistribution(t, sitePackages, "evil-1.0.dist-info", map[string]string{
+		"METADATA": "Metadata-Version: 2.1\nName: evil\nVersion: 1.0\n",
+		"RECORD":   "../../../../outside.txt,,\n",
+	})
+	evil, err := readDistribution(filepath.Join(sitePackages, "evil-1.0.dist-info"))
+	if err != nil {
+		t.Fatalf("readDistribution failed: %v", err)
+	}
+	if err := removeDistribution(evil, venvPath); err == nil {
+		t.Errorf("expected a file outside of the virtual environment to be refused")
+	}
+}
+
+func TestInstalledScriptsFromEntryPoints(t *testing.T) {
+	dir := t.TempDir()
+	writeDistribution(t, dir, "legacy-0.3.egg-info", map[string]string{
+		"PKG-INFO":         "Metadata-Version: 1.1\nName: legacy\nVersion: 0.3\n",
+		"entry_points.txt": "[console_scripts]\nlegacy = legacy:main\n\n[gui_scripts]\nlegacy-gui = legacy.gui:main\n\n[legacy.plugins]\nother = legacy.other\n",
+	})
+
+	dist, err := readDistribution(filepath.Join(dir, "legacy-0.3.egg-info"))
+	if err != nil {
+		t.Fatalf("readDistribution failed: %v", err)
+	}
+
+	scripts, err := dist.installedScripts()
+	if err != nil || !reflect.DeepEqual(scripts, []string{"legacy", "legacy-gui"}) {
+		t.Errorf("expected the scripts of entry_points.txt, received %q, %v", scripts, err)
+	}
+}
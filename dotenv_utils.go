@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// files passed with --env-file, relative to the working directory
+var envFileFlag []string
+
+// profile passed with --profile, loads .env.<profile> from the project root
+var envProfileFlag string
+
+// a variable assigned by a dotenv file
+type dotenvVariable struct {
+	Name  string
+	Value string
+}
+
+var (
+	dotenvKeyRegex      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	dotenvVariableRegex = regexp.MustCompile(`^\$(\{([A-Za-z_][A-Za-z0-9_]*)(:?-([^}]*))?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+)
+
+// replaces the $NAME, ${NAME} and ${NAME:-default} references of the value
+// ${NAME:-default} uses the default when NAME is unset or empty,
+// ${NAME-default} only when it is unset
+func interpolateDotenv(value string, lookup func(string) (string, bool)) string {
+	var result strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' {
+			result.WriteByte(value[i])
+			continue
+		}
+
+		match := dotenvVariableRegex.FindStringSubmatch(value[i:])
+		if match == nil {
+			result.WriteByte('$')
+			continue
+		}
+
+		name := match[2] + match[5]
+		resolved, found := lookup(name)
+		if match[3] != "" && (!found || (resolved == "" && strings.HasPrefix(match[3], ":"))) {
+			resolved = interpolateDotenv(match[4], lookup)
+		}
+
+		result.WriteString(resolved)
+		i += len(match[0]) - 1
+	}
+
+	return result.String()
+}
+
+// decodes the escapes of a double quoted dotenv value, keeping
+// escaped dollar signs away from the interpolation
+func unescapeDotenv(value string, lookup func(string) (string, bool)) string {
+	var result strings.Builder
+	var pending strings.Builder
+
+	flush := func() {
+		result.WriteString(interpolateDotenv(pending.String(), lookup))
+		pending.Reset()
+	}
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			pending.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		switch value[i] {
+		case 'n':
+			pending.WriteByte('\n')
+		case 'r':
+			pending.WriteByte('\r')
+		case 't':
+			pending.WriteByte('\t')
+		case '$':
+			flush()
+			result.WriteByte('$')
+		default:
+			pending.WriteByte(value[i])
+		}
+	}
+	flush()
+
+	return result.String()
+}
+
+// parses the contents of a dotenv file
+// values can be unquoted, single quoted (taken literally) or double
+// quoted (with escapes and spanning several lines); unquoted and double
+// quoted values interpolate variables found through lookup or assigned
+// earlier, lookup winning like the shell wins over the files
+// every variable of the file is recorded in assigned
+func parseDotenv(content string, lookup func(string) (string, bool), assigned map[string]string) ([]dotenvVariable, error) {
+	var variables []dotenvVariable
+
+	resolve := func(name string) (string, bool) {
+		if value, found := lookup(name); found {
+			return value, true
+		}
+		value, found := assigned[name]
+		return value, found
+	}
+
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lineNumber := 0
+
+	for len(content) > 0 {
+		line, rest, _ := strings.Cut(content, "\n")
+		content = rest
+		lineNumber++
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || !dotenvKeyRegex.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", lineNumber)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		switch {
+		case strings.HasPrefix(value, "'") || strings.HasPrefix(value, `"`):
+			quote := value[0]
+			body := value[1:]
+
+			// a quoted value continues on the next lines until its closing quote
+			end := closingQuote(body, quote)
+			for end < 0 && len(content) > 0 {
+				next, rest, _ := strings.Cut(content, "\n")
+				content = rest
+				lineNumber++
+				body += "\n" + next
+				end = closingQuote(body, quote)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value of %s", lineNumber, name)
+			}
+
+			trailing := strings.TrimSpace(body[end+1:])
+			if trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return nil, fmt.Errorf("line %d: unexpected text after the value of %s", lineNumber, name)
+			}
+
+			value = body[:end]
+			if quote == '"' {
+				value = unescapeDotenv(value, resolve)
+			}
+		default:
+			// an inline comment starts with whitespace followed by #
+			for i := 1; i < len(value); i++ {
+				if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+					value = value[:i]
+					break
+				}
+			}
+			value = interpolateDotenv(strings.TrimSpace(value), resolve)
+		}
+
+		assigned[name] = value
+		variables = append(variables, dotenvVariable{Name: name, Value: value})
+	}
+
+	return variables, nil
+}
+
+// returns the index of the quote closing the value, skipping
+// escaped quotes inside double quoted values
+func closingQuote(body string, quote byte) int {
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && quote == '"' {
+			i++
+			continue
+		}
+		if body[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// returns the dotenv files loaded for commands run in the virtual
+// environment: .env of the project root, the .env.<profile> file of
+// the --profile flag and the files of the --env-file flag, in that order
+func getDotenvFiles() ([]string, error) {
+	root, err := getProjectRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	if _, err := os.Stat(filepath.Join(root, ".env")); err == nil {
+		files = append(files, filepath.Join(root, ".env"))
+	}
+
+	if envProfileFlag != "" {
+		profileFile := filepath.Join(root, ".env."+envProfileFlag)
+		if _, err := os.Stat(profileFile); err != nil {
+			return nil, fmt.Errorf("profile %s needs a .env.%s file in the project root", envProfileFlag, envProfileFlag)
+		}
+		files = append(files, profileFile)
+	}
+
+	for _, file := range envFileFlag {
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("env file %s not found", file)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// returns the variables of the dotenv files, later files overriding
+// earlier ones
+// variables already set in the environment of pvm are left out,
+// so the shell always wins over the files
+func loadDotenvVariables() ([]dotenvVariable, error) {
+	files, err := getDotenvFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var variables []dotenvVariable
+	assigned := make(map[string]string)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := parseDotenv(string(data), os.LookupEnv, assigned)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(file), err)
+		}
+
+		for _, variable := range parsed {
+			if _, found := os.LookupEnv(variable.Name); found {
+				continue
+			}
+			variables = append(variables, variable)
+		}
+	}
+
+	return variables, nil
+}
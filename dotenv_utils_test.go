@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	content := `# database settings
+export DB_HOST=localhost
+DB_PORT = 5432   # inline comment
+DB_URL=postgres://${DB_HOST}:$DB_PORT/app
+LITERAL='no $DB_HOST here # or comment'
+QUOTED="line one\nline two \"quoted\" \$DB_HOST"
+MULTILINE="first
+second"
+FALLBACK=${MISSING:-default value}
+EMPTY=
+HASH=abc#def
+FROM_SHELL=$SHELL_VALUE
+`
+	lookup := func(name string) (string, bool) {
+		if name == "SHELL_VALUE" {
+			return "from the shell", true
+		}
+		return "", false
+	}
+
+	variables, err := parseDotenv(content, lookup, make(map[string]string))
+	if err != nil {
+		t.Fatalf("parseDotenv failed: %v", err)
+	}
+
+	expected := []dotenvVariable{
+		{"DB_HOST", "localhost"},
+		{"DB_PORT", "5432"},
+		{"DB_URL", "postgres://localhost:5432/app"},
+		{"LITERAL", "no $DB_HOST here # or comment"},
+		{"QUOTED", "line one\nline two \"quoted\" $DB_HOST"},
+		{"MULTILINE", "first\nsecond"},
+		{"FALLBACK", "default value"},
+		{"EMPTY", ""},
+		{"HASH", "abc#def"},
+		{"FROM_SHELL", "from the shell"},
+	}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Errorf("expected %q, received %q", expected, variables)
+	}
+}
+
+func TestInterpolateDotenvDefaults(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		switch name {
+		case "SET_EMPTY":
+			return "", true
+		case "HOST":
+			return "db", true
+		}
+		return "", false
+	}
+
+	cases := map[string]string{
+		"${SET_EMPTY:-fallback}": "fallback",
+		"${SET_EMPTY-fallback}":  "",
+		"${UNSET-fallback}":      "fallback",
+		"${UNSET:-$HOST:5432}":   "db:5432",
+		"price: $5":              "price: $5",
+		"${UNSET}/path":          "/path",
+	}
+
+	for value, expected := range cases {
+		if result := interpolateDotenv(value, lookup); result != expected {
+			t.Errorf("interpolateDotenv(%q): expected %q, received %q", value, expected, result)
+		}
+	}
+}
+
+func TestParseInvalidDotenv(t *testing.T) {
+	invalid := []string{
+		"NO_EQUALS\n",
+		"1ST=value\n",
+		"OPEN=\"never closed\n",
+		"TRAILING='value' extra\n",
+	}
+
+	for _, content := range invalid {
+		if _, err := parseDotenv(content, os.LookupEnv, make(map[string]string)); err == nil {
+			t.Errorf("expected %q to fail", content)
+		}
+	}
+}
+
+func TestVenvEnvironmentLoadsDotenvFiles(t *testing.T) {
+	setupTempDirectory(t)
+	t.Setenv("PVM_TEST_SHELL", "shell")
+	t.Setenv("PYTHONHOME", "/opt/python")
+
+	if err := os.MkdirAll(filepath.Join(".venv", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".venv", "bin", "python"), nil, 0755); err != nil {
+		t.Fatalf("failed to create venv python: %v", err)
+	}
+
+	files := map[string]string{
+		".env":         "MODE=development\nNAME=app\nPVM_TEST_SHELL=file\nFROM_SHELL=${PVM_TEST_SHELL}\n",
+		".env.staging": "MODE=staging\nURL=https://$NAME.example.com\nSTAGE=$MODE\n",
+		"extra.env":    "EXTRA=1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	envProfileFlag = "staging"
+	envFileFlag = []string{"extra.env"}
+	t.Cleanup(func() {
+		envProfileFlag = ""
+		envFileFlag = nil
+	})
+
+	env, err := venvEnvironment()
+	if err != nil {
+		t.Fatalf("venvEnvironment failed: %v", err)
+	}
+
+	root, _ := getProjectRoot()
+	lookup := func(name string) string {
+		value := ""
+		for _, variable := range env {
+			if found, ok := strings.CutPrefix(variable, name+"="); ok {
+				value = found
+			}
+		}
+		return value
+	}
+
+	expected := map[string]string{
+		"MODE":           "staging",
+		"URL":            "https://app.example.com",
+		"STAGE":          "staging",
+		"FROM_SHELL":     "shell",
+		"EXTRA":          "1",
+		"PVM_TEST_SHELL": "shell",
+		"VIRTUAL_ENV":    filepath.Join(root, ".venv"),
+		"PYTHONHOME":     "",
+	}
+	for name, value := range expected {
+		if received := lookup(name); received != value {
+			t.Errorf("expected %s=%q, received %q", name, value, received)
+		}
+	}
+
+	if slices.Contains(env, "PVM_TEST_SHELL=file") {
+		t.Errorf("expected the shell to win over the .env file")
+	}
+}
+
+func TestMissingDotenvProfile(t *testing.T) {
+	setupTempDirectory(t)
+
+	envProfileFlag = "production"
+	t.Cleanup(func() { envProfileFlag = "" })
+
+	if _, err := loadDotenvVariables(); err == nil {
+		t.Errorf("expected a missing profile file to fail")
+	}
+}
@@ -4,21 +4,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 // returns the path to the file if found
 // else returns empty string
 func getFilePath(filename string) (string, error) {
-	cwd, err := os.Getwd()
+	root, err := getProjectRoot()
 
 	if err != nil {
 		return "", err
 	}
 
-	path := filepath.Join(cwd, filename)
+	path := filepath.Join(root, filename)
 
-	if _, err := os.Stat(path) ; err == nil {
+	if _, err := os.Stat(path); err == nil {
 		return path, nil
 	} else if os.IsNotExist(err) {
 		return "", nil
@@ -27,17 +28,27 @@ func getFilePath(filename string) (string, error) {
 	}
 }
 
-// creates a requirements.txt file
+// creates the requirements.txt file, or the manifest
+// file named in the project configuration
 func createRequirementsFile() error {
-	targetFile := "requirements.txt"
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	targetFile := config.manifest()
 
-	cwd, err := os.Getwd()
+	root, err := getProjectRoot()
 
 	if err != nil {
 		return err
 	}
 
-	file, err := os.Create(filepath.Join(cwd, targetFile))
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(root, targetFile)), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(root, targetFile))
 
 	if err != nil {
 		return err
@@ -48,73 +59,71 @@ func createRequirementsFile() error {
 	return nil
 }
 
+// lines of the .gitignore file written by pvm init
+var defaultGitignore = []string{
+	"# Virtual Environment folder",
+	".venv",
+	"",
+	"# Environment files",
+	".env",
+	".env.*",
+	"",
+	"# Build output",
+	"dist/",
+	"build/",
+	"tmp/",
+	"temp/",
+	".cache/",
+	"out/",
+	"coverage/",
+	"",
+	"# IDEs & Editors",
+	".vscode/",
+	".idea/",
+	"*.sublime-workspace",
+	"*.sublime-project",
+	"",
+	"# OS-specific files",
+	"*.swp",
+	"*.swo",
+	"*.bak",
+	"*.tmp",
+	"",
+	"# Compiled files",
+	"*.class",
+	"*.pyc",
+	"*.pyo",
+	"*.exe",
+	"*.dll",
+	"*.o",
+	"*.obj",
+	"*.so",
+	"*.a",
+	"*.out",
+	"",
+	"# System files",
+	".DS_Store",
+	"Thumbs.db",
+}
+
 // creates a .gitignore file
 func createGitignoreFile() error {
 	targetFile := ".gitignore"
 
-	cwd, err := os.Getwd()
+	root, err := getProjectRoot()
 
 	if err != nil {
 		return err
 	}
 
-	gitignoreFile := filepath.Join(cwd, targetFile)
-	file, err := os.Create(gitignoreFile)
-
+	// an invalid configuration must not leave an empty file behind
+	config, err := loadProjectConfig()
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
-
-	thingsToIgnore := [...]string{
-		"# Virtual Environment folder",
-		".venv",
-		"",
-		"# Environment files", 
-		".env", 
-		".env.*",
-		"",
-		"# Build output",
-		"dist/",
-		"build/",
-		"tmp/",
-		"temp/",
-		".cache/",
-		"out/",
-		"coverage/",
-		"",
-		"# IDEs & Editors",
-		".vscode/",
-		".idea/",
-		"*.sublime-workspace",
-		"*.sublime-project",
-		"",
-		"# OS-specific files",
-		"*.swp",
-		"*.swo",
-		"*.bak",
-		"*.tmp",
-		"",
-		"# Compiled files",
-		"*.class",
-		"*.pyc",
-		"*.pyo",
-		"*.exe",
-		"*.dll",
-		"*.o",
-		"*.obj",
-		"*.so",
-		"*.a",
-		"*.out",
-		"",
-		"# System files",
-		".DS_Store",
-		"Thumbs.db",
-	}
-
-	content := strings.Join(thingsToIgnore[:], "\n")
-
+	gitignoreFile := filepath.Join(root, targetFile)
+	content := strings.Join(config.gitignore(), "\n")
 
 	err = os.WriteFile(gitignoreFile, []byte(content), 0644)
 	if err != nil {
@@ -124,116 +133,126 @@ func createGitignoreFile() error {
 	return nil
 }
 
-// writes the list of passed packages to the requirements.txt file
-// overwrites the text inside the file
-func writePackagesToRequirementsFile(packages []string) error {
-	requirementsFile, err := getFilePath("requirements.txt")
+// returns the path of the requirements.txt file
+// or an error if the file does not exist
+func getRequirementsFilePath() (string, error) {
+	config, err := loadProjectConfig()
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	requirementsFile, err := getFilePath(config.manifest())
+	if err != nil {
+		return "", err
 	}
 	if requirementsFile == "" {
-		return fmt.Errorf("requirements.txt not found")
+		return "", fmt.Errorf("%s not found", filepath.ToSlash(config.manifest()))
 	}
 
-	content := strings.Join(packages, "\n")
-	err = os.WriteFile(requirementsFile, []byte(content), 0644)
+	return requirementsFile, nil
+}
+
+// returns the requirements declared in the selected section
+// of the project manifest
+func getDeclaredRequirements(section dependencySection) ([]requirement, error) {
+	m, err := openManifest(section)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return m.requirements()
 }
 
-// returns a list of packages in the requirements.txt file
+// returns a list of packages in the project manifest
 // as a list of strings
 func getPackagesFromRequirements() ([]string, error) {
-	requirementsFile, err := getFilePath("requirements.txt")
+	requirements, err := getDeclaredRequirements(dependencySection{})
 	if err != nil {
 		return nil, err
 	}
-	if requirementsFile == "" {
-		return nil, fmt.Errorf("requirements.txt not found")
-	}
 
-	data, err := os.ReadFile(requirementsFile)
-	if err != nil {
-			return nil, err
-	}
-
-	lines := strings.Split(string(data), "\n")
 	var packages []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
-			packages = append(packages, trimmed)
-		}
+	for _, req := range requirements {
+		packages = append(packages, req.String())
 	}
 	return packages, nil
 }
 
-// removes the given list of packages from the requirements.txt file
-func removePackagesFromRequirementsFile(packages []string) error {
-	currentPackages, err := getPackagesFromRequirements()
+// removes the given list of packages from the project manifest
+// packages are matched by their normalized project name, so
+// "requests" also removes "Requests[socks]>=2"
+// comments, options and formatting of other lines are kept
+func removePackagesFromManifest(packages []string, section dependencySection) error {
+	toRemove, err := parseRequirementArgs(packages)
 	if err != nil {
 		return err
 	}
 
-	// Create a set of packages to remove (case-insensitive)
-    toRemove := make(map[string]struct{})
-    for _, pkg := range packages {
-			toRemove[strings.ToLower(pkg)] = struct{}{}
-    }
+	m, err := openManifest(section)
+	if err != nil {
+		return err
+	}
 
-	// Filter out packages to remove
-	var updatedPackages []string
-	for _, pkg := range currentPackages {
-		if _, found := toRemove[strings.ToLower(pkg)]; !found {
-			updatedPackages = append(updatedPackages, pkg)
+	changed := false
+	for _, req := range toRemove {
+		removed, err := m.remove(req.key())
+		if err != nil {
+			return err
 		}
+		changed = changed || removed
 	}
 
-	err = writePackagesToRequirementsFile(updatedPackages)
-	if err != nil {
-		return err
+	if !changed {
+		return nil
 	}
 
-	return nil
+	return m.save()
 }
 
-// adds the passed packages to the requirements.txt file
-// duplicates do not get added again
-func addPackagesToRequirementsFile(packages []string) error {
-	// Get already written packages
-	currentPackages, err := getPackagesFromRequirements()
-	if err != nil && !os.IsNotExist(err) {
+// adds the passed packages to the project manifest
+// a package that is already listed is only rewritten when the
+// new requirement carries a version, extras, url or marker
+// comments, options and formatting of other lines are kept
+func addPackagesToManifest(packages []string, section dependencySection) error {
+	newRequirements, err := parseRequirementArgs(packages)
+	if err != nil {
 		return err
 	}
 
-	// Create a set for fast lookup
-	existing := make(map[string]struct{})
-	for _, pkg := range currentPackages {
-		existing[strings.ToLower(pkg)] = struct{}{}
+	m, err := openManifest(section)
+	if err != nil {
+		return err
 	}
 
-	// Filter out duplicates
-	var newPackages []string
-	for _, pkg := range packages {
-		if _, found := existing[strings.ToLower(pkg)]; !found {
-			newPackages = append(newPackages, pkg)
-			existing[strings.ToLower(pkg)] = struct{}{}
+	current, err := m.requirements()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, req := range newRequirements {
+		declared := slices.ContainsFunc(current, func(existing requirement) bool {
+			return existing.key() == req.key()
+		})
+		if declared && !isConstrained(req) {
+			continue
+		}
+
+		updated, err := m.set(req)
+		if err != nil {
+			return err
 		}
+		changed = changed || updated
 	}
 
-	if len(newPackages) == 0 {
+	if !changed {
 		return nil // Nothing new to write
 	}
 
-	updatedPackages := append(currentPackages, newPackages...)
+	return m.save()
+}
 
-	err = writePackagesToRequirementsFile(updatedPackages)
-	if err != nil {
-		return err
-	}
-	
-	return nil
-}
\ No newline at end of file
+// returns true if the requirement restricts more than the project name
+func isConstrained(req requirement) bool {
+	return req.Specifier != "" || req.URL != "" || req.Marker != "" || len(req.Extras) > 0
+}
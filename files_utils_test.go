@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -24,16 +25,21 @@ func setupTempRequirements(t *testing.T, lines []string) string {
 	oldDir, _ := os.Getwd()
 	os.Chdir(tmpDir)
 	t.Cleanup(func() { os.Chdir(oldDir) })
-	
+
 	return reqPath
 }
 
 func TestWriteAndReadPackages(t *testing.T) {
-	setupTempRequirements(t, []string{})
+	path := setupTempRequirements(t, []string{"# pinned for the demo", "requests"})
+
+	doc, err := loadRequirementsDocument(path)
+	if err != nil {
+		t.Fatalf("loadRequirementsDocument failed: %v", err)
+	}
 
-	packages := []string{"requests", "flask"}
-	if err := writePackagesToRequirementsFile(packages); err != nil {
-		t.Fatalf("writePackagesToRequirementsFile failed: %v", err)
+	doc.set(requirement{Name: "flask"})
+	if err := doc.save(path); err != nil {
+		t.Fatalf("save failed: %v", err)
 	}
 
 	readPackages, err := getPackagesFromRequirements()
@@ -45,10 +51,9 @@ func TestWriteAndReadPackages(t *testing.T) {
 		t.Errorf("unexpected packages: %v", readPackages)
 	}
 
-	packages = append(packages, "numpy")
-
-	if err := writePackagesToRequirementsFile(packages); err != nil {
-		t.Fatalf("writePackagesToRequirementsFile failed: %v", err)
+	doc.set(requirement{Name: "numpy"})
+	if err := doc.save(path); err != nil {
+		t.Fatalf("save failed: %v", err)
 	}
 
 	readPackages, err = getPackagesFromRequirements()
@@ -59,14 +64,19 @@ func TestWriteAndReadPackages(t *testing.T) {
 	if len(readPackages) != 3 || readPackages[0] != "requests" || readPackages[1] != "flask" || readPackages[2] != "numpy" {
 		t.Errorf("unexpected packages: %v", readPackages)
 	}
+
+	content, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(content), "# pinned for the demo\n") {
+		t.Errorf("expected the comment to be kept, received %q", content)
+	}
 }
 
 func TestAddPackagesToRequirementsFile(t *testing.T) {
 	setupTempRequirements(t, []string{"requests"})
 
-	err := addPackagesToRequirementsFile([]string{"flask", "requests", "numpy"})
+	err := addPackagesToManifest([]string{"flask", "requests", "numpy"}, dependencySection{})
 	if err != nil {
-		t.Fatalf("addPackagesToRequirementsFile failed: %v", err)
+		t.Fatalf("addPackagesToManifest failed: %v", err)
 	}
 
 	packages, err := getPackagesFromRequirements()
@@ -82,9 +92,9 @@ func TestAddPackagesToRequirementsFile(t *testing.T) {
 func TestRemovePackagesFromRequirementsFile(t *testing.T) {
 	setupTempRequirements(t, []string{"requests", "flask", "pytest", "numpy"})
 
-	err := removePackagesFromRequirementsFile([]string{"flask", "numpy", "flask"})
+	err := removePackagesFromManifest([]string{"flask", "numpy", "flask"}, dependencySection{})
 	if err != nil {
-		t.Fatalf("removePackagesFromRequirementsFile failed: %v", err)
+		t.Fatalf("removePackagesFromManifest failed: %v", err)
 	}
 
 	packages, err := getPackagesFromRequirements()
@@ -196,4 +206,21 @@ func TestCreateGitignoreFile(t *testing.T) {
 	if actual != expected {
 		t.Errorf("path is incorrect: expected %s, received %s", expected, actual)
 	}
-}
\ No newline at end of file
+}
+
+func TestCreateGitignoreFileWithInvalidConfig(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	if err := os.WriteFile("pvm.toml", []byte("gitignore = ["), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	if err := createGitignoreFile(); err == nil {
+		t.Errorf("expected an invalid configuration to fail")
+	}
+
+	if _, err := os.Stat(".gitignore"); !os.IsNotExist(err) {
+		t.Errorf("expected no .gitignore to be written, received %v", err)
+	}
+}
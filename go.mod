@@ -3,6 +3,7 @@ module github.com/TomasBivainis/pvm
 go 1.23.2
 
 require (
+	github.com/BurntSushi/toml v1.5.0 // direct
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/cobra v1.9.1 // direct
 	github.com/spf13/pflag v1.0.6 // indirect
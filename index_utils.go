@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// returned when no package index lists files of a project
+var errProjectNotFound = errors.New("was not found on the package index")
+
+// package index used when the configuration does not name one
+const defaultIndexURL = "https://pypi.org/simple"
+
+// a client of the PEP 503 simple repository API of a package index,
+// requesting the PEP 691 JSON form and falling back to HTML
+type packageIndex struct {
+	URL    string // base url of the simple API, such as https://pypi.org/simple
+	client *http.Client
+}
+
+// a file of a project as listed by a package index
+type indexFile struct {
+	Filename string
+	URL      string
+	Hashes   map[string]string
+	Yanked   bool
+	// Requires-Python of the file, empty when the index does not say
+	RequiresPython string
+	// the index serves the core metadata of the file next to it, as described by PEP 658
+	Metadata bool
+}
+
+// the parts of a PEP 691 project page used by pvm
+type simpleProjectPage struct {
+	Files []struct {
+		Filename       string            `json:"filename"`
+		URL            string            `json:"url"`
+		Hashes         map[string]string `json:"hashes"`
+		RequiresPython string            `json:"requires-python"`
+		Yanked         any               `json:"yanked"`             // false or the reason as a string
+		CoreMetadata   any               `json:"core-metadata"`      // false, true or the hashes of the metadata file
+		DistInfo       any               `json:"dist-info-metadata"` // older name of core-metadata
+	} `json:"files"`
+}
+
+var (
+	anchorRegex    = regexp.MustCompile(`(?is)<a\s([^>]*)>(.*?)</a>`)
+	attributeRegex = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// returns a client of the package index at the url
+func newPackageIndex(indexURL string) *packageIndex {
+	return &packageIndex{
+		URL:    strings.TrimSuffix(indexURL, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// returns clients of the configured package indexes, the main one first
+func getPackageIndexes() ([]*packageIndex, error) {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	indexURL := config.IndexURL
+	if indexURL == "" {
+		indexURL = defaultIndexURL
+	}
+
+	indexes := []*packageIndex{newPackageIndex(indexURL)}
+	for _, extra := range config.ExtraIndexURLs {
+		indexes = append(indexes, newPackageIndex(extra))
+	}
+	return indexes, nil
+}
+
+// returns the files the index lists for the project
+// returns no files and no error when the index does not know the project
+func (index *packageIndex) projectFiles(name string) ([]indexFile, error) {
+	pageURL := index.URL + "/" + normalizeName(name) + "/"
+
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/vnd.pypi.simple.v1+json, text/html;q=0.1")
+
+	response, err := index.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", pageURL, response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if strings.HasSuffix(mediaType, "json") {
+		return parseSimpleJSONPage(body, pageURL)
+	}
+	return parseSimpleHTMLPage(string(body), pageURL)
+}
+
+// parses a PEP 691 JSON project page
+func parseSimpleJSONPage(body []byte, pageURL string) ([]indexFile, error) {
+	var page simpleProjectPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("%s: %v", pageURL, err)
+	}
+
+	files := make([]indexFile, 0, len(page.Files))
+	for _, file := range page.Files {
+		yanked := false
+		switch value := file.Yanked.(type) {
+		case bool:
+			yanked = value
+		case string:
+			yanked = true
+		}
+
+		files = append(files, indexFile{
+			Filename:       file.Filename,
+			URL:            resolveIndexURL(pageURL, file.URL),
+			Hashes:         file.Hashes,
+			Yanked:         yanked,
+			RequiresPython: file.RequiresPython,
+			Metadata:       servesMetadata(file.CoreMetadata) || servesMetadata(file.DistInfo),
+		})
+	}
+	return files, nil
+}
+
+// returns true if the core-metadata value of a PEP 691 file announces
+// the metadata file
+func servesMetadata(value any) bool {
+	switch value := value.(type) {
+	case bool:
+		return value
+	case map[string]any:
+		return true
+	}
+	return false
+}
+
+// parses the anchors of a PEP 503 HTML project page
+func parseSimpleHTMLPage(body string, pageURL string) ([]indexFile, error) {
+	var files []indexFile
+
+	for _, anchor := range anchorRegex.FindAllStringSubmatch(body, -1) {
+		attributes := make(map[string]string)
+		for _, attribute := range attributeRegex.FindAllStringSubmatch(anchor[1], -1) {
+			attributes[strings.ToLower(attribute[1])] = html.UnescapeString(attribute[2] + attribute[3])
+		}
+
+		href, found := attributes["href"]
+		if !found {
+			continue
+		}
+
+		file := indexFile{
+			Filename:       strings.TrimSpace(html.UnescapeString(anchor[2])),
+			RequiresPython: attributes["data-requires-python"],
+		}
+		_, file.Yanked = attributes["data-yanked"]
+		for _, attribute := range []string{"data-core-metadata", "data-dist-info-metadata"} {
+			if value, found := attributes[attribute]; found && value != "false" {
+				file.Metadata = true
+			}
+		}
+
+		// the hash is given in the fragment of the url
+		link, fragment, _ := strings.Cut(href, "#")
+		file.URL = resolveIndexURL(pageURL, link)
+		if algorithm, digest, found := strings.Cut(fragment, "="); found {
+			file.Hashes = map[string]string{algorithm: digest}
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// resolves a link of a project page against the url of the page
+func resolveIndexURL(pageURL string, link string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return link
+	}
+	reference, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(reference).String()
+}
+
+// returns the version of a distribution file from its name, following
+// the wheel and source distribution naming conventions
+// returns false for files of other projects or of unknown kinds
+func distributionFileVersion(name string, filename string) (string, bool) {
+	key := normalizeName(name)
+
+	if base, isWheel := strings.CutSuffix(filename, ".whl"); isWheel {
+		parts := strings.Split(base, "-")
+		if len(parts) < 5 || normalizeName(parts[0]) != key {
+			return "", false
+		}
+		return parts[1], true
+	}
+
+	base := ""
+	for _, extension := range []string{".tar.gz", ".zip", ".tar.bz2", ".tgz", ".tar.xz"} {
+		if trimmed, found := strings.CutSuffix(filename, extension); found {
+			base = trimmed
+			break
+		}
+	}
+	if base == "" {
+		return "", false
+	}
+
+	// older source distributions keep the dashes of the project name
+	for i := 0; i < len(base); i++ {
+		if base[i] == '-' && normalizeName(base[:i]) == key {
+			return base[i+1:], true
+		}
+	}
+
+	return "", false
+}
+
+// returns the versions of the project found on the indexes with at least
+// one file that is not yanked, newest first, and the files of every
+// version keyed by its normalized form
+func fetchProjectReleases(indexes []*packageIndex, name string) ([]pep440.Version, map[string][]indexFile, error) {
+	available := make(map[string]pep440.Version)
+	releases := make(map[string][]indexFile)
+	found := false
+
+	for _, index := range indexes {
+		files, err := index.projectFiles(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, file := range files {
+			found = true
+			if file.Yanked {
+				continue
+			}
+
+			text, ok := distributionFileVersion(name, file.Filename)
+			if !ok {
+				continue
+			}
+			version, err := pep440.Parse(text)
+			if err != nil {
+				continue
+			}
+			available[version.String()] = version
+			releases[version.String()] = append(releases[version.String()], file)
+		}
+	}
+
+	if !found {
+		return nil, nil, fmt.Errorf("%s %w", name, errProjectNotFound)
+	}
+
+	versions := make([]pep440.Version, 0, len(available))
+	for _, version := range available {
+		versions = append(versions, version)
+	}
+	sortVersionsDescending(versions)
+
+	return versions, releases, nil
+}
+
+// returns the versions of the project found on the indexes with at least
+// one file that is not yanked, newest first
+func fetchProjectVersions(indexes []*packageIndex, name string) ([]pep440.Version, error) {
+	versions, _, err := fetchProjectReleases(indexes, name)
+	return versions, err
+}
+
+// downloads a file listed by the index
+func (index *packageIndex) download(fileURL string) ([]byte, error) {
+	fileURL, _, _ = strings.Cut(fileURL, "#")
+
+	response, err := index.client.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", fileURL, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// sorts the versions from the newest to the oldest
+func sortVersionsDescending(versions []pep440.Version) {
+	slices.SortFunc(versions, func(a, b pep440.Version) int {
+		return b.Compare(a)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSimpleHTMLPage(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><body>
+<a href="../../packages/demo-1.0.tar.gz#sha256=abc" data-requires-python="&gt;=3.8" data-core-metadata="false">demo-1.0.tar.gz</a><br/>
+<a data-yanked="broken" href='https://files.example/demo-1.1-py3-none-any.whl' data-dist-info-metadata="sha256=def">demo-1.1-py3-none-any.whl</a>
+<a name="no-link">ignored</a>
+</body></html>`
+
+	files, err := parseSimpleHTMLPage(page, "https://index.example/simple/demo/")
+	if err != nil {
+		t.Fatalf("parseSimpleHTMLPage failed: %v", err)
+	}
+
+	expected := []indexFile{
+		{
+			Filename:       "demo-1.0.tar.gz",
+			URL:            "https://index.example/packages/demo-1.0.tar.gz",
+			Hashes:         map[string]string{"sha256": "abc"},
+			RequiresPython: ">=3.8",
+		},
+		{
+			Filename: "demo-1.1-py3-none-any.whl",
+			URL:      "https://files.example/demo-1.1-py3-none-any.whl",
+			Yanked:   true,
+			Metadata: true,
+		},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %+v, received %+v", expected, files)
+	}
+}
+
+func TestParseSimpleJSONPage(t *testing.T) {
+	page := `{"meta": {"api-version": "1.0"}, "name": "demo", "files": [
+		{"filename": "demo-1.0.tar.gz", "url": "/files/demo-1.0.tar.gz", "hashes": {"sha256": "abc"}, "yanked": false, "core-metadata": {"sha256": "def"}},
+		{"filename": "demo-1.1.tar.gz", "url": "/files/demo-1.1.tar.gz", "hashes": {}, "yanked": "broken", "requires-python": ">=3.9"}
+	]}`
+
+	files, err := parseSimpleJSONPage([]byte(page), "https://index.example/simple/demo/")
+	if err != nil {
+		t.Fatalf("parseSimpleJSONPage failed: %v", err)
+	}
+
+	if len(files) != 2 || files[0].URL != "https://index.example/files/demo-1.0.tar.gz" || files[0].Yanked ||
+		!files[1].Yanked || files[1].RequiresPython != ">=3.9" || !files[0].Metadata || files[1].Metadata {
+		t.Errorf("unexpected files %+v", files)
+	}
+
+	if _, err := parseSimpleJSONPage([]byte("<html>"), "https://index.example/simple/demo/"); err == nil {
+		t.Errorf("expected an invalid page to fail")
+	}
+}
+
+func TestDistributionFileVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		version  string
+		ok       bool
+	}{
+		{"requests", "requests-2.32.3-py3-none-any.whl", "2.32.3", true},
+		{"typing-extensions", "typing_extensions-4.12.2-py3-none-any.whl", "4.12.2", true},
+		{"zope.interface", "zope.interface-6.4.tar.gz", "6.4", true},
+		{"python-dateutil", "python-dateutil-2.9.0.post0.tar.gz", "2.9.0.post0", true},
+		{"demo", "demo-1.0.zip", "1.0", true},
+		{"demo", "demo-1.0.exe", "", false},
+		{"demo", "other-1.0.tar.gz", "", false},
+		{"demo", "other-1.0-py3-none-any.whl", "", false},
+	}
+
+	for _, test := range tests {
+		version, ok := distributionFileVersion(test.name, test.filename)
+		if version != test.version || ok != test.ok {
+			t.Errorf("distributionFileVersion(%q, %q) = %q, %v, expected %q, %v", test.name, test.filename, version, ok, test.version, test.ok)
+		}
+	}
+}
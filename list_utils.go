@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// why a distribution is installed in the virtual environment
+const (
+	packageDirect       = "direct"       // declared in the project manifest
+	packageTransitive   = "transitive"   // a dependency of a declared package
+	packageUndeclared   = "undeclared"   // nothing the project declares needs it
+	packageTooling      = "tooling"      // pip and the tools every virtual environment ships with
+	packageInapplicable = "inapplicable" // declared with a marker that does not apply to this environment
+)
+
+// a distribution shown by pvm list
+type listedPackage struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version,omitempty"` // empty for inapplicable packages that are not installed
+	Status     string   `json:"status"`
+	Groups     []string `json:"groups,omitempty"`      // dependency groups declaring a direct package
+	RequiredBy []string `json:"required_by,omitempty"` // declared packages pulling in a transitive package
+	Latest     string   `json:"latest,omitempty"`      // newer version on the package index, when checked
+	Marker     string   `json:"marker,omitempty"`      // environment marker of an inapplicable package
+}
+
+// classifies every installed distribution against the top-level
+// requirements of the dependency groups
+// declared packages whose marker does not apply to the environment are
+// listed as inapplicable, other declared packages that are not installed
+// are left out
+func buildPackageList(groups map[string][]requirement, distributions []installedDistribution, env markerEnvironment) ([]listedPackage, error) {
+	installed := make(map[string]bool)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = true
+	}
+
+	declaredIn := make(map[string][]string)
+	inapplicable := make(map[string]listedPackage)
+	var roots []requirement
+	for _, group := range slices.Sorted(maps.Keys(groups)) {
+		for _, req := range groups[group] {
+			if !req.appliesTo(env) {
+				// installed ones are classified by what else needs them
+				if installed[req.key()] {
+					continue
+				}
+				pkg, found := inapplicable[req.key()]
+				if !found {
+					pkg = listedPackage{Name: req.key(), Status: packageInapplicable, Marker: req.Marker}
+				}
+				if !slices.Contains(pkg.Groups, group) {
+					pkg.Groups = append(pkg.Groups, group)
+				}
+				inapplicable[req.key()] = pkg
+				continue
+			}
+			if !installed[req.key()] {
+				continue
+			}
+			if !slices.Contains(declaredIn[req.key()], group) {
+				declaredIn[req.key()] = append(declaredIn[req.key()], group)
+			}
+			roots = append(roots, req)
+		}
+	}
+
+	closure, err := dependencyClosure(roots, distributions, env)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]listedPackage, 0, len(distributions)+len(inapplicable))
+	for _, pkg := range inapplicable {
+		packages = append(packages, pkg)
+	}
+
+	for _, dist := range distributions {
+		key := normalizeName(dist.Name)
+		pkg := listedPackage{Name: key, Version: dist.Version}
+
+		switch {
+		case declaredIn[key] != nil:
+			pkg.Status = packageDirect
+			pkg.Groups = declaredIn[key]
+		case closure[key] != nil:
+			pkg.Status = packageTransitive
+			pkg.RequiredBy = closure[key]
+		case isPipTooling(key):
+			pkg.Status = packageTooling
+		default:
+			pkg.Status = packageUndeclared
+		}
+
+		packages = append(packages, pkg)
+	}
+
+	slices.SortFunc(packages, func(a, b listedPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return packages, nil
+}
+
+// returns the packages of the virtual environment with the
+// reason each of them is installed
+func listVirtualEnvironment() ([]listedPackage, error) {
+	groups, err := getDeclaredGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := getMarkerEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildPackageList(groups, distributions, env)
+}
+
+// returns the latest versions of the installed distributions that
+// have a newer release on the configured package indexes
+func getOutdatedVersions() (map[string]string, error) {
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(map[string]string)
+	var requirements []requirement
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist.Version
+		requirements = append(requirements, requirement{Name: dist.Name})
+	}
+
+	indexes, err := getPackageIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	packages, err := checkOutdatedRequirements(indexes, requirements, installed, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]string)
+	for _, pkg := range packages {
+		if pkg.outdated() {
+			latest[pkg.Name] = pkg.Latest
+		}
+	}
+	return latest, nil
+}
+
+// returns the packages with a newer version in latest, with that version set
+func filterOutdatedPackages(packages []listedPackage, latest map[string]string) []listedPackage {
+	var outdated []listedPackage
+	for _, pkg := range packages {
+		if version, found := latest[pkg.Name]; found {
+			pkg.Latest = version
+			outdated = append(outdated, pkg)
+		}
+	}
+	return outdated
+}
+
+// returns the packages nothing the project declares needs
+func filterUndeclaredPackages(packages []listedPackage) []listedPackage {
+	var undeclared []listedPackage
+	for _, pkg := range packages {
+		if pkg.Status == packageUndeclared {
+			undeclared = append(undeclared, pkg)
+		}
+	}
+	return undeclared
+}
+
+// writes the packages as a table, or as JSON when asJSON is set
+// the latest version column is shown when showLatest is set
+func writePackageList(w io.Writer, packages []listedPackage, asJSON bool, showLatest bool) error {
+	if asJSON {
+		if packages == nil {
+			packages = []listedPackage{}
+		}
+		return writeJSON(w, packages)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if showLatest {
+		fmt.Fprintln(table, "Package\tVersion\tLatest\tStatus\tDetails")
+	} else {
+		fmt.Fprintln(table, "Package\tVersion\tStatus\tDetails")
+	}
+
+	for _, pkg := range packages {
+		details := ""
+		switch pkg.Status {
+		case packageDirect:
+			details = strings.Join(pkg.Groups, ", ")
+		case packageTransitive:
+			details = "via " + strings.Join(pkg.RequiredBy, ", ")
+		case packageInapplicable:
+			details = pkg.Marker
+		}
+
+		version := pkg.Version
+		if version == "" {
+			version = "-"
+		}
+
+		if showLatest {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", pkg.Name, version, pkg.Latest, pkg.Status, details)
+		} else {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", pkg.Name, version, pkg.Status, details)
+		}
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPackageList(t *testing.T) {
+	groups := map[string][]requirement{
+		mainGroup: {{Name: "requests"}, {Name: "httpx"}, {Name: "pywin32", Marker: `sys_platform == "win32"`}},
+		"web":     {{Name: "flask"}, {Name: "requests"}, {Name: "black", Marker: `python_version < "3.8"`}},
+	}
+
+	packages, err := buildPackageList(groups, testDistributions(), testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("buildPackageList failed: %v", err)
+	}
+
+	expected := []listedPackage{
+		{Name: "black", Version: "24.1.0", Status: packageUndeclared},
+		{Name: "charset-normalizer", Version: "3.3.2", Status: packageTransitive, RequiredBy: []string{"requests"}},
+		{Name: "flask", Version: "3.0.0", Status: packageDirect, Groups: []string{"web"}},
+		{Name: "idna", Version: "3.6", Status: packageTransitive, RequiredBy: []string{"requests"}},
+		{Name: "itsdangerous", Version: "2.1.2", Status: packageTransitive, RequiredBy: []string{"flask"}},
+		{Name: "markupsafe", Version: "2.1.3", Status: packageTransitive, RequiredBy: []string{"flask"}},
+		{Name: "pip", Version: "23.2.1", Status: packageTooling},
+		{Name: "pysocks", Version: "1.7.1", Status: packageUndeclared},
+		{Name: "pywin32", Status: packageInapplicable, Groups: []string{mainGroup}, Marker: `sys_platform == "win32"`},
+		{Name: "requests", Version: "2.31.0", Status: packageDirect, Groups: []string{mainGroup, "web"}},
+		{Name: "werkzeug", Version: "3.0.1", Status: packageTransitive, RequiredBy: []string{"flask"}},
+	}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("expected %+v, received %+v", expected, packages)
+	}
+}
+
+func TestFilterPackageList(t *testing.T) {
+	packages := []listedPackage{
+		{Name: "black", Version: "24.1.0", Status: packageUndeclared},
+		{Name: "idna", Version: "3.6", Status: packageTransitive, RequiredBy: []string{"requests"}},
+		{Name: "requests", Version: "2.31.0", Status: packageDirect, Groups: []string{mainGroup}},
+	}
+
+	undeclared := filterUndeclaredPackages(packages)
+	if len(undeclared) != 1 || undeclared[0].Name != "black" {
+		t.Errorf("expected only black to be undeclared, received %+v", undeclared)
+	}
+
+	latest := map[string]string{"requests": "2.32.3", "black": "24.4.2"}
+
+	outdated := filterOutdatedPackages(packages, latest)
+	if len(outdated) != 2 || outdated[0].Latest != "24.4.2" || outdated[1].Name != "requests" || outdated[1].Latest != "2.32.3" {
+		t.Errorf("unexpected outdated packages %+v", outdated)
+	}
+
+	if both := filterOutdatedPackages(undeclared, latest); len(both) != 1 || both[0].Name != "black" {
+		t.Errorf("expected the filters to combine, received %+v", both)
+	}
+}
+
+func TestWritePackageList(t *testing.T) {
+	packages := []listedPackage{
+		{Name: "idna", Version: "3.6", Status: packageTransitive, RequiredBy: []string{"httpx", "requests"}},
+		{Name: "pywin32", Status: packageInapplicable, Groups: []string{mainGroup}, Marker: `sys_platform == "win32"`},
+		{Name: "requests", Version: "2.31.0", Status: packageDirect, Groups: []string{mainGroup, "dev"}},
+	}
+
+	var output bytes.Buffer
+	if err := writePackageList(&output, packages, false, false); err != nil {
+		t.Fatalf("writePackageList failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[1], "via httpx, requests") || !strings.HasSuffix(lines[3], "main, dev") {
+		t.Errorf("unexpected table:\n%s", output.String())
+	}
+	if fields := strings.Fields(lines[2]); len(fields) < 3 || fields[1] != "-" || fields[2] != packageInapplicable || !strings.HasSuffix(lines[2], `sys_platform == "win32"`) {
+		t.Errorf("unexpected table:\n%s", output.String())
+	}
+
+	output.Reset()
+	if err := writePackageList(&output, nil, true, false); err != nil {
+		t.Fatalf("writePackageList failed: %v", err)
+	}
+	if strings.TrimSpace(output.String()) != "[]" {
+		t.Errorf("expected an empty JSON array, received %s", output.String())
+	}
+}
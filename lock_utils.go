@@ -0,0 +1,624 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	lockFileName    = "pvm.lock"
+	lockFileVersion = 1
+	lockFileHeader  = "# This file is generated by \"pvm lock\". Do not edit it by hand.\n\n"
+)
+
+// the contents of the pvm.lock file
+type lockFile struct {
+	Version  int             `toml:"version"`
+	Packages []lockedPackage `toml:"package"`
+}
+
+// a distribution pinned by the lock file
+type lockedPackage struct {
+	Name       string   `toml:"name"`
+	Version    string   `toml:"version"`
+	Source     string   `toml:"source"`
+	SHA256     string   `toml:"sha256,omitempty"`
+	Direct     bool     `toml:"direct,omitempty"` // installed from a url or path instead of an index
+	RequiredBy []string `toml:"required_by"`      // top-level requirements that pull the package in
+	Groups     []string `toml:"groups,omitempty"` // dependency groups that need the package, main for the regular dependencies
+	Marker     string   `toml:"marker,omitempty"` // environments needing the package, empty when every environment does
+}
+
+// returns true if one of the groups needs the locked package
+// packages locked before groups were recorded belong to the main group
+func (pkg lockedPackage) inGroups(groups []string) bool {
+	if len(pkg.Groups) == 0 {
+		return slices.Contains(groups, mainGroup)
+	}
+	for _, group := range pkg.Groups {
+		if slices.Contains(groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if the environment needs the locked package
+func (pkg lockedPackage) appliesTo(env markerEnvironment) bool {
+	return requirement{Name: pkg.Name, Marker: pkg.Marker}.appliesTo(env)
+}
+
+// returns the lock file restricted to the packages needed by
+// the main dependencies and the selected groups
+func (lock lockFile) forGroups(groups []string) lockFile {
+	selected := append([]string{mainGroup}, groups...)
+
+	filtered := lockFile{Version: lock.Version}
+	for _, pkg := range lock.Packages {
+		if pkg.inGroups(selected) {
+			filtered.Packages = append(filtered.Packages, pkg)
+		}
+	}
+
+	return filtered
+}
+
+// returns an error when the lock file no longer matches the declared
+// top-level requirements: one is not locked, its locked version does not
+// satisfy it or a locked one is no longer declared
+// requirements that do not apply to the environment are not compared
+func (lock lockFile) checkCurrent(requirements []requirement, env markerEnvironment) error {
+	locked := make(map[string]lockedPackage)
+	roots := make(map[string]struct{})
+	for _, pkg := range lock.Packages {
+		locked[normalizeName(pkg.Name)] = pkg
+		for _, root := range pkg.RequiredBy {
+			roots[root] = struct{}{}
+		}
+	}
+
+	declared := make(map[string]struct{})
+	for _, req := range requirements {
+		declared[req.key()] = struct{}{}
+		if !req.appliesTo(env) {
+			continue
+		}
+
+		pkg, found := locked[req.key()]
+		if _, isRoot := roots[req.key()]; !found || !isRoot {
+			return fmt.Errorf("%s is out of date, %s is not locked, run \"pvm lock\"", lockFileName, req.Name)
+		}
+		if req.URL == "" && !satisfiesSpecifier(req.Specifier, pkg.Version) {
+			return fmt.Errorf("%s is out of date, the locked %s %s does not satisfy %s, run \"pvm lock\"", lockFileName, pkg.Name, pkg.Version, req.Specifier)
+		}
+	}
+
+	for _, root := range slices.Sorted(maps.Keys(roots)) {
+		if _, found := declared[root]; !found {
+			return fmt.Errorf("%s is out of date, %s is no longer declared, run \"pvm lock\"", lockFileName, root)
+		}
+	}
+
+	return nil
+}
+
+// the location and hash of the file a distribution is installed from
+type distributionArtifact struct {
+	URL    string
+	SHA256 string
+}
+
+// returns the requirements of an installed distribution that apply
+// to the environment when it is installed with the passed extras
+func distributionDependencies(dist installedDistribution, extras []string, env markerEnvironment) []requirement {
+	var dependencies []requirement
+
+	for _, entry := range dist.RequiresDist {
+		req, err := parseRequirement(entry)
+		if err != nil {
+			continue
+		}
+
+		// markers pvm cannot evaluate are left to pip
+		if applies, err := markerApplies(req.Marker, env, extras); err == nil && !applies {
+			continue
+		}
+
+		dependencies = append(dependencies, req)
+	}
+
+	return dependencies
+}
+
+// walks the installed distributions starting from the top-level requirements
+// returns the canonical names of every distribution that is reachable mapped
+// to the sorted canonical names of the top-level requirements pulling it in
+// top-level requirements that do not apply to the environment are skipped
+func dependencyClosure(roots []requirement, distributions []installedDistribution, env markerEnvironment) (map[string][]string, error) {
+	installed := make(map[string]installedDistribution)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist
+	}
+
+	closure := make(map[string][]string)
+
+	for _, root := range roots {
+		if !root.appliesTo(env) {
+			continue
+		}
+		if _, found := installed[root.key()]; !found {
+			return nil, fmt.Errorf("%s is declared but not installed, run \"pvm install\" first", root.Name)
+		}
+
+		// extras already followed for each visited distribution
+		visited := make(map[string][]string)
+		queue := []requirement{root}
+
+		for len(queue) > 0 {
+			req := queue[0]
+			queue = queue[1:]
+
+			dist, found := installed[req.key()]
+			if !found {
+				// dependencies pip decided not to install
+				continue
+			}
+
+			followed, seen := visited[req.key()]
+			var newExtras []string
+			for _, extra := range req.Extras {
+				if !slices.Contains(followed, normalizeName(extra)) {
+					newExtras = append(newExtras, normalizeName(extra))
+				}
+			}
+			if seen && len(newExtras) == 0 {
+				continue
+			}
+			visited[req.key()] = append(followed, newExtras...)
+
+			if !slices.Contains(closure[req.key()], root.key()) {
+				closure[req.key()] = append(closure[req.key()], root.key())
+			}
+
+			queue = append(queue, distributionDependencies(dist, visited[req.key()], env)...)
+		}
+	}
+
+	for key := range closure {
+		slices.Sort(closure[key])
+	}
+
+	return closure, nil
+}
+
+// returns the environment markers the reachable distributions are needed
+// under, keyed by canonical name, combining the markers on every path from
+// a top-level requirement; distributions needed everywhere map to nil
+// comparisons of extras are left out, the extras are followed instead
+func dependencyMarkers(roots []requirement, distributions []installedDistribution, env markerEnvironment) map[string]marker {
+	installed := make(map[string]installedDistribution)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist
+	}
+
+	markers := make(map[string]marker)
+
+	var visit func(req requirement, condition marker, path []string)
+	visit = func(req requirement, condition marker, path []string) {
+		dist, found := installed[req.key()]
+		if !found || slices.Contains(path, req.key()) {
+			return
+		}
+
+		if parsed, err := parseMarker(req.Marker); err == nil {
+			condition = markersAnd(condition, withoutExtras(parsed))
+		}
+
+		existing, seen := markers[req.key()]
+		if seen {
+			merged := markersOr(existing, condition)
+			// nothing changes below a package reached under the same conditions
+			if existing == nil || (merged != nil && merged.String() == existing.String()) {
+				return
+			}
+			condition = merged
+		}
+		markers[req.key()] = condition
+
+		for _, dependency := range distributionDependencies(dist, req.Extras, env) {
+			visit(dependency, condition, append(path, req.key()))
+		}
+	}
+
+	for _, root := range roots {
+		if root.appliesTo(env) {
+			visit(root, nil, nil)
+		}
+	}
+
+	return markers
+}
+
+// the parts of the pip install --report output used by pvm
+type pipInstallReport struct {
+	Install []struct {
+		Metadata struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"metadata"`
+		DownloadInfo directURL `json:"download_info"`
+	} `json:"install"`
+}
+
+// parses the output of pip install --report into the artifacts
+// keyed by the canonical name of each distribution
+func parsePipInstallReport(data []byte) (map[string]distributionArtifact, error) {
+	var report pipInstallReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	artifacts := make(map[string]distributionArtifact)
+	for _, item := range report.Install {
+		artifacts[normalizeName(item.Metadata.Name)] = distributionArtifact{
+			URL:    item.DownloadInfo.URL,
+			SHA256: archiveSHA256(&item.DownloadInfo),
+		}
+	}
+
+	return artifacts, nil
+}
+
+// returns the sha256 hash recorded for an archive, if any
+func archiveSHA256(url *directURL) string {
+	if url == nil || url.ArchiveInfo == nil {
+		return ""
+	}
+	if hash, found := url.ArchiveInfo.Hashes["sha256"]; found {
+		return hash
+	}
+	if hash, found := strings.CutPrefix(url.ArchiveInfo.Hash, "sha256="); found {
+		return hash
+	}
+	return ""
+}
+
+// asks pip which files it would download for the passed pinned packages
+// the packages are not installed
+func fetchDistributionArtifacts(pins []string) (map[string]distributionArtifact, error) {
+	if len(pins) == 0 {
+		return map[string]distributionArtifact{}, nil
+	}
+
+	pipPath, err := getVenvPipPath()
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := os.CreateTemp("", "pvm-report-*.json")
+	if err != nil {
+		return nil, err
+	}
+	report.Close()
+	defer os.Remove(report.Name())
+
+	args, err := pipInstallArgs(append([]string{"--dry-run", "--ignore-installed", "--no-deps", "--quiet", "--report", report.Name()}, pins...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(pipPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pip could not resolve the installed packages: %v\n%s", err, stderr.String())
+	}
+
+	data, err := os.ReadFile(report.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePipInstallReport(data)
+}
+
+// returns the source url pip reports for a distribution installed from a url
+func directURLSource(url *directURL) string {
+	if url.VCSInfo != nil && url.VCSInfo.CommitID != "" {
+		return url.VCSInfo.VCS + "+" + url.URL + "@" + url.VCSInfo.CommitID
+	}
+	return url.URL
+}
+
+// builds a lock file from the top-level requirements and the
+// distributions installed in the virtual environment
+// returns the lock file and the names of installed distributions
+// that no requirement depends on, which are left out of the lock
+// packages only needed on some platforms are locked with the marker
+// of the requirements pulling them in
+func buildLockFile(roots []requirement, distributions []installedDistribution, env markerEnvironment) (lockFile, []string, error) {
+	closure, err := dependencyClosure(roots, distributions, env)
+	if err != nil {
+		return lockFile{}, nil, err
+	}
+	markers := dependencyMarkers(roots, distributions, env)
+
+	var pins []string
+	var undeclared []string
+	for _, dist := range distributions {
+		key := normalizeName(dist.Name)
+		if _, found := closure[key]; !found {
+			if !isPipTooling(key) {
+				undeclared = append(undeclared, dist.Name)
+			}
+			continue
+		}
+		if dist.DirectURL == nil {
+			pins = append(pins, dist.Name+"=="+dist.Version)
+		}
+	}
+
+	artifacts, err := fetchDistributionArtifacts(pins)
+	if err != nil {
+		return lockFile{}, nil, err
+	}
+
+	return assembleLockFile(closure, markers, distributions, artifacts), undeclared, nil
+}
+
+// returns the lock file of the distributions in the closure, pinning
+// the ones installed from an index to their artifacts
+func assembleLockFile(closure map[string][]string, markers map[string]marker, distributions []installedDistribution, artifacts map[string]distributionArtifact) lockFile {
+	lock := lockFile{Version: lockFileVersion}
+
+	for _, dist := range distributions {
+		key := normalizeName(dist.Name)
+		requiredBy, found := closure[key]
+		if !found {
+			continue
+		}
+
+		pkg := lockedPackage{Name: key, Version: dist.Version, RequiredBy: requiredBy}
+		if markers[key] != nil {
+			pkg.Marker = markers[key].String()
+		}
+		if dist.DirectURL != nil {
+			pkg.Direct = true
+			pkg.Source = directURLSource(dist.DirectURL)
+			pkg.SHA256 = archiveSHA256(dist.DirectURL)
+		} else {
+			pkg.Source = artifacts[key].URL
+			pkg.SHA256 = artifacts[key].SHA256
+		}
+
+		lock.Packages = append(lock.Packages, pkg)
+	}
+
+	slices.SortFunc(lock.Packages, func(a, b lockedPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return lock
+}
+
+// builds the lock file from a resolution of the requirements instead of
+// the virtual environment
+// returns the lock file and the resolved packages as distributions
+func buildResolvedLockFile(roots []requirement, resolved []resolvedPackage, env markerEnvironment) (lockFile, []installedDistribution, error) {
+	var distributions []installedDistribution
+	artifacts := make(map[string]distributionArtifact)
+	for _, pkg := range resolved {
+		distributions = append(distributions, installedDistribution{Name: pkg.Name, Version: pkg.Version, RequiresDist: pkg.RequiresDist})
+		fileURL, _, _ := strings.Cut(pkg.File.URL, "#")
+		artifacts[normalizeName(pkg.Name)] = distributionArtifact{URL: fileURL, SHA256: pkg.File.Hashes["sha256"]}
+	}
+
+	closure, err := dependencyClosure(roots, distributions, env)
+	if err != nil {
+		return lockFile{}, nil, err
+	}
+
+	return assembleLockFile(closure, dependencyMarkers(roots, distributions, env), distributions, artifacts), distributions, nil
+}
+
+// records in the lock file which dependency groups need every package
+// groups maps the group names to their top-level requirements
+func assignLockGroups(lock *lockFile, groups map[string][]requirement, distributions []installedDistribution, env markerEnvironment) error {
+	names := slices.Sorted(maps.Keys(groups))
+
+	for _, name := range names {
+		closure, err := dependencyClosure(groups[name], distributions, env)
+		if err != nil {
+			return err
+		}
+
+		for i := range lock.Packages {
+			if _, found := closure[lock.Packages[i].Name]; found {
+				lock.Packages[i].Groups = append(lock.Packages[i].Groups, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns true for the packaging tools every virtual environment ships with
+func isPipTooling(key string) bool {
+	return key == "pip" || key == "setuptools" || key == "wheel"
+}
+
+// inspects the virtual environment and writes every distribution needed
+// by the project manifest to the pvm.lock file
+// returns the names of installed distributions left out of the lock and
+// the declared requirements that do not apply to this environment, which
+// cannot be locked from it
+func lockVirtualEnvironment() ([]string, []requirement, error) {
+	groups, err := getDeclaredGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env, err := getMarkerEnvironment()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var requirements []requirement
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		requirements = append(requirements, groups[name]...)
+	}
+
+	lock, undeclared, err := buildLockFile(requirements, distributions, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := assignLockGroups(&lock, groups, distributions, env); err != nil {
+		return nil, nil, err
+	}
+
+	root, err := getProjectRoot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return undeclared, inapplicableRequirements(requirements, env), writeLockFile(lock, filepath.Join(root, lockFileName))
+}
+
+// resolves the declared requirements against the package indexes and
+// writes the resolution to the pvm.lock file, without running pip
+// packages are resolved for the interpreter of the virtual environment
+// returns the declared requirements that do not apply to it
+func lockResolvedRequirements() ([]requirement, error) {
+	groups, err := getDeclaredGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := getMarkerEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	var requirements []requirement
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		requirements = append(requirements, groups[name]...)
+	}
+
+	resolved, err := resolveRequirements(requirements, env)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, distributions, err := buildResolvedLockFile(requirements, resolved, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := assignLockGroups(&lock, groups, distributions, env); err != nil {
+		return nil, err
+	}
+
+	root, err := getProjectRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	return inapplicableRequirements(requirements, env), writeLockFile(lock, filepath.Join(root, lockFileName))
+}
+
+// writes the lock file to the passed path
+func writeLockFile(lock lockFile, path string) error {
+	var buffer bytes.Buffer
+	buffer.WriteString(lockFileHeader)
+
+	if err := toml.NewEncoder(&buffer).Encode(lock); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buffer.Bytes(), 0644)
+}
+
+// reads the pvm.lock file of the project
+func readLockFile() (lockFile, error) {
+	var lock lockFile
+
+	path, err := getFilePath(lockFileName)
+	if err != nil {
+		return lock, err
+	}
+	if path == "" {
+		return lock, fmt.Errorf("%s not found, run \"pvm lock\" first", lockFileName)
+	}
+
+	if _, err := toml.DecodeFile(path, &lock); err != nil {
+		return lock, err
+	}
+	if lock.Version != lockFileVersion {
+		return lock, fmt.Errorf("unsupported %s version %d", lockFileName, lock.Version)
+	}
+
+	return lock, nil
+}
+
+// returns the hash-checked requirement that installs a locked package
+func lockedRequirement(pkg lockedPackage) (requirement, error) {
+	if pkg.SHA256 == "" {
+		return requirement{}, fmt.Errorf("%s has no hash in %s, it cannot be installed with --require-hashes", pkg.Name, lockFileName)
+	}
+
+	// pip skips the packages whose marker does not apply
+	req := requirement{Name: pkg.Name, Marker: pkg.Marker, Hashes: []string{"sha256:" + pkg.SHA256}}
+	if pkg.Direct {
+		req.URL = pkg.Source
+	} else {
+		req.Specifier = "==" + pkg.Version
+	}
+
+	return req, nil
+}
+
+// returns the lock file formatted as the lines of a hash-checked requirements file
+func lockedRequirements(lock lockFile) ([]string, error) {
+	var lines []string
+
+	for _, pkg := range lock.Packages {
+		req, err := lockedRequirement(pkg)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, req.String())
+	}
+
+	return lines, nil
+}
+
+// installs exactly the distributions recorded in the pvm.lock file
+// for the main dependencies and the selected groups
+func installPackagesFromLockFile(groups []string) error {
+	lock, err := readLockFile()
+	if err != nil {
+		return err
+	}
+
+	lines, err := lockedRequirements(lock.forGroups(groups))
+	if err != nil {
+		return err
+	}
+
+	return installRequirementLines(lines, "--require-hashes", "--no-deps")
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDistributions() []installedDistribution {
+	return []installedDistribution{
+		{Name: "requests", Version: "2.31.0", RequiresDist: []string{
+			"charset-normalizer<4,>=2",
+			"idna<4,>=2.5",
+			"PySocks!=1.5.7,>=1.5.6; extra == \"socks\"",
+		}},
+		{Name: "charset-normalizer", Version: "3.3.2"},
+		{Name: "idna", Version: "3.6"},
+		{Name: "PySocks", Version: "1.7.1"},
+		{Name: "Flask", Version: "3.0.0", RequiresDist: []string{"itsdangerous>=2.1.2", "Werkzeug>=3.0.0"}},
+		{Name: "itsdangerous", Version: "2.1.2"},
+		{Name: "werkzeug", Version: "3.0.1", RequiresDist: []string{"MarkupSafe>=2.1.1", "watchdog>=2.3; extra == \"watchdog\""}},
+		{Name: "MarkupSafe", Version: "2.1.3"},
+		{Name: "pip", Version: "23.2.1"},
+		{Name: "black", Version: "24.1.0"},
+	}
+}
+
+func TestDependencyClosure(t *testing.T) {
+	roots := []requirement{{Name: "Flask"}, {Name: "requests"}, {Name: "idna"}}
+
+	closure, err := dependencyClosure(roots, testDistributions(), testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("dependencyClosure failed: %v", err)
+	}
+
+	expected := map[string][]string{
+		"flask":              {"flask"},
+		"itsdangerous":       {"flask"},
+		"werkzeug":           {"flask"},
+		"markupsafe":         {"flask"},
+		"requests":           {"requests"},
+		"charset-normalizer": {"requests"},
+		"idna":               {"idna", "requests"},
+	}
+
+	if !reflect.DeepEqual(closure, expected) {
+		t.Errorf("unexpected closure: %v", closure)
+	}
+}
+
+func TestDependencyClosureFollowsExtras(t *testing.T) {
+	roots := []requirement{{Name: "requests", Extras: []string{"socks"}}}
+
+	closure, err := dependencyClosure(roots, testDistributions(), testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("dependencyClosure failed: %v", err)
+	}
+
+	if _, found := closure["pysocks"]; !found {
+		t.Errorf("expected extra dependency to be followed: %v", closure)
+	}
+}
+
+func TestDependencyClosureWithMissingRequirement(t *testing.T) {
+	_, err := dependencyClosure([]requirement{{Name: "django"}}, testDistributions(), testMarkerEnvironment())
+	if err == nil {
+		t.Errorf("expected missing top-level requirement to fail")
+	}
+}
+
+func TestDependencyClosureSkipsInapplicableRequirements(t *testing.T) {
+	roots := []requirement{{Name: "idna"}, {Name: "pywin32", Marker: `sys_platform == "win32"`}}
+
+	closure, err := dependencyClosure(roots, testDistributions(), testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("expected the requirement for windows to be skipped, received %v", err)
+	}
+	if !reflect.DeepEqual(closure, map[string][]string{"idna": {"idna"}}) {
+		t.Errorf("unexpected closure: %v", closure)
+	}
+}
+
+func TestDependencyMarkers(t *testing.T) {
+	distributions := []installedDistribution{
+		{Name: "app", Version: "1.0", RequiresDist: []string{
+			"colorama; platform_system == \"Linux\"",
+			"tomli; python_version >= \"3.10\"",
+			"uvloop[fast]; sys_platform != \"win32\" and extra == \"speed\"",
+			"idna",
+		}},
+		{Name: "uvloop", Version: "0.19.0", RequiresDist: []string{"cffi; extra == \"fast\"", "tomli"}},
+		{Name: "colorama", Version: "0.4.6"},
+		{Name: "tomli", Version: "2.0.1"},
+		{Name: "cffi", Version: "1.16.0"},
+		{Name: "idna", Version: "3.6"},
+	}
+
+	roots := []requirement{
+		{Name: "app", Extras: []string{"speed"}},
+		{Name: "idna", Marker: `python_version >= "3.8"`},
+	}
+	markers := dependencyMarkers(roots, distributions, testMarkerEnvironment())
+
+	received := make(map[string]string)
+	for key, m := range markers {
+		received[key] = ""
+		if m != nil {
+			received[key] = m.String()
+		}
+	}
+
+	expected := map[string]string{
+		"app":      "",
+		"colorama": `platform_system == "Linux"`,
+		"tomli":    `python_version >= "3.10" or sys_platform != "win32"`,
+		"uvloop":   `sys_platform != "win32"`,
+		"cffi":     `sys_platform != "win32"`,
+		"idna":     "",
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, received %v", expected, received)
+	}
+}
+
+func TestLockedRequirementKeepsMarker(t *testing.T) {
+	req, err := lockedRequirement(lockedPackage{Name: "colorama", Version: "0.4.6", SHA256: "abc", Marker: `sys_platform == "win32"`})
+	if err != nil {
+		t.Fatalf("lockedRequirement failed: %v", err)
+	}
+	if req.String() != `colorama==0.4.6; sys_platform == "win32" --hash=sha256:abc` {
+		t.Errorf("unexpected locked requirement %q", req.String())
+	}
+}
+
+func TestParsePipInstallReport(t *testing.T) {
+	report := []byte(`{
+		"version": "1",
+		"install": [
+			{
+				"download_info": {
+					"url": "https://files.pythonhosted.org/packages/idna-3.6-py3-none-any.whl",
+					"archive_info": {"hash": "sha256=c05567e9", "hashes": {"sha256": "c05567e9"}}
+				},
+				"metadata": {"name": "idna", "version": "3.6"}
+			},
+			{
+				"download_info": {
+					"url": "https://example.com/Flask-3.0.0.tar.gz",
+					"archive_info": {"hash": "sha256=cfadcdb6"}
+				},
+				"metadata": {"name": "Flask", "version": "3.0.0"}
+			}
+		]
+	}`)
+
+	artifacts, err := parsePipInstallReport(report)
+	if err != nil {
+		t.Fatalf("parsePipInstallReport failed: %v", err)
+	}
+
+	expected := map[string]distributionArtifact{
+		"idna":  {URL: "https://files.pythonhosted.org/packages/idna-3.6-py3-none-any.whl", SHA256: "c05567e9"},
+		"flask": {URL: "https://example.com/Flask-3.0.0.tar.gz", SHA256: "cfadcdb6"},
+	}
+
+	if !reflect.DeepEqual(artifacts, expected) {
+		t.Errorf("unexpected artifacts: %v", artifacts)
+	}
+}
+
+func TestBuildLockFileWithDirectReferences(t *testing.T) {
+	distributions := []installedDistribution{
+		{Name: "tool", Version: "1.0", DirectURL: &directURL{
+			URL:     "https://github.com/org/tool",
+			VCSInfo: &vcsInfo{VCS: "git", CommitID: "abc123"},
+		}},
+		{Name: "pip", Version: "23.2.1"},
+		{Name: "black", Version: "24.1.0", DirectURL: &directURL{URL: "file:///tmp/black"}},
+	}
+
+	lock, undeclared, err := buildLockFile([]requirement{{Name: "tool"}}, distributions, testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("buildLockFile failed: %v", err)
+	}
+
+	expected := []lockedPackage{
+		{Name: "tool", Version: "1.0", Source: "git+https://github.com/org/tool@abc123", Direct: true, RequiredBy: []string{"tool"}},
+	}
+
+	if !reflect.DeepEqual(lock.Packages, expected) {
+		t.Errorf("unexpected locked packages: %+v", lock.Packages)
+	}
+
+	if !reflect.DeepEqual(undeclared, []string{"black"}) {
+		t.Errorf("unexpected undeclared packages: %v", undeclared)
+	}
+}
+
+func TestBuildResolvedLockFile(t *testing.T) {
+	resolved := []resolvedPackage{
+		{Name: "colorama", Version: "0.4.6", File: indexFile{URL: "https://files.example/colorama-0.4.6-py2.py3-none-any.whl#sha256=4f", Hashes: map[string]string{"sha256": "4f"}}},
+		{Name: "idna", Version: "3.6", File: indexFile{URL: "https://files.example/idna-3.6-py3-none-any.whl", Hashes: map[string]string{"sha256": "c0"}}},
+		{Name: "requests", Version: "2.31.0", File: indexFile{URL: "https://files.example/requests-2.31.0.tar.gz", Hashes: map[string]string{"sha256": "94"}}, RequiresDist: []string{
+			"idna<4,>=2.5",
+			`colorama; sys_platform == "win32"`,
+		}},
+	}
+
+	lock, distributions, err := buildResolvedLockFile([]requirement{{Name: "requests"}}, resolved, testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("buildResolvedLockFile failed: %v", err)
+	}
+
+	expected := []lockedPackage{
+		{Name: "idna", Version: "3.6", Source: "https://files.example/idna-3.6-py3-none-any.whl", SHA256: "c0", RequiredBy: []string{"requests"}},
+		{Name: "requests", Version: "2.31.0", Source: "https://files.example/requests-2.31.0.tar.gz", SHA256: "94", RequiredBy: []string{"requests"}},
+	}
+	if !reflect.DeepEqual(lock.Packages, expected) {
+		t.Errorf("unexpected locked packages: %+v", lock.Packages)
+	}
+
+	if len(distributions) != len(resolved) || distributions[2].RequiresDist[0] != "idna<4,>=2.5" {
+		t.Errorf("unexpected distributions: %+v", distributions)
+	}
+}
+
+func TestWriteAndReadLockFile(t *testing.T) {
+	setupTempDirectory(t)
+
+	lock := lockFile{Version: lockFileVersion, Packages: []lockedPackage{
+		{Name: "idna", Version: "3.6", Source: "https://files.pythonhosted.org/idna-3.6.whl", SHA256: "c05567e9", RequiredBy: []string{"requests"}},
+		{Name: "requests", Version: "2.31.0", Source: "https://files.pythonhosted.org/requests-2.31.0.whl", SHA256: "58cd2187", RequiredBy: []string{"requests"}},
+	}}
+
+	cwd, _ := os.Getwd()
+	if err := writeLockFile(lock, filepath.Join(cwd, lockFileName)); err != nil {
+		t.Fatalf("writeLockFile failed: %v", err)
+	}
+
+	read, err := readLockFile()
+	if err != nil {
+		t.Fatalf("readLockFile failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(read, lock) {
+		t.Errorf("lock file changed during round trip: %+v", read)
+	}
+}
+
+func TestReadLockFileWithoutLockFile(t *testing.T) {
+	setupTempDirectory(t)
+
+	if _, err := readLockFile(); err == nil {
+		t.Errorf("expected missing lock file to fail")
+	}
+}
+
+func TestLockedRequirements(t *testing.T) {
+	lock := lockFile{Version: lockFileVersion, Packages: []lockedPackage{
+		{Name: "idna", Version: "3.6", Source: "https://files.pythonhosted.org/idna-3.6.whl", SHA256: "c05567e9"},
+		{Name: "tool", Version: "1.0", Source: "https://example.com/tool-1.0.tar.gz", SHA256: "abcdef", Direct: true},
+	}}
+
+	lines, err := lockedRequirements(lock)
+	if err != nil {
+		t.Fatalf("lockedRequirements failed: %v", err)
+	}
+
+	expected := []string{"idna==3.6 --hash=sha256:c05567e9", "tool @ https://example.com/tool-1.0.tar.gz --hash=sha256:abcdef"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, received %q", expected, lines)
+	}
+
+	lock.Packages = append(lock.Packages, lockedPackage{Name: "vcs", Version: "1.0", Direct: true})
+	if _, err := lockedRequirements(lock); err == nil || !strings.Contains(err.Error(), "vcs") {
+		t.Errorf("expected package without hash to fail, received %v", err)
+	}
+}
+
+func TestLockFileCheckCurrent(t *testing.T) {
+	lock := lockFile{Version: lockFileVersion, Packages: []lockedPackage{
+		{Name: "idna", Version: "3.6", RequiredBy: []string{"requests"}},
+		{Name: "requests", Version: "2.31.0", RequiredBy: []string{"requests"}},
+	}}
+	env := testMarkerEnvironment()
+
+	current := []requirement{
+		{Name: "Requests", Specifier: ">=2.31"},
+		{Name: "pywin32", Marker: `sys_platform == "win32"`},
+	}
+	if err := lock.checkCurrent(current, env); err != nil {
+		t.Errorf("expected the lock file to be current: %v", err)
+	}
+
+	// pvm install flask without pvm lock afterwards
+	installed := append(current, requirement{Name: "flask"})
+	if err := lock.checkCurrent(installed, env); err == nil || !strings.Contains(err.Error(), "flask is not locked") {
+		t.Errorf("expected flask to be reported as not locked, received %v", err)
+	}
+
+	if err := lock.checkCurrent([]requirement{{Name: "requests", Specifier: ">=2.32"}}, env); err == nil || !strings.Contains(err.Error(), "does not satisfy >=2.32") {
+		t.Errorf("expected the locked version not to satisfy the specifier, received %v", err)
+	}
+
+	if err := lock.checkCurrent(nil, env); err == nil || !strings.Contains(err.Error(), "requests is no longer declared") {
+		t.Errorf("expected requests to be reported as no longer declared, received %v", err)
+	}
+}
+
+func TestAssignLockGroups(t *testing.T) {
+	lock := lockFile{Version: lockFileVersion}
+	for _, name := range []string{"charset-normalizer", "flask", "idna", "itsdangerous", "markupsafe", "requests", "werkzeug"} {
+		lock.Packages = append(lock.Packages, lockedPackage{Name: name})
+	}
+
+	groups := map[string][]requirement{
+		mainGroup: {{Name: "requests"}},
+		"dev":     {{Name: "flask"}, {Name: "idna"}},
+	}
+	if err := assignLockGroups(&lock, groups, testDistributions(), testMarkerEnvironment()); err != nil {
+		t.Fatalf("assignLockGroups failed: %v", err)
+	}
+
+	actual := make(map[string][]string)
+	for _, pkg := range lock.Packages {
+		actual[pkg.Name] = pkg.Groups
+	}
+
+	if !reflect.DeepEqual(actual["idna"], []string{"dev", "main"}) || !reflect.DeepEqual(actual["werkzeug"], []string{"dev"}) {
+		t.Errorf("unexpected groups: %v", actual)
+	}
+
+	var names []string
+	for _, pkg := range lock.forGroups(nil).Packages {
+		names = append(names, pkg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"charset-normalizer", "idna", "requests"}) {
+		t.Errorf("unexpected main packages: %q", names)
+	}
+
+	if len(lock.forGroups([]string{"dev"}).Packages) != len(lock.Packages) {
+		t.Errorf("expected every package to be selected with the dev group")
+	}
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -13,12 +17,20 @@ func main() {
 		Short: "pvm helps with package management.",
 		Long:  `pvm is a package manager CLI built to improve the usage of pip and python.`,
 	}
+	rootCmd.PersistentFlags().StringVar(&projectFlag, "project", "", "Project directory to use instead of searching upward from the working directory")
 
 	// init command
-	rootCmd.AddCommand(&cobra.Command{
+	var pythonFlag string
+
+	initCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize a new project",
 		Run: func(cmd *cobra.Command, args []string) {
+			// a new project is created in the working directory, not in a parent project
+			if projectFlag == "" {
+				projectFlag = "."
+			}
+
 			fmt.Println("Initializing a python new project...")
 
 			virtualEnvironmentExists, err := detectVirtualEnvironment()
@@ -28,32 +40,75 @@ func main() {
 			}
 
 			if !virtualEnvironmentExists {
-				err := createVirtualEnvironment()
+				interpreter, err := selectPythonInterpreter(pythonFlag)
+				if err != nil {
+					fmt.Println("Error while selecting python interpreter:", err)
+					return
+				}
+
+				venvPath, err := getNewVenvPath()
+				if err != nil {
+					fmt.Println("Error while creating virtual environment:", err)
+					return
+				}
+
+				fmt.Printf("Using Python %s (%s).\n", interpreter.Version, interpreter.Path)
+				err = createVirtualEnvironmentWith(interpreter.Path, venvPath)
 				if err != nil {
 					fmt.Println("Error while creating virtual environment:", err)
 					return
 				}
 
 				fmt.Println("Created a new virtual environment.")
+			} else if pythonFlag != "" {
+				fmt.Println("A virtual environment already exists, --python is ignored.")
 			}
 
-			path, err := getFilePath("requirements.txt")
+			if pythonFlag != "" && !virtualEnvironmentExists {
+				path, err := getFilePath(pythonVersionFileName)
+				if err != nil {
+					fmt.Println("Error while detecting .python-version file:", err)
+					return
+				}
+
+				if path == "" {
+					err := writePythonVersionFile(pythonFlag)
+					if err != nil {
+						fmt.Println("Error while creating .python-version file:", err)
+						return
+					}
+
+					fmt.Println("Created a new .python-version file.")
+				}
+			}
+
+			pyproject, err := usesPyproject()
 			if err != nil {
-				fmt.Println("Error while detecting requirements file:", err)
+				fmt.Println("Error while detecting pyproject file:", err)
 				return
 			}
 
-			if path == "" {
-				err := createRequirementsFile()
+			if pyproject {
+				fmt.Println("Using the dependencies declared in pyproject.toml.")
+			} else {
+				path, err := getFilePath(getManifestName())
 				if err != nil {
-					fmt.Println("Error while creating requirements file:", err)
+					fmt.Println("Error while detecting requirements file:", err)
 					return
 				}
-			}
 
-			fmt.Println("Created a new requirements.txt file.")
+				if path == "" {
+					err := createRequirementsFile()
+					if err != nil {
+						fmt.Println("Error while creating requirements file:", err)
+						return
+					}
+				}
+
+				fmt.Printf("Created a new %s file.\n", getManifestName())
+			}
 
-			path, err = getFilePath(".gitignore")
+			path, err := getFilePath(".gitignore")
 			if err != nil {
 				fmt.Println("Error while detecting gitignore file:", err)
 				return
@@ -69,10 +124,17 @@ func main() {
 
 			fmt.Println("Created a new gitignore file.")
 		},
-	})
+	}
+	initCmd.Flags().StringVar(&pythonFlag, "python", "", "Python version to create the virtual environment with, e.g. 3.11 or >=3.10,<3.13")
+	rootCmd.AddCommand(initCmd)
 
 	// install command
-	rootCmd.AddCommand(&cobra.Command{
+	var pinFlag string
+	var lockedFlag bool
+	var installOptionalFlag string
+	var installGroupFlag []string
+
+	installCmd := &cobra.Command{
 		Use:   "install",
 		Short: "Install a python pip package",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -87,36 +149,109 @@ func main() {
 				return
 			}
 
-			if len(args) == 0 {
-				fmt.Println("Installing package(s) from requirements.txt...")
-				err := installPackagesFromRequirements()
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
+			if installOptionalFlag != "" && len(installGroupFlag) > 0 {
+				fmt.Println("--optional cannot be used together with --group.")
+				return
+			}
+
+			if lockedFlag {
+				if len(args) > 0 {
+					fmt.Println("Packages cannot be passed together with --locked.")
+					return
+				}
+
+				groups, err := selectDependencyGroups(installGroupFlag)
+				if err != nil {
+					fmt.Println("Error while selecting dependency groups:", err)
+					return
+				}
+
+				fmt.Println("Installing package(s) from pvm.lock...")
+				err = installPackagesFromLockFile(groups)
+				if err != nil {
+					fmt.Println("Error while installing locked package(s):", err)
+					return
+				}
+
+				fmt.Println("All package(s) from the lock file have been installed.")
+			} else if len(args) == 0 {
+				groups, err := selectDependencyGroups(installGroupFlag)
+				if err != nil {
+					fmt.Println("Error while selecting dependency groups:", err)
+					return
+				}
+
+				fmt.Printf("Installing package(s) from %s...\n", getManifestName())
+				err = installPackagesFromManifest(dependencySection{Optional: installOptionalFlag})
 				if err != nil {
 					fmt.Println("Error while installing package(s):", err)
 					return
 				}
 
-				fmt.Println("All package(s) from the requirements file have been installed.")
+				for _, group := range groups {
+					fmt.Printf("Installing package(s) from the %s group...\n", group)
+					err = installPackagesFromManifest(groupSection(group))
+					if err != nil {
+						fmt.Println("Error while installing package(s):", err)
+						return
+					}
+				}
+
+				fmt.Printf("All package(s) from %s have been installed.\n", getManifestName())
 			} else {
+				if len(installGroupFlag) > 1 {
+					fmt.Println("Packages can be added to only one group at a time.")
+					return
+				}
+
+				section := dependencySection{Optional: installOptionalFlag}
+				if len(installGroupFlag) == 1 {
+					section = groupSection(installGroupFlag[0])
+				}
+
+				policy, err := resolvePinPolicy(pinFlag)
+				if err != nil {
+					fmt.Println("Error while reading the pin policy:", err)
+					return
+				}
+
 				fmt.Println("Installing packages...")
-				err := installPackages(args)
+				err = installPackages(args)
 				if err != nil {
 					fmt.Println("Error while installing packages:", err)
 					return
 				}
 				fmt.Println("The package(s) have been installed.")
-				fmt.Println("Adding package(s) to the requirements file...")
-				err = addPackagesToRequirementsFile(args)
+				fmt.Printf("Adding package(s) to %s...\n", getSectionManifestName(section))
+				packages, err := pinPackages(args, policy, section)
+				if err != nil {
+					fmt.Println("Error while pinning package versions:", err)
+					return
+				}
+				err = addPackagesToManifest(packages, section)
 				if err != nil {
-					fmt.Println("Error while writing packages to requirements file:", err)
+					fmt.Println("Error while writing packages to the manifest:", err)
 					return
 				}
-				fmt.Println("The package(s) have been written to the requirements file.")
+				fmt.Printf("The package(s) have been written to %s.\n", getSectionManifestName(section))
 			}
 		},
-	})
+	}
+	installCmd.Flags().StringVar(&pinFlag, "pin", "", "How to pin installed versions: exact, compatible, lower-bound or none")
+	installCmd.Flags().BoolVar(&lockedFlag, "locked", false, "Install exactly the packages recorded in pvm.lock")
+	installCmd.Flags().StringVar(&installOptionalFlag, "optional", "", "Use the named extra of [project.optional-dependencies] in pyproject.toml")
+	installCmd.Flags().StringSliceVar(&installGroupFlag, "group", nil, "Use the named dependency group, such as dev or test")
+	rootCmd.AddCommand(installCmd)
 
 	// uninstall command
-	rootCmd.AddCommand(&cobra.Command{
+	var uninstallOptionalFlag string
+	var uninstallGroupFlag string
+
+	uninstallCmd := &cobra.Command{
 		Use:   "uninstall",
 		Short: "Uninstall a python pip package",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -125,6 +260,16 @@ func main() {
 				return
 			}
 
+			if uninstallOptionalFlag != "" && uninstallGroupFlag != "" {
+				fmt.Println("--optional cannot be used together with --group.")
+				return
+			}
+
+			section := dependencySection{Optional: uninstallOptionalFlag}
+			if uninstallGroupFlag != "" {
+				section = groupSection(uninstallGroupFlag)
+			}
+
 			virtualEnvironmentExists, err := detectVirtualEnvironment()
 			if err != nil {
 				fmt.Println("Error while detecting virtual environment:", err)
@@ -136,6 +281,10 @@ func main() {
 				return
 			}
 
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
 			fmt.Println("Uninstalling package(s)...")
 			err = uninstallPackages(args)
 			if err != nil {
@@ -143,24 +292,614 @@ func main() {
 				return
 			}
 			fmt.Println("The package(s) have been uninstalled.")
-			
-			fmt.Println("Removing package(s) from the rquirements file...")
-			err = removePackagesFromRequirementsFile(args)
+
+			fmt.Printf("Removing package(s) from %s...\n", getSectionManifestName(section))
+			err = removePackagesFromManifest(args, section)
 			if err != nil {
-				fmt.Println("Error while removing packages from requirements file:", err)
+				fmt.Println("Error while removing packages from the manifest:", err)
 				return
 			}
-			fmt.Println("The package(s) have been removed from the requirements file.")
+			fmt.Printf("The package(s) have been removed from %s.\n", getSectionManifestName(section))
+		},
+	}
+	uninstallCmd.Flags().StringVar(&uninstallOptionalFlag, "optional", "", "Use the named extra of [project.optional-dependencies] in pyproject.toml")
+	uninstallCmd.Flags().StringVar(&uninstallGroupFlag, "group", "", "Use the named dependency group, such as dev or test")
+	rootCmd.AddCommand(uninstallCmd)
+
+	// list command
+	var listJSONFlag bool
+	var outdatedOnlyFlag bool
+	var undeclaredOnlyFlag bool
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the installed packages and whether the project declares them",
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" && !listJSONFlag {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
+			packages, err := listVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while listing packages:", err)
+				return
+			}
+
+			if undeclaredOnlyFlag {
+				packages = filterUndeclaredPackages(packages)
+			}
+
+			if outdatedOnlyFlag {
+				latest, err := getOutdatedVersions()
+				if err != nil {
+					fmt.Println("Error while checking for newer versions:", err)
+					return
+				}
+				packages = filterOutdatedPackages(packages, latest)
+			}
+
+			if err := writePackageList(os.Stdout, packages, listJSONFlag, outdatedOnlyFlag); err != nil {
+				fmt.Println("Error while listing packages:", err)
+			}
+		},
+	}
+	listCmd.Flags().BoolVar(&listJSONFlag, "json", false, "Print the packages as JSON")
+	listCmd.Flags().BoolVar(&outdatedOnlyFlag, "outdated-only", false, "Only list packages with a newer version on the package index")
+	listCmd.Flags().BoolVar(&undeclaredOnlyFlag, "undeclared-only", false, "Only list packages nothing the project declares needs")
+	rootCmd.AddCommand(listCmd)
+
+	// tree command
+	var reverseFlag string
+	var depthFlag int
+	var treeJSONFlag bool
+	var treeDotFlag bool
+
+	treeCmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Show the dependency tree of the declared packages",
+		Run: func(cmd *cobra.Command, args []string) {
+			if treeJSONFlag && treeDotFlag {
+				fmt.Println("--json cannot be used together with --dot.")
+				return
+			}
+
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			graph, err := loadDependencyGraph()
+			if err != nil {
+				fmt.Println("Error while reading the dependency graph:", err)
+				return
+			}
+
+			var nodes []*dependencyNode
+			var output any
+			if reverseFlag != "" {
+				node, err := graph.reverseTree(reverseFlag, depthFlag)
+				if err != nil {
+					fmt.Println("Error while reading the dependency graph:", err)
+					return
+				}
+				nodes = []*dependencyNode{node}
+				output = node
+			} else {
+				nodes = graph.tree(depthFlag)
+				output = nodes
+			}
+
+			switch {
+			case treeJSONFlag:
+				err = writeJSON(os.Stdout, output)
+			case treeDotFlag:
+				err = writeDependencyDot(os.Stdout, nodes, reverseFlag != "")
+			default:
+				if len(nodes) == 0 {
+					fmt.Printf("No packages declared in %s.\n", getManifestName())
+					return
+				}
+				err = writeDependencyTree(os.Stdout, nodes, reverseFlag != "")
+			}
+			if err != nil {
+				fmt.Println("Error while printing the dependency tree:", err)
+			}
+		},
+	}
+	treeCmd.Flags().StringVar(&reverseFlag, "reverse", "", "Show the packages depending on the named package instead")
+	treeCmd.Flags().IntVar(&depthFlag, "depth", -1, "Levels of dependencies to show below the top-level packages, all of them when negative")
+	treeCmd.Flags().BoolVar(&treeJSONFlag, "json", false, "Print the tree as JSON")
+	treeCmd.Flags().BoolVar(&treeDotFlag, "dot", false, "Print the dependency graph in the Graphviz DOT format")
+	rootCmd.AddCommand(treeCmd)
+
+	// why command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "why <package>",
+		Short: "Show which declared packages pull in a package",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			graph, err := loadDependencyGraph()
+			if err != nil {
+				fmt.Println("Error while reading the dependency graph:", err)
+				return
+			}
+
+			paths, truncated, err := graph.paths(args[0])
+			if err != nil {
+				fmt.Println("Error while reading the dependency graph:", err)
+				return
+			}
+
+			name := normalizeName(args[0])
+			if len(paths) == 0 {
+				fmt.Printf("%s %s is installed but no package declared in %s needs it.\n", name, graph.versions[name], getManifestName())
+				return
+			}
+
+			fmt.Printf("%s %s is needed by:\n", name, graph.versions[name])
+			for _, path := range paths {
+				fmt.Println("  " + formatDependencyPath(path))
+			}
+			if truncated {
+				fmt.Printf("Only the first %d paths from each declared package are shown.\n", maxPathsPerRoot)
+			}
 		},
 	})
 
+	// outdated command
+	var outdatedJSONFlag bool
+	var outdatedAllFlag bool
+
+	outdatedCmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "Compare the declared packages with the latest versions on the package index",
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			packages, err := checkOutdatedPackages()
+			if err != nil {
+				fmt.Println("Error while checking for newer versions:", err)
+				return
+			}
+
+			if !outdatedAllFlag {
+				var shown []outdatedPackage
+				for _, pkg := range packages {
+					if pkg.outdated() || pkg.Error != "" {
+						shown = append(shown, pkg)
+					}
+				}
+				packages = shown
+			}
+
+			if len(packages) == 0 && !outdatedJSONFlag {
+				fmt.Println("All declared packages are up to date.")
+				return
+			}
+
+			if err := writeOutdatedPackages(os.Stdout, packages, outdatedJSONFlag); err != nil {
+				fmt.Println("Error while checking for newer versions:", err)
+			}
+		},
+	}
+	outdatedCmd.Flags().BoolVar(&outdatedJSONFlag, "json", false, "Print the packages as JSON")
+	outdatedCmd.Flags().BoolVar(&outdatedAllFlag, "all", false, "Also show the packages that are up to date")
+	rootCmd.AddCommand(outdatedCmd)
+
+	// upgrade command
+	var upgradeLatestFlag bool
+	var upgradeMinorFlag bool
+	var upgradePatchFlag bool
+	var upgradeDryRunFlag bool
+	var upgradeOptionalFlag string
+	var upgradeGroupFlag string
+
+	upgradeCmd := &cobra.Command{
+		Use:   "upgrade [package...]",
+		Short: "Upgrade declared packages and rewrite their version specifiers",
+		Run: func(cmd *cobra.Command, args []string) {
+			mode := upgradeCompatible
+			modes := 0
+			if upgradeLatestFlag {
+				mode = upgradeLatest
+				modes++
+			}
+			if upgradeMinorFlag {
+				mode = upgradeMinor
+				modes++
+			}
+			if upgradePatchFlag {
+				mode = upgradePatch
+				modes++
+			}
+			if modes > 1 {
+				fmt.Println("Only one of --latest, --minor and --patch can be used.")
+				return
+			}
+
+			if upgradeOptionalFlag != "" && upgradeGroupFlag != "" {
+				fmt.Println("--optional cannot be used together with --group.")
+				return
+			}
+
+			section := dependencySection{Optional: upgradeOptionalFlag}
+			if upgradeGroupFlag != "" {
+				section = groupSection(upgradeGroupFlag)
+			}
+
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
+			policy, err := resolvePinPolicy("")
+			if err != nil {
+				fmt.Println("Error while reading the pin policy:", err)
+				return
+			}
+
+			m, err := openManifest(section)
+			if err != nil {
+				fmt.Println("Error while reading the manifest:", err)
+				return
+			}
+
+			actions, err := planUpgrade(m, args, mode, policy)
+			if err != nil {
+				fmt.Println("Error while computing the upgrades:", err)
+				return
+			}
+
+			if len(actions) == 0 {
+				if mode == upgradeCompatible {
+					fmt.Println("The package(s) are at the newest version their specifier allows. Use --patch, --minor or --latest to go beyond it.")
+				} else {
+					fmt.Println("The package(s) are already up to date.")
+				}
+				return
+			}
+
+			for _, action := range actions {
+				fmt.Println(action.line())
+			}
+
+			if upgradeDryRunFlag {
+				return
+			}
+
+			fmt.Println("Upgrading package(s)...")
+			err = applyUpgrade(m, actions)
+			if err != nil {
+				fmt.Println("Error while upgrading packages:", err)
+				return
+			}
+			fmt.Printf("The package(s) have been upgraded and %s has been updated.\n", m.fileName())
+
+			if lockPath, err := getFilePath(lockFileName); err == nil && lockPath != "" {
+				fmt.Println("Run \"pvm lock\" to update pvm.lock.")
+			}
+		},
+	}
+	upgradeCmd.Flags().BoolVar(&upgradeLatestFlag, "latest", false, "Upgrade to the newest version, beyond the declared specifier")
+	upgradeCmd.Flags().BoolVar(&upgradeMinorFlag, "minor", false, "Upgrade to the newest version with the same major version")
+	upgradeCmd.Flags().BoolVar(&upgradePatchFlag, "patch", false, "Upgrade to the newest version with the same major and minor version")
+	upgradeCmd.Flags().BoolVar(&upgradeDryRunFlag, "dry-run", false, "Print the upgrades without applying them")
+	upgradeCmd.Flags().StringVar(&upgradeOptionalFlag, "optional", "", "Use the named extra of [project.optional-dependencies] in pyproject.toml")
+	upgradeCmd.Flags().StringVar(&upgradeGroupFlag, "group", "", "Use the named dependency group, such as dev or test")
+	rootCmd.AddCommand(upgradeCmd)
+
+	// lock command
+	var resolveFlag bool
+
+	lockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Record every installed dependency with its hash in pvm.lock",
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
+			var undeclared []string
+			var inapplicable []requirement
+			if resolveFlag {
+				fmt.Println("Resolving declared package(s)...")
+				inapplicable, err = lockResolvedRequirements()
+			} else {
+				fmt.Println("Locking installed package(s)...")
+				undeclared, inapplicable, err = lockVirtualEnvironment()
+			}
+			if err != nil {
+				fmt.Println("Error while locking packages:", err)
+				return
+			}
+
+			if len(undeclared) > 0 {
+				fmt.Printf("Skipped package(s) not required by %s: %s\n", getManifestName(), strings.Join(undeclared, ", "))
+			}
+			for _, req := range inapplicable {
+				fmt.Printf("Skipped %s, its marker does not apply to this environment: %s\n", req.Name, req.Marker)
+			}
+			fmt.Println("The package(s) have been written to pvm.lock.")
+		},
+	}
+
+	lockCmd.Flags().BoolVar(&resolveFlag, "resolve", false, "Resolve the declared packages against the package index instead of locking the installed ones")
+	rootCmd.AddCommand(lockCmd)
+
+	// sync command
+	var dryRunFlag bool
+	var syncGroupFlag []string
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Make the virtual environment match the declared packages exactly",
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
+			groups, err := selectDependencyGroups(syncGroupFlag)
+			if err != nil {
+				fmt.Println("Error while selecting dependency groups:", err)
+				return
+			}
+
+			plan, err := planSync(groups)
+			if err != nil {
+				fmt.Println("Error while computing the changes:", err)
+				return
+			}
+
+			if plan.empty() {
+				fmt.Println("The virtual environment is already in sync.")
+				return
+			}
+
+			for _, line := range plan.lines() {
+				fmt.Println(line)
+			}
+
+			if dryRunFlag {
+				return
+			}
+
+			fmt.Println("Syncing the virtual environment...")
+			err = applySyncPlan(plan)
+			if err != nil {
+				fmt.Println("Error while syncing the virtual environment:", err)
+				return
+			}
+			fmt.Println("The virtual environment is in sync.")
+		},
+	}
+	syncCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Print the changes without applying them")
+	syncCmd.Flags().StringSliceVar(&syncGroupFlag, "group", nil, "Also keep the packages of the named dependency group")
+	rootCmd.AddCommand(syncCmd)
+
+	// venv command
+	venvCmd := &cobra.Command{
+		Use:   "venv",
+		Short: "Manage the virtual environment of the project",
+	}
+
+	var rebuildPythonFlag string
+	var rebuildGroupFlag []string
+
+	venvRebuildCmd := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Recreate the virtual environment and reinstall the declared packages",
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			groups, err := selectDependencyGroups(rebuildGroupFlag)
+			if err != nil {
+				fmt.Println("Error while selecting dependency groups:", err)
+				return
+			}
+
+			interpreter, err := selectPythonInterpreter(rebuildPythonFlag)
+			if err != nil {
+				fmt.Println("Error while selecting python interpreter:", err)
+				return
+			}
+
+			fmt.Printf("Rebuilding the virtual environment with Python %s (%s)...\n", interpreter.Version, interpreter.Path)
+			err = rebuildVirtualEnvironment(interpreter, groups)
+			if err != nil {
+				fmt.Println("Error while rebuilding the virtual environment:", err)
+				return
+			}
+			fmt.Println("The virtual environment has been rebuilt.")
+		},
+	}
+	venvRebuildCmd.Flags().StringVar(&rebuildPythonFlag, "python", "", "Python version to use instead of the one the project declares")
+	venvRebuildCmd.Flags().StringSliceVar(&rebuildGroupFlag, "group", nil, "Also reinstall the packages of the named dependency group")
+	venvCmd.AddCommand(venvRebuildCmd)
+
+	rootCmd.AddCommand(venvCmd)
+
+	// python command
+	pythonCmd := &cobra.Command{
+		Use:   "python",
+		Short: "Find the python interpreters installed on the system",
+	}
+
+	var pythonListJSONFlag bool
+
+	pythonListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List every python interpreter found on the system",
+		Run: func(cmd *cobra.Command, args []string) {
+			interpreters, err := markProjectInterpreter(discoverPythonInterpreters())
+			if err != nil {
+				fmt.Println("Error while reading the virtual environment:", err)
+				return
+			}
+
+			if len(interpreters) == 0 && !pythonListJSONFlag {
+				fmt.Println("No python interpreters found.")
+				return
+			}
+
+			err = writePythonInterpreters(os.Stdout, interpreters, pythonListJSONFlag)
+			if err != nil {
+				fmt.Println("Error while listing python interpreters:", err)
+			}
+		},
+	}
+	pythonListCmd.Flags().BoolVar(&pythonListJSONFlag, "json", false, "Print the interpreters as JSON")
+	pythonCmd.AddCommand(pythonListCmd)
+
+	var pythonFindJSONFlag bool
+
+	pythonFindCmd := &cobra.Command{
+		Use:   "find [version]",
+		Short: "Find the newest python interpreter matching the version or .python-version",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			request := ""
+			if len(args) == 1 {
+				request = args[0]
+			} else {
+				var err error
+				request, err = readPythonVersionFile()
+				if err != nil {
+					fmt.Println("Error while reading .python-version file:", err)
+					return
+				}
+			}
+
+			interpreters, err := markProjectInterpreter(discoverPythonInterpreters())
+			if err != nil {
+				fmt.Println("Error while reading the virtual environment:", err)
+				return
+			}
+
+			interpreter, err := findPythonInterpreter(request, interpreters)
+			if err != nil {
+				fmt.Println("Error while finding python interpreter:", err)
+				return
+			}
+
+			if pythonFindJSONFlag {
+				err = writeJSON(os.Stdout, interpreter)
+			} else {
+				err = writePythonInterpreters(os.Stdout, []pythonInterpreter{interpreter}, false)
+			}
+			if err != nil {
+				fmt.Println("Error while printing python interpreter:", err)
+			}
+		},
+	}
+	pythonFindCmd.Flags().BoolVar(&pythonFindJSONFlag, "json", false, "Print the interpreter as JSON")
+	pythonCmd.AddCommand(pythonFindCmd)
+
+	rootCmd.AddCommand(pythonCmd)
+
 	// run command
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "run",
-		Short: "Runs a specified python script in the virtual environment",
+	var moduleFlag bool
+
+	runCmd := &cobra.Command{
+		Use:   "run [-m module] <script|task> [args...]",
+		Short: "Runs a specified python script, module or task of the project configuration in the virtual environment",
 		Run: func(cmd *cobra.Command, args []string) {
+			config, err := loadProjectConfig()
+			if err != nil {
+				fmt.Println("Error while reading the project configuration:", err)
+				return
+			}
+
 			if len(args) == 0 {
+				if moduleFlag {
+					fmt.Println("No module entered to run.")
+					return
+				}
+
 				fmt.Println("No scripts entered to run.")
+				if len(config.Scripts) > 0 {
+					fmt.Println("Available tasks:")
+					for _, name := range slices.Sorted(maps.Keys(config.Scripts)) {
+						fmt.Printf("  %s: %s\n", name, config.Scripts[name].Command)
+					}
+				}
 				return
 			}
 
@@ -175,17 +914,179 @@ func main() {
 				return
 			}
 
+			if mismatch, err := venvPythonMismatch(); err == nil && mismatch != "" {
+				fmt.Printf("Warning: %s. Run \"pvm venv rebuild\".\n", mismatch)
+			}
+
+			if moduleFlag {
+				err = runModule(args[0], passThroughArgs(args[1:]))
+				if code, exited := exitCodeOf(err); exited {
+					os.Exit(code)
+				}
+				if err != nil {
+					fmt.Printf("Error while running module %s: %v\n", args[0], err)
+				}
+				return
+			}
+
+			if _, found := config.Scripts[args[0]]; found {
+				err = runTask(config.Scripts, args[0], passThroughArgs(args[1:]))
+				if code, exited := exitCodeOf(err); exited {
+					// the failing task is named on stderr, next to its own output
+					fmt.Fprintln(os.Stderr, "Error while running task:", err)
+					os.Exit(code)
+				}
+				if err != nil {
+					fmt.Println("Error while running task:", err)
+				}
+				return
+			}
+
 			scriptName := args[0]
-			err = runScript(scriptName)
+			err = runScript(scriptName, passThroughArgs(args[1:])...)
+			if code, exited := exitCodeOf(err); exited {
+				os.Exit(code)
+			}
 			if err != nil {
 				fmt.Printf("Error while running script %s: %v\n", scriptName, err)
 				return
 			}
 		},
-	})
+	}
+	runCmd.Flags().BoolVarP(&moduleFlag, "module", "m", false, "Run the first argument as a python module like python -m")
+	runCmd.Flags().StringSliceVar(&envFileFlag, "env-file", nil, "Load variables from the dotenv file besides the .env of the project")
+	runCmd.Flags().StringVar(&envProfileFlag, "profile", "", "Load variables from the .env.<profile> file of the project, e.g. staging")
+	// everything after the script name belongs to the script
+	runCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(runCmd)
+
+	// exec command
+	execCmd := &cobra.Command{
+		Use:   "exec <command> [args...]",
+		Short: "Runs a command with the executables of the virtual environment first on PATH",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				fmt.Println("No command entered to run.")
+				return
+			}
+
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			err = execInVenv(args[0], args[1:])
+			if code, exited := exitCodeOf(err); exited {
+				os.Exit(code)
+			}
+			if err != nil {
+				fmt.Printf("Error while running %s: %v\n", args[0], err)
+				return
+			}
+		},
+	}
+	execCmd.Flags().StringSliceVar(&envFileFlag, "env-file", nil, "Load variables from the dotenv file besides the .env of the project")
+	execCmd.Flags().StringVar(&envProfileFlag, "profile", "", "Load variables from the .env.<profile> file of the project, e.g. staging")
+	execCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(execCmd)
+
+	// shell command
+	var shellFlag string
+
+	shellCmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Starts your shell with the virtual environment activated",
+		Run: func(cmd *cobra.Command, args []string) {
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Println("Error while detecting virtual environment:", err)
+				return
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Println("Virtual environment not initiated. Run \"pvm init\"")
+				return
+			}
+
+			venvPath, err := getVenvPath()
+			if err != nil {
+				fmt.Println("Error while locating the virtual environment:", err)
+				return
+			}
+			if active := os.Getenv("VIRTUAL_ENV"); active != "" && filepath.Clean(active) == venvPath {
+				fmt.Println("The virtual environment is already active.")
+				return
+			}
+
+			fmt.Println("Starting a shell with the virtual environment activated, type \"exit\" to leave it.")
+
+			err = spawnActivatedShell(shellFlag)
+			if code, exited := exitCodeOf(err); exited {
+				os.Exit(code)
+			}
+			if err != nil {
+				fmt.Println("Error while starting the shell:", err)
+				return
+			}
+		},
+	}
+	shellCmd.Flags().StringVar(&shellFlag, "shell", "", "Shell to start instead of the one in $SHELL: bash, zsh, fish or sh")
+	rootCmd.AddCommand(shellCmd)
+
+	// activate command
+	var printFlag bool
+	var activateShellFlag string
+
+	activateCmd := &cobra.Command{
+		Use:   "activate --print",
+		Short: "Prints the shell code activating the virtual environment, to use with eval",
+		Run: func(cmd *cobra.Command, args []string) {
+			kind, _, err := detectShell(activateShellFlag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error while detecting the shell:", err)
+				return
+			}
+
+			if !printFlag {
+				// pvm runs in a child process and cannot change the shell that started it
+				fmt.Println("To activate the virtual environment in your shell run:")
+				fmt.Println("  " + activationHint(kind))
+				return
+			}
+
+			// the output is evaluated by the shell, so errors go to stderr
+			virtualEnvironmentExists, err := detectVirtualEnvironment()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error while detecting virtual environment:", err)
+				os.Exit(1)
+			}
+
+			if !virtualEnvironmentExists {
+				fmt.Fprintln(os.Stderr, "Virtual environment not initiated. Run \"pvm init\"")
+				os.Exit(1)
+			}
+
+			activation, err := getVenvActivation()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error while locating the virtual environment:", err)
+				os.Exit(1)
+			}
+
+			fmt.Print(activationScript(kind, activation))
+		},
+	}
+	activateCmd.Flags().BoolVar(&printFlag, "print", false, "Print the activation code instead of instructions")
+	activateCmd.Flags().StringVar(&activateShellFlag, "shell", "", "Shell to print the code for instead of the one in $SHELL: bash, zsh, fish or sh")
+	rootCmd.AddCommand(activateCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// name of the group holding the regular dependencies of the project
+const mainGroup = "main"
+
+// selects which dependency list of the project a command works on
+type dependencySection struct {
+	Optional string // extra in [project.optional-dependencies], pyproject.toml only
+	Group    string // dependency group such as dev or test, empty for the main dependencies
+}
+
+// returns the dependency section for the named group
+func groupSection(group string) dependencySection {
+	if normalizeName(group) == mainGroup {
+		return dependencySection{}
+	}
+	return dependencySection{Group: normalizeName(group)}
+}
+
+// returns the name of the group the section belongs to
+func (s dependencySection) groupName() string {
+	if s.Group == "" {
+		return mainGroup
+	}
+	return s.Group
+}
+
+// a file that declares the dependencies of the project
+type manifest interface {
+	// name of the file shown to the user
+	fileName() string
+	// requirements declared in the selected section
+	requirements() ([]requirement, error)
+	// updates or adds the requirement, returns true if the manifest changed
+	set(req requirement) (bool, error)
+	// removes the requirement with the canonical name, returns true if the manifest changed
+	remove(key string) (bool, error)
+	// writes the manifest back to disk
+	save() error
+}
+
+// a requirements.txt manifest
+type requirementsManifest struct {
+	path string
+	doc  *requirementsDocument
+}
+
+func (m *requirementsManifest) fileName() string {
+	if root, err := getProjectRoot(); err == nil {
+		if relative, err := filepath.Rel(root, m.path); err == nil {
+			return filepath.ToSlash(relative)
+		}
+	}
+	return filepath.Base(m.path)
+}
+
+func (m *requirementsManifest) requirements() ([]requirement, error) {
+	return m.doc.requirements(), nil
+}
+
+func (m *requirementsManifest) set(req requirement) (bool, error) {
+	return m.doc.set(req), nil
+}
+
+func (m *requirementsManifest) remove(key string) (bool, error) {
+	return m.doc.remove(key), nil
+}
+
+func (m *requirementsManifest) save() error {
+	return m.doc.save(m.path)
+}
+
+// a PEP 621 pyproject.toml manifest
+type pyprojectManifest struct {
+	path      string
+	doc       *pyprojectDocument
+	arrayPath string // dotted path of the edited array, e.g. project.dependencies
+	dynamic   bool   // dependencies are computed by the build backend
+}
+
+func (m *pyprojectManifest) fileName() string {
+	return "pyproject.toml"
+}
+
+func (m *pyprojectManifest) requirements() ([]requirement, error) {
+	return m.arrayRequirements(m.arrayPath, nil)
+}
+
+// returns the requirements of the array, following the PEP 735
+// include-group tables of dependency groups
+func (m *pyprojectManifest) arrayRequirements(path string, visited []string) ([]requirement, error) {
+	if slices.Contains(visited, path) {
+		return nil, fmt.Errorf("dependency group %s includes itself", strings.TrimPrefix(path, "dependency-groups."))
+	}
+	visited = append(visited, path)
+
+	values, err := m.doc.strings(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var requirements []requirement
+	for _, value := range values {
+		req, err := parseRequirement(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s in pyproject.toml: %v", path, err)
+		}
+		requirements = append(requirements, req)
+	}
+
+	includes, err := m.doc.includes(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range includes {
+		included, err := m.arrayRequirements(pyprojectGroupPath(m.doc, group), visited)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, included...)
+	}
+
+	return requirements, nil
+}
+
+func (m *pyprojectManifest) set(req requirement) (bool, error) {
+	value, err := pep508String(req)
+	if err != nil {
+		return false, err
+	}
+
+	values, err := m.doc.strings(m.arrayPath)
+	if err != nil {
+		return false, err
+	}
+
+	for i, existing := range values {
+		current, err := parseRequirement(existing)
+		if err != nil || current.key() != req.key() {
+			continue
+		}
+		if existing == value {
+			return false, nil
+		}
+		return true, m.doc.replaceArrayItem(m.arrayPath, i, value)
+	}
+
+	if m.dynamic && values == nil {
+		return false, fmt.Errorf("the dependencies in pyproject.toml are dynamic and cannot be edited")
+	}
+
+	return true, m.doc.appendArrayItem(m.arrayPath, value)
+}
+
+func (m *pyprojectManifest) remove(key string) (bool, error) {
+	changed := false
+
+	for {
+		values, err := m.doc.strings(m.arrayPath)
+		if err != nil {
+			return changed, err
+		}
+
+		index := slices.IndexFunc(values, func(value string) bool {
+			req, err := parseRequirement(value)
+			return err == nil && req.key() == key
+		})
+		if index < 0 {
+			return changed, nil
+		}
+
+		if err := m.doc.removeArrayItem(m.arrayPath, index); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+}
+
+func (m *pyprojectManifest) save() error {
+	return m.doc.save(m.path)
+}
+
+// returns the dotted path of a dependency group in pyproject.toml
+// group names are compared in their normalized form
+func pyprojectGroupPath(doc *pyprojectDocument, group string) string {
+	for _, key := range doc.keys("dependency-groups") {
+		if normalizeName(key) == normalizeName(group) {
+			return "dependency-groups." + key
+		}
+	}
+	return "dependency-groups." + normalizeName(group)
+}
+
+// returns the requirement formatted as a PEP 508 string
+// as used in pyproject.toml, which has no pip options
+func pep508String(req requirement) (string, error) {
+	if req.Editable {
+		return "", fmt.Errorf("editable requirements cannot be declared in pyproject.toml")
+	}
+	if req.Name == "" {
+		return "", fmt.Errorf("%s needs a project name to be declared in pyproject.toml, use \"name @ url\"", req.URL)
+	}
+
+	req.Hashes = nil
+	if req.URL == "" {
+		return req.String(), nil
+	}
+
+	formatted := req.Name
+	if len(req.Extras) > 0 {
+		formatted += "[" + strings.Join(req.Extras, ",") + "]"
+	}
+	formatted += " @ " + req.URL
+	if req.Marker != "" {
+		formatted += " ; " + req.Marker
+	}
+
+	return formatted, nil
+}
+
+// returns true if the project declares its dependencies in a
+// pyproject.toml file with a [project] table
+func usesPyproject() (bool, error) {
+	path, err := getFilePath("pyproject.toml")
+	if err != nil || path == "" {
+		return false, err
+	}
+
+	doc, err := loadPyprojectDocument(path)
+	if err != nil {
+		return false, err
+	}
+
+	return doc.hasTable("project"), nil
+}
+
+// returns the name of the manifest file the project uses
+func getManifestName() string {
+	if pyproject, err := usesPyproject(); err == nil && pyproject {
+		return "pyproject.toml"
+	}
+	if config, err := loadProjectConfig(); err == nil {
+		return filepath.ToSlash(config.manifest())
+	}
+	return defaultManifest
+}
+
+// opens the manifest of the project, preferring a PEP 621
+// pyproject.toml over requirements.txt
+func openManifest(section dependencySection) (manifest, error) {
+	pyprojectPath, err := getFilePath("pyproject.toml")
+	if err != nil {
+		return nil, err
+	}
+
+	if pyprojectPath != "" {
+		doc, err := loadPyprojectDocument(pyprojectPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if doc.hasTable("project") {
+			m := &pyprojectManifest{path: pyprojectPath, doc: doc, arrayPath: "project.dependencies"}
+			if section.Optional != "" {
+				m.arrayPath = "project.optional-dependencies." + section.Optional
+			} else if section.Group != "" {
+				m.arrayPath = pyprojectGroupPath(doc, section.Group)
+			} else {
+				dynamic, err := doc.strings("project.dynamic")
+				if err != nil {
+					return nil, err
+				}
+				m.dynamic = slices.Contains(dynamic, "dependencies")
+			}
+			return m, nil
+		}
+	}
+
+	if section.Optional != "" {
+		return nil, fmt.Errorf("optional dependencies need a pyproject.toml file with a [project] table")
+	}
+
+	if section.Group != "" {
+		return openGroupRequirementsFile(section.Group)
+	}
+
+	requirementsFile, err := getRequirementsFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := loadRequirementsDocument(requirementsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &requirementsManifest{path: requirementsFile, doc: doc}, nil
+}
+
+// group names matched by the group manifest pattern that are not
+// dependency groups, such as requirements-lock.txt of lock tools
+var reservedGroupNames = []string{"lock", "constraints"}
+
+// opens the requirements-<group>.txt file of a dependency group
+// a missing file is treated as empty and created when saved
+func openGroupRequirementsFile(group string) (manifest, error) {
+	if slices.Contains(reservedGroupNames, normalizeName(group)) {
+		return nil, fmt.Errorf("%s cannot be the name of a dependency group", group)
+	}
+
+	files, err := findGroupRequirementsFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	path, found := files[normalizeName(group)]
+	if !found {
+		config, err := loadProjectConfig()
+		if err != nil {
+			return nil, err
+		}
+		root, err := getProjectRoot()
+		if err != nil {
+			return nil, err
+		}
+		return &requirementsManifest{path: filepath.Join(root, config.groupManifest(group)), doc: &requirementsDocument{newline: "\n"}}, nil
+	}
+
+	doc, err := loadRequirementsDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &requirementsManifest{path: path, doc: doc}, nil
+}
+
+// returns the requirements files of the dependency groups in the project,
+// keyed by normalized group name
+// the group name is the part of the file name matched by {group}
+func findGroupRequirementsFiles() (map[string]string, error) {
+	root, err := getProjectRoot()
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := filepath.Join(root, config.groupManifest("*"))
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]string)
+	for _, file := range files {
+		if file == filepath.Join(root, config.manifest()) {
+			continue
+		}
+
+		name := normalizeName(strings.TrimSuffix(strings.TrimPrefix(file, prefix), suffix))
+		if _, found := groups[name]; found || slices.Contains(reservedGroupNames, name) {
+			continue
+		}
+		groups[name] = file
+	}
+
+	return groups, nil
+}
+
+// returns the dependency groups the project declares, either in the
+// [dependency-groups] table of pyproject.toml or as requirements-<group>.txt files
+func listDependencyGroups() ([]string, error) {
+	pyproject, err := usesPyproject()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string
+
+	if pyproject {
+		path, err := getFilePath("pyproject.toml")
+		if err != nil {
+			return nil, err
+		}
+		doc, err := loadPyprojectDocument(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range doc.keys("dependency-groups") {
+			groups = append(groups, normalizeName(key))
+		}
+	} else {
+		files, err := findGroupRequirementsFiles()
+		if err != nil {
+			return nil, err
+		}
+		groups = slices.Collect(maps.Keys(files))
+	}
+
+	slices.Sort(groups)
+	return slices.Compact(groups), nil
+}
+
+// returns the requirements of the main dependencies followed by
+// the requirements of every selected group
+func getRequirementsOfGroups(groups []string) ([]requirement, error) {
+	requirements, err := getDeclaredRequirements(dependencySection{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		section := groupSection(group)
+		if section.Group == "" {
+			continue
+		}
+
+		groupRequirements, err := getDeclaredRequirements(section)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, groupRequirements...)
+	}
+
+	return requirements, nil
+}
+
+// returns the top-level requirements of the main dependencies and of
+// every dependency group, keyed by group name
+func getDeclaredGroups() (map[string][]requirement, error) {
+	groupNames, err := listDependencyGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]requirement)
+	for _, name := range append([]string{mainGroup}, groupNames...) {
+		requirements, err := getDeclaredRequirements(groupSection(name))
+		if err != nil {
+			return nil, err
+		}
+		groups[name] = requirements
+	}
+
+	return groups, nil
+}
+
+// returns the normalized names of the selected dependency groups
+// fails if the project does not declare one of them
+func selectDependencyGroups(groups []string) ([]string, error) {
+	declared, err := listDependencyGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, group := range groups {
+		section := groupSection(group)
+		if section.Group == "" {
+			continue
+		}
+		if !slices.Contains(declared, section.Group) {
+			return nil, fmt.Errorf("unknown dependency group %s", group)
+		}
+		if !slices.Contains(selected, section.Group) {
+			selected = append(selected, section.Group)
+		}
+	}
+
+	return selected, nil
+}
+
+// returns the name of the manifest file that holds the section
+func getSectionManifestName(section dependencySection) string {
+	if m, err := openManifest(section); err == nil {
+		return m.fileName()
+	}
+	return getManifestName()
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// name of the file in the virtual environment caching its marker environment
+const markerEnvironmentFileName = "pvm-markers.json"
+
+// script run by the virtual environment interpreter to report
+// the values of the marker variables, as described by PEP 508
+const markerEnvironmentScript = `import json, os, platform, sys
+def format_full_version(info):
+    version = "{0.major}.{0.minor}.{0.micro}".format(info)
+    if info.releaselevel != "final":
+        version += info.releaselevel[0] + str(info.serial)
+    return version
+print(json.dumps({
+    "implementation_name": sys.implementation.name,
+    "implementation_version": format_full_version(sys.implementation.version),
+    "os_name": os.name,
+    "platform_machine": platform.machine(),
+    "platform_python_implementation": platform.python_implementation(),
+    "platform_release": platform.release(),
+    "platform_system": platform.system(),
+    "platform_version": platform.version(),
+    "python_full_version": platform.python_version(),
+    "python_version": ".".join(platform.python_version_tuple()[:2]),
+    "sys_platform": sys.platform,
+}))`
+
+// values of the marker variables of an interpreter, keyed by variable name
+type markerEnvironment map[string]string
+
+// the marker environment cached in the virtual environment
+type cachedMarkerEnvironment struct {
+	Stamp       string            `json:"stamp"` // modification times and sizes of the interpreter and pyvenv.cfg
+	Environment markerEnvironment `json:"environment"`
+}
+
+// the marker variables mapped to their canonical names, including
+// the dotted spellings older metadata still uses
+var markerVariables = map[string]string{
+	"implementation_name":            "implementation_name",
+	"implementation_version":         "implementation_version",
+	"os_name":                        "os_name",
+	"os.name":                        "os_name",
+	"platform_machine":               "platform_machine",
+	"platform.machine":               "platform_machine",
+	"platform_python_implementation": "platform_python_implementation",
+	"platform.python_implementation": "platform_python_implementation",
+	"python_implementation":          "platform_python_implementation",
+	"platform_release":               "platform_release",
+	"platform_system":                "platform_system",
+	"platform_version":               "platform_version",
+	"platform.version":               "platform_version",
+	"python_full_version":            "python_full_version",
+	"python_version":                 "python_version",
+	"sys_platform":                   "sys_platform",
+	"sys.platform":                   "sys_platform",
+	"extra":                          "extra",
+}
+
+// a parsed environment marker
+// a nil marker applies to every environment
+type marker interface {
+	evaluate(env markerEnvironment) (bool, error)
+	String() string
+}
+
+// a variable or a quoted string on one side of a marker comparison
+type markerOperand struct {
+	Value    string
+	Variable bool
+}
+
+// a comparison such as python_version >= "3.8"
+type markerComparison struct {
+	Left     markerOperand
+	Operator string // a version comparison operator, in or not in
+	Right    markerOperand
+}
+
+// markers joined by and
+type markerAnd []marker
+
+// markers joined by or
+type markerOr []marker
+
+// returns the value of the operand in the environment
+func (o markerOperand) value(env markerEnvironment) (string, error) {
+	if !o.Variable {
+		return o.Value, nil
+	}
+	value, found := env[o.Value]
+	if !found {
+		return "", fmt.Errorf("marker variable %s is not defined", o.Value)
+	}
+	return value, nil
+}
+
+func (o markerOperand) String() string {
+	if o.Variable {
+		return o.Value
+	}
+	if strings.Contains(o.Value, `"`) {
+		return "'" + o.Value + "'"
+	}
+	return `"` + o.Value + `"`
+}
+
+func (c markerComparison) evaluate(env markerEnvironment) (bool, error) {
+	left, err := c.Left.value(env)
+	if err != nil {
+		return false, err
+	}
+	right, err := c.Right.value(env)
+	if err != nil {
+		return false, err
+	}
+
+	// extras are compared by their normalized names
+	if (c.Left.Variable && c.Left.Value == "extra") || (c.Right.Variable && c.Right.Value == "extra") {
+		left, right = normalizeName(left), normalizeName(right)
+	}
+
+	return compareMarkerValues(left, c.Operator, right)
+}
+
+func (c markerComparison) String() string {
+	return c.Left.String() + " " + c.Operator + " " + c.Right.String()
+}
+
+func (m markerAnd) evaluate(env markerEnvironment) (bool, error) {
+	for _, term := range m {
+		matches, err := term.evaluate(env)
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m markerAnd) String() string {
+	terms := make([]string, len(m))
+	for i, term := range m {
+		terms[i] = term.String()
+		if _, isOr := term.(markerOr); isOr {
+			terms[i] = "(" + terms[i] + ")"
+		}
+	}
+	return strings.Join(terms, " and ")
+}
+
+func (m markerOr) evaluate(env markerEnvironment) (bool, error) {
+	for _, term := range m {
+		matches, err := term.evaluate(env)
+		if err != nil || matches {
+			return matches, err
+		}
+	}
+	return false, nil
+}
+
+func (m markerOr) String() string {
+	terms := make([]string, len(m))
+	for i, term := range m {
+		terms[i] = term.String()
+	}
+	return strings.Join(terms, " or ")
+}
+
+// compares two marker values
+// the comparison is a version comparison when the right side is a valid
+// specifier for the left side, and a string comparison otherwise
+func compareMarkerValues(left string, operator string, right string) (bool, error) {
+	if operator != "in" && operator != "not in" {
+		if spec, err := pep440.ParseSpecifier(operator + right); err == nil {
+			if version, err := pep440.Parse(left); err == nil {
+				return spec.Contains(version, true), nil
+			}
+		}
+	}
+
+	switch operator {
+	case "in":
+		return strings.Contains(right, left), nil
+	case "not in":
+		return !strings.Contains(right, left), nil
+	case "==":
+		return left == right, nil
+	case "===":
+		return strings.EqualFold(left, right), nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	case ">=":
+		return left >= right, nil
+	}
+
+	return false, fmt.Errorf("cannot compare %q and %q with %s", left, right, operator)
+}
+
+// splits a marker into parentheses, quoted strings, operators and words
+func tokenizeMarker(text string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(text[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid marker %q: unterminated string", text)
+			}
+			tokens = append(tokens, text[i:i+end+2])
+			i += end + 2
+		case strings.ContainsRune("<>=!~", rune(c)):
+			j := i
+			for j < len(text) && strings.ContainsRune("<>=!~", rune(text[j])) {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(text) && !strings.ContainsRune(" \t()\"'<>=!~", rune(text[j])) {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+// parses an environment marker as written after the ; of a requirement
+// returns a nil marker for an empty one
+func parseMarker(text string) (marker, error) {
+	tokens, err := tokenizeMarker(text)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+
+	parser := markerParser{text: text, tokens: tokens}
+	parsed, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position < len(tokens) {
+		return nil, fmt.Errorf("invalid marker %q: unexpected %s", text, tokens[parser.position])
+	}
+	return parsed, nil
+}
+
+// a recursive descent parser over the tokens of a marker
+type markerParser struct {
+	text     string
+	tokens   []string
+	position int
+}
+
+// returns the next token without consuming it, empty at the end
+func (p *markerParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *markerParser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+func (p *markerParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid marker %q: %s", p.text, fmt.Sprintf(format, args...))
+}
+
+func (p *markerParser) or() (marker, error) {
+	var terms markerOr
+	for {
+		term, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.peek() != "or" {
+			break
+		}
+		p.next()
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *markerParser) and() (marker, error) {
+	var terms markerAnd
+	for {
+		term, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.peek() != "and" {
+			break
+		}
+		p.next()
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *markerParser) expression() (marker, error) {
+	if p.peek() == "(" {
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, p.errorf("expected )")
+		}
+		return inner, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	operator := p.next()
+	switch operator {
+	case "===", "==", "!=", "<=", ">=", "<", ">", "~=", "in":
+	case "not":
+		if p.next() != "in" {
+			return nil, p.errorf("expected in after not")
+		}
+		operator = "not in"
+	case "":
+		return nil, p.errorf("expected an operator after %s", left)
+	default:
+		return nil, p.errorf("unknown operator %s", operator)
+	}
+
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	return markerComparison{Left: left, Operator: operator, Right: right}, nil
+}
+
+func (p *markerParser) operand() (markerOperand, error) {
+	token := p.next()
+	if token == "" {
+		return markerOperand{}, p.errorf("unexpected end")
+	}
+
+	if token[0] == '"' || token[0] == '\'' {
+		return markerOperand{Value: token[1 : len(token)-1]}, nil
+	}
+
+	variable, found := markerVariables[token]
+	if !found {
+		return markerOperand{}, p.errorf("unknown variable %s", token)
+	}
+	return markerOperand{Value: variable, Variable: true}, nil
+}
+
+// joins the markers with and, dropping the ones that apply everywhere
+// and the duplicates
+func markersAnd(markers ...marker) marker {
+	var terms markerAnd
+	seen := make(map[string]bool)
+	for _, m := range markers {
+		if m == nil || seen[m.String()] {
+			continue
+		}
+		seen[m.String()] = true
+		terms = append(terms, m)
+	}
+
+	switch len(terms) {
+	case 0:
+		return nil
+	case 1:
+		return terms[0]
+	}
+	return terms
+}
+
+// joins the markers with or, applying everywhere when one of them does
+func markersOr(markers ...marker) marker {
+	var terms markerOr
+	seen := make(map[string]bool)
+	for _, m := range markers {
+		if m == nil {
+			return nil
+		}
+		if seen[m.String()] {
+			continue
+		}
+		seen[m.String()] = true
+		terms = append(terms, m)
+	}
+
+	switch len(terms) {
+	case 0:
+		return nil
+	case 1:
+		return terms[0]
+	}
+	return terms
+}
+
+// returns the marker without its comparisons of the extra variable,
+// which only decide whether an extra pulls the requirement in
+func withoutExtras(m marker) marker {
+	switch m := m.(type) {
+	case markerComparison:
+		if (m.Left.Variable && m.Left.Value == "extra") || (m.Right.Variable && m.Right.Value == "extra") {
+			return nil
+		}
+		return m
+	case markerAnd:
+		var terms []marker
+		for _, term := range m {
+			terms = append(terms, withoutExtras(term))
+		}
+		return markersAnd(terms...)
+	case markerOr:
+		var terms []marker
+		for _, term := range m {
+			terms = append(terms, withoutExtras(term))
+		}
+		return markersOr(terms...)
+	}
+	return m
+}
+
+// returns true if the marker applies to the environment when the
+// requirement is installed with one of the extras, like pip does
+// an empty marker applies everywhere
+func markerApplies(text string, env markerEnvironment, extras []string) (bool, error) {
+	parsed, err := parseMarker(text)
+	if err != nil || parsed == nil {
+		return err == nil, err
+	}
+
+	if len(extras) == 0 {
+		extras = []string{""}
+	}
+
+	for _, extra := range extras {
+		withExtra := make(markerEnvironment, len(env)+1)
+		for key, value := range env {
+			withExtra[key] = value
+		}
+		withExtra["extra"] = extra
+
+		matches, err := parsed.evaluate(withExtra)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// returns true if the requirement applies to the environment
+// requirements with a marker pvm cannot evaluate are treated as applying,
+// leaving the decision to pip
+func (req requirement) appliesTo(env markerEnvironment) bool {
+	applies, err := markerApplies(req.Marker, env, nil)
+	return applies || err != nil
+}
+
+// runs the interpreter to learn the values of the marker variables
+func queryMarkerEnvironment(pythonPath string) (markerEnvironment, error) {
+	output, err := exec.Command(pythonPath, "-c", markerEnvironmentScript).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not run %s: %v", pythonPath, err)
+	}
+
+	var env markerEnvironment
+	if err := json.Unmarshal(output, &env); err != nil {
+		return nil, fmt.Errorf("unexpected output from %s: %v", pythonPath, err)
+	}
+	return env, nil
+}
+
+// returns the marker environment of the virtual environment interpreter
+// the interpreter is only run once, its answer is cached in the virtual
+// environment until the interpreter or the virtual environment changes
+func getMarkerEnvironment() (markerEnvironment, error) {
+	pythonPath, err := getVenvPythonPath()
+	if err != nil {
+		return nil, err
+	}
+
+	venvPath := filepath.Dir(filepath.Dir(pythonPath))
+	cachePath := filepath.Join(venvPath, markerEnvironmentFileName)
+	stamp := configFilesStamp([]string{pythonPath, filepath.Join(venvPath, "pyvenv.cfg")})
+
+	var cached cachedMarkerEnvironment
+	if data, err := os.ReadFile(cachePath); err == nil {
+		if json.Unmarshal(data, &cached) == nil && cached.Stamp == stamp && cached.Environment != nil {
+			return cached.Environment, nil
+		}
+	}
+
+	env, err := queryMarkerEnvironment(pythonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// a cache that cannot be written only costs running the interpreter again
+	if data, err := json.Marshal(cachedMarkerEnvironment{Stamp: stamp, Environment: env}); err == nil {
+		os.WriteFile(cachePath, data, 0644)
+	}
+
+	return env, nil
+}
+
+// returns the requirements that do not apply to the environment, once per package
+func inapplicableRequirements(requirements []requirement, env markerEnvironment) []requirement {
+	var inapplicable []requirement
+	for _, req := range requirements {
+		if !req.appliesTo(env) && !slices.ContainsFunc(inapplicable, func(found requirement) bool {
+			return found.key() == req.key()
+		}) {
+			inapplicable = append(inapplicable, req)
+		}
+	}
+	return inapplicable
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// the marker environment of CPython 3.12 on 64-bit linux
+func testMarkerEnvironment() markerEnvironment {
+	return markerEnvironment{
+		"implementation_name":            "cpython",
+		"implementation_version":         "3.12.1",
+		"os_name":                        "posix",
+		"platform_machine":               "x86_64",
+		"platform_python_implementation": "CPython",
+		"platform_release":               "6.5.0-15-generic",
+		"platform_system":                "Linux",
+		"platform_version":               "#15-Ubuntu SMP PREEMPT_DYNAMIC",
+		"python_full_version":            "3.12.1",
+		"python_version":                 "3.12",
+		"sys_platform":                   "linux",
+	}
+}
+
+func TestParseMarker(t *testing.T) {
+	tests := []struct {
+		marker   string
+		expected string
+	}{
+		{`python_version>="3.8"`, `python_version >= "3.8"`},
+		{`sys_platform == 'win32' and platform_machine != "arm64"`, `sys_platform == "win32" and platform_machine != "arm64"`},
+		{`(os_name == "nt" or os_name == "posix") and extra == 'test'`, `(os_name == "nt" or os_name == "posix") and extra == "test"`},
+		{`os.name == "nt" or python_implementation == "PyPy"`, `os_name == "nt" or platform_python_implementation == "PyPy"`},
+		{`"linux" in sys_platform`, `"linux" in sys_platform`},
+		{`platform_release not in '5.0 6.0'`, `platform_release not in "5.0 6.0"`},
+		{`platform_version == 'say "hi"'`, `platform_version == 'say "hi"'`},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		parsed, err := parseMarker(test.marker)
+		if err != nil {
+			t.Errorf("parseMarker(%q) failed: %v", test.marker, err)
+			continue
+		}
+		received := ""
+		if parsed != nil {
+			received = parsed.String()
+		}
+		if received != test.expected {
+			t.Errorf("parseMarker(%q) = %q, expected %q", test.marker, received, test.expected)
+		}
+	}
+
+	for _, invalid := range []string{
+		`python_version >= `,
+		`python_version >= "3.8" and`,
+		`python_version "3.8"`,
+		`python_version >= "3.8`,
+		`(python_version >= "3.8"`,
+		`python_version >= "3.8")`,
+		`platform == "linux"`,
+		`python_version => "3.8"`,
+		`sys_platform not "linux"`,
+	} {
+		if _, err := parseMarker(invalid); err == nil {
+			t.Errorf("expected parseMarker(%q) to fail", invalid)
+		}
+	}
+}
+
+func TestMarkerApplies(t *testing.T) {
+	tests := []struct {
+		marker   string
+		extras   []string
+		expected bool
+	}{
+		{``, nil, true},
+		{`sys_platform == "win32"`, nil, false},
+		{`sys_platform == "linux"`, nil, true},
+		{`python_version >= "3.8"`, nil, true},
+		{`python_version < "3.10"`, nil, false},
+		{`python_full_version >= "3.12.0rc1"`, nil, true},
+		{`python_version ~= "3.11"`, nil, true},
+		{`"3.13" > python_version`, nil, true},
+		{`python_version == "3.*"`, nil, true},
+		{`platform_release >= "6"`, nil, true},
+		{`platform_release < "5.10"`, nil, false},
+		{`"linux" in sys_platform`, nil, true},
+		{`platform_machine not in "arm64 aarch64"`, nil, true},
+		{`implementation_name == "cpython" and platform_machine == "arm64"`, nil, false},
+		{`os_name == "nt" or (os_name == "posix" and platform_system == "Linux")`, nil, true},
+		{`extra == "socks"`, nil, false},
+		{`extra == "socks"`, []string{"test", "socks"}, true},
+		{`extra == "Dev_Tools"`, []string{"dev-tools"}, true},
+		{`extra == "test" and extra == "docs"`, []string{"test", "docs"}, false},
+		{`extra == "test" and python_version < "3.10"`, []string{"test"}, false},
+	}
+
+	env := testMarkerEnvironment()
+	for _, test := range tests {
+		applies, err := markerApplies(test.marker, env, test.extras)
+		if err != nil {
+			t.Errorf("markerApplies(%q, %v) failed: %v", test.marker, test.extras, err)
+		} else if applies != test.expected {
+			t.Errorf("markerApplies(%q, %v) = %v, expected %v", test.marker, test.extras, applies, test.expected)
+		}
+	}
+
+	if _, err := markerApplies(`python_version ~= "linux"`, env, nil); err == nil {
+		t.Errorf("expected ~= on strings that are not versions to fail")
+	}
+
+	// requirements pvm cannot evaluate are left to pip
+	if !(requirement{Name: "demo", Marker: `python_version ~= "linux"`}).appliesTo(env) {
+		t.Errorf("expected a marker that cannot be evaluated to apply")
+	}
+}
+
+func TestWithoutExtras(t *testing.T) {
+	tests := []struct {
+		marker   string
+		expected string
+	}{
+		{`extra == "socks"`, ""},
+		{`extra == "socks" and sys_platform == "win32"`, `sys_platform == "win32"`},
+		{`(extra == "a" or extra == "b") and python_version < "3.11"`, `python_version < "3.11"`},
+		{`extra == "a" or sys_platform == "win32"`, ""},
+		{`sys_platform == "win32" or sys_platform == "cygwin"`, `sys_platform == "win32" or sys_platform == "cygwin"`},
+	}
+
+	for _, test := range tests {
+		parsed, err := parseMarker(test.marker)
+		if err != nil {
+			t.Fatalf("parseMarker(%q) failed: %v", test.marker, err)
+		}
+		received := ""
+		if stripped := withoutExtras(parsed); stripped != nil {
+			received = stripped.String()
+		}
+		if received != test.expected {
+			t.Errorf("withoutExtras(%q) = %q, expected %q", test.marker, received, test.expected)
+		}
+	}
+}
+
+func TestGetMarkerEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake interpreter is a shell script")
+	}
+
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	if err := os.MkdirAll(filepath.Join(".venv", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".venv", "pyvenv.cfg"), []byte("version = 3.12.1\n"), 0644); err != nil {
+		t.Fatalf("failed to write pyvenv.cfg: %v", err)
+	}
+
+	// the fake interpreter records every run next to the venv
+	runs, _ := filepath.Abs("runs")
+	script := "#!/bin/sh\necho run >> " + runs + "\necho '{\"sys_platform\": \"linux\", \"python_version\": \"3.12\"}'\n"
+	if err := os.WriteFile(filepath.Join(".venv", "bin", "python"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write the fake interpreter: %v", err)
+	}
+
+	expected := markerEnvironment{"sys_platform": "linux", "python_version": "3.12"}
+	for i := 0; i < 2; i++ {
+		env, err := getMarkerEnvironment()
+		if err != nil {
+			t.Fatalf("getMarkerEnvironment failed: %v", err)
+		}
+		if !reflect.DeepEqual(env, expected) {
+			t.Errorf("expected %v, received %v", expected, env)
+		}
+	}
+
+	data, _ := os.ReadFile(runs)
+	if count := strings.Count(string(data), "run"); count != 1 {
+		t.Errorf("expected the interpreter to run once, ran %d times", count)
+	}
+}
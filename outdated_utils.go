@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// number of projects looked up on the package index at the same time
+const indexConcurrency = 8
+
+// a declared requirement compared with the releases on the package index
+type outdatedPackage struct {
+	Name             string `json:"name"`
+	Specifier        string `json:"specifier,omitempty"`         // as declared, empty when any version is accepted
+	Installed        string `json:"installed,omitempty"`         // empty when the package is not installed
+	Locked           string `json:"locked,omitempty"`            // version recorded in pvm.lock
+	LatestCompatible string `json:"latest_compatible,omitempty"` // newest release the specifier accepts
+	Latest           string `json:"latest,omitempty"`            // newest release
+	Prerelease       string `json:"prerelease,omitempty"`        // newest pre-release, when newer than the latest release
+	Error            string `json:"error,omitempty"`             // why the package could not be checked
+}
+
+// returns the version the project currently uses: the installed one,
+// otherwise the locked one, otherwise the one pinned with ==
+func (p outdatedPackage) current() string {
+	if p.Installed != "" {
+		return p.Installed
+	}
+	if p.Locked != "" {
+		return p.Locked
+	}
+	if pinned, found := strings.CutPrefix(p.Specifier, "=="); found && !strings.ContainsAny(pinned, ",*") {
+		return pinned
+	}
+	return ""
+}
+
+// returns true if a newer release than the current version exists
+func (p outdatedPackage) outdated() bool {
+	if p.Latest == "" {
+		return false
+	}
+	current, err := pep440.Parse(p.current())
+	if err != nil {
+		return true
+	}
+	latest, err := pep440.Parse(p.Latest)
+	return err == nil && latest.Compare(current) > 0
+}
+
+// compares the requirement with the versions available on the index,
+// newest first
+func compareWithReleases(req requirement, versions []pep440.Version, installed string, locked string) (outdatedPackage, error) {
+	pkg := outdatedPackage{Name: req.key(), Specifier: req.Specifier, Installed: installed, Locked: locked}
+
+	// pre-releases count as latest when the project already uses one
+	usesPrerelease := false
+	if current, err := pep440.Parse(pkg.current()); err == nil && current.IsPrerelease() {
+		usesPrerelease = true
+	}
+
+	if latest, found, err := newestAllowedVersion(versions, "", usesPrerelease); err != nil {
+		return pkg, err
+	} else if found {
+		pkg.Latest = latest.String()
+	}
+
+	if compatible, found, err := newestAllowedVersion(versions, req.Specifier, usesPrerelease); err != nil {
+		return pkg, err
+	} else if found {
+		pkg.LatestCompatible = compatible.String()
+	}
+
+	if len(versions) > 0 && versions[0].IsPrerelease() && versions[0].String() != pkg.Latest {
+		pkg.Prerelease = versions[0].String()
+	}
+
+	return pkg, nil
+}
+
+// returns the newest of the versions the specifier allows, leaving out
+// pre-releases unless prereleases is set or the specifier selects them
+// returns false when no version is allowed
+func newestAllowedVersion(versions []pep440.Version, specifier string, prereleases bool) (pep440.Version, bool, error) {
+	set, err := pep440.ParseSpecifierSet(specifier)
+	if err != nil {
+		return pep440.Version{}, false, err
+	}
+
+	allowed := set.Filter(versions, prereleases)
+	if len(allowed) == 0 {
+		return pep440.Version{}, false, nil
+	}
+	return slices.MaxFunc(allowed, pep440.Version.Compare), true, nil
+}
+
+// looks the projects up on the package indexes, a few at a time
+// returns the versions of every project found, newest first, and
+// the errors of the projects that could not be looked up
+func fetchVersionsOfProjects(indexes []*packageIndex, names []string) (map[string][]pep440.Version, map[string]error) {
+	versions := make(map[string][]pep440.Version)
+	failures := make(map[string]error)
+
+	var mutex sync.Mutex
+	var group sync.WaitGroup
+	slots := make(chan struct{}, indexConcurrency)
+
+	for _, name := range names {
+		group.Add(1)
+		go func(name string) {
+			defer group.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			found, err := fetchProjectVersions(indexes, name)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				failures[name] = err
+			} else {
+				versions[name] = found
+			}
+		}(name)
+	}
+	group.Wait()
+
+	return versions, failures
+}
+
+// compares the requirements with the releases on the package indexes
+// requirements installed from a url are left out, they are not on an index
+func checkOutdatedRequirements(indexes []*packageIndex, requirements []requirement, installed map[string]string, locked map[string]string) ([]outdatedPackage, error) {
+	var checked []requirement
+	var names []string
+	for _, req := range requirements {
+		if req.URL != "" || slices.Contains(names, req.key()) {
+			continue
+		}
+		checked = append(checked, req)
+		names = append(names, req.key())
+	}
+
+	versions, failures := fetchVersionsOfProjects(indexes, names)
+
+	packages := make([]outdatedPackage, 0, len(checked))
+	for _, req := range checked {
+		if err, failed := failures[req.key()]; failed {
+			packages = append(packages, outdatedPackage{
+				Name:      req.key(),
+				Specifier: req.Specifier,
+				Installed: installed[req.key()],
+				Locked:    locked[req.key()],
+				Error:     err.Error(),
+			})
+			continue
+		}
+
+		pkg, err := compareWithReleases(req, versions[req.key()], installed[req.key()], locked[req.key()])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", req.Name, err)
+		}
+		packages = append(packages, pkg)
+	}
+
+	slices.SortFunc(packages, func(a, b outdatedPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return packages, nil
+}
+
+// compares every requirement the project declares with the releases
+// on the configured package indexes
+func checkOutdatedPackages() ([]outdatedPackage, error) {
+	groups, err := getDeclaredGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var requirements []requirement
+	for _, group := range groups {
+		requirements = append(requirements, group...)
+	}
+
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist.Version
+	}
+
+	locked := make(map[string]string)
+	if lockPath, err := getFilePath(lockFileName); err == nil && lockPath != "" {
+		lock, err := readLockFile()
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range lock.Packages {
+			locked[normalizeName(pkg.Name)] = pkg.Version
+		}
+	}
+
+	indexes, err := getPackageIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkOutdatedRequirements(indexes, requirements, installed, locked)
+}
+
+// writes the packages as a table, or as JSON when asJSON is set
+func writeOutdatedPackages(w io.Writer, packages []outdatedPackage, asJSON bool) error {
+	if asJSON {
+		if packages == nil {
+			packages = []outdatedPackage{}
+		}
+		return writeJSON(w, packages)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Package\tSpecifier\tCurrent\tCompatible\tLatest\tPre-release")
+
+	for _, pkg := range packages {
+		specifier := pkg.Specifier
+		if specifier == "" {
+			specifier = "any"
+		}
+		current := pkg.current()
+		if current == "" {
+			current = "-"
+		}
+
+		if pkg.Error != "" {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", pkg.Name, specifier, current, pkg.Error)
+			continue
+		}
+		prerelease := pkg.Prerelease
+		if prerelease == "" {
+			prerelease = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", pkg.Name, specifier, current, pkg.LatestCompatible, pkg.Latest, prerelease)
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// starts a package index serving the files of the projects, as JSON
+// to clients asking for it and as HTML otherwise
+func setupTestIndex(t *testing.T, projects map[string][]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/simple/"), "/")
+		files, found := projects[name]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "application/vnd.pypi.simple.v1+json") {
+			w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
+			var entries []string
+			for _, file := range files {
+				filename, yanked := strings.CutSuffix(file, " yanked")
+				entries = append(entries, fmt.Sprintf(`{"filename": %q, "url": "/files/%s", "hashes": {}, "yanked": %v}`, filename, filename, yanked))
+			}
+			fmt.Fprintf(w, `{"meta": {"api-version": "1.0"}, "name": %q, "files": [%s]}`, name, strings.Join(entries, ","))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		for _, file := range files {
+			filename, yanked := strings.CutSuffix(file, " yanked")
+			attribute := ""
+			if yanked {
+				attribute = ` data-yanked=""`
+			}
+			fmt.Fprintf(w, "<a href=\"/files/%s\"%s>%s</a>\n", filename, attribute, filename)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckOutdatedRequirements(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	server := setupTestIndex(t, map[string][]string{
+		"requests":   {"requests-2.31.0.tar.gz", "requests-2.32.3-py3-none-any.whl", "requests-3.0.0b1.tar.gz"},
+		"django":     {"Django-4.2.16.tar.gz", "Django-5.1.2-py3-none-any.whl", "Django-5.2-py3-none-any.whl yanked"},
+		"pytest":     {"pytest-8.3.3.tar.gz"},
+		"black-beta": {"black_beta-1.0b2.tar.gz", "black_beta-1.0b3.tar.gz"},
+	})
+
+	if err := os.WriteFile("pvm.toml", []byte("index-url = \""+server.URL+"/simple/\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	indexes, err := getPackageIndexes()
+	if err != nil {
+		t.Fatalf("getPackageIndexes failed: %v", err)
+	}
+
+	requirements := []requirement{
+		{Name: "Requests", Specifier: ">=2.0,<3"},
+		{Name: "django", Specifier: "~=4.2"},
+		{Name: "pytest"},
+		{Name: "black-beta"},
+		{Name: "ghost"},
+		{Name: "local", URL: "file:///src/local"},
+		{Name: "requests", Specifier: ">=2.0,<3"},
+	}
+	installed := map[string]string{"requests": "2.31.0", "pytest": "8.3.3", "black-beta": "1.0b2"}
+	locked := map[string]string{"django": "4.2.16"}
+
+	packages, err := checkOutdatedRequirements(indexes, requirements, installed, locked)
+	if err != nil {
+		t.Fatalf("checkOutdatedRequirements failed: %v", err)
+	}
+
+	expected := []outdatedPackage{
+		{Name: "black-beta", Installed: "1.0b2", LatestCompatible: "1.0b3", Latest: "1.0b3"},
+		{Name: "django", Specifier: "~=4.2", Locked: "4.2.16", LatestCompatible: "4.2.16", Latest: "5.1.2"},
+		{Name: "ghost", Error: "ghost was not found on the package index"},
+		{Name: "pytest", Installed: "8.3.3", LatestCompatible: "8.3.3", Latest: "8.3.3"},
+		{Name: "requests", Specifier: ">=2.0,<3", Installed: "2.31.0", LatestCompatible: "2.32.3", Latest: "2.32.3", Prerelease: "3.0.0b1"},
+	}
+	if fmt.Sprintf("%+v", packages) != fmt.Sprintf("%+v", expected) {
+		t.Errorf("expected %+v\nreceived %+v", expected, packages)
+	}
+
+	var outdated []string
+	for _, pkg := range packages {
+		if pkg.outdated() {
+			outdated = append(outdated, pkg.Name)
+		}
+	}
+	if strings.Join(outdated, ",") != "black-beta,django,requests" {
+		t.Errorf("unexpected outdated packages %v", outdated)
+	}
+
+	// the HTML form of the project page gives the same versions
+	files, err := (&packageIndex{URL: server.URL + "/simple", client: http.DefaultClient}).projectFiles("Django")
+	if err != nil || len(files) != 3 || !files[2].Yanked {
+		t.Errorf("unexpected files %+v, %v", files, err)
+	}
+}
+
+func TestWriteOutdatedPackages(t *testing.T) {
+	packages := []outdatedPackage{
+		{Name: "django", Specifier: "~=4.2", Locked: "4.2.16", LatestCompatible: "4.2.16", Latest: "5.1.2"},
+		{Name: "flask", Specifier: "==3.0.0", LatestCompatible: "3.0.0", Latest: "3.0.3"},
+		{Name: "ghost", Error: "ghost was not found on the package index"},
+	}
+
+	var output bytes.Buffer
+	if err := writeOutdatedPackages(&output, packages, false); err != nil {
+		t.Fatalf("writeOutdatedPackages failed: %v", err)
+	}
+
+	expected := `Package  Specifier  Current  Compatible  Latest  Pre-release
+django   ~=4.2      4.2.16   4.2.16      5.1.2   -
+flask    ==3.0.0    3.0.0    3.0.0       3.0.3   -
+ghost    any        -        ghost was not found on the package index
+`
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\nreceived:\n%s", expected, output.String())
+	}
+
+	output.Reset()
+	if err := writeOutdatedPackages(&output, nil, true); err != nil || strings.TrimSpace(output.String()) != "[]" {
+		t.Errorf("expected an empty JSON list, received %q, %v", output.String(), err)
+	}
+}
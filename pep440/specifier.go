@@ -0,0 +1,243 @@
+package pep440
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Specifier is a single version clause such as >=1.0 or ==2.*.
+type Specifier struct {
+	Operator string // one of ~=, ==, !=, <=, >=, <, > and ===
+	Version  string // version as written, including the .* of prefix matches
+
+	version  Version // parsed version, unused for ===
+	wildcard bool    // true for ==X.* and !=X.*
+}
+
+// SpecifierSet is a comma separated list of specifiers a version has
+// to match all of. The empty set matches every final release.
+type SpecifierSet []Specifier
+
+var operators = []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">"}
+
+// ParseSpecifier parses a single specifier clause, rejecting the
+// combinations PEP 440 does not allow.
+func ParseSpecifier(text string) (Specifier, error) {
+	text = strings.TrimSpace(text)
+
+	var spec Specifier
+	for _, operator := range operators {
+		if rest, found := strings.CutPrefix(text, operator); found {
+			spec.Operator, spec.Version = operator, strings.TrimSpace(rest)
+			break
+		}
+	}
+	if spec.Operator == "" || spec.Version == "" {
+		return Specifier{}, fmt.Errorf("invalid specifier %q", text)
+	}
+
+	// arbitrary equality compares strings, the version does not have to be valid
+	if spec.Operator == "===" {
+		if strings.ContainsAny(spec.Version, " \t;") {
+			return Specifier{}, fmt.Errorf("invalid specifier %q", text)
+		}
+		return spec, nil
+	}
+
+	versionText, wildcard := strings.CutSuffix(spec.Version, ".*")
+	version, err := Parse(versionText)
+	if err != nil || strings.HasPrefix(strings.ToLower(versionText), "v") {
+		return Specifier{}, fmt.Errorf("invalid specifier %q", text)
+	}
+	spec.version, spec.wildcard = version, wildcard
+
+	switch {
+	case wildcard && spec.Operator != "==" && spec.Operator != "!=":
+		return Specifier{}, fmt.Errorf("invalid specifier %q, only == and != allow a .* suffix", text)
+	case wildcard && (version.PrePhase != "" || version.Post >= 0 || version.Dev >= 0 || version.Local != ""):
+		return Specifier{}, fmt.Errorf("invalid specifier %q, a .* suffix has to follow the release segments", text)
+	case version.Local != "" && spec.Operator != "==" && spec.Operator != "!=":
+		return Specifier{}, fmt.Errorf("invalid specifier %q, only == and != allow a local version", text)
+	case spec.Operator == "~=" && len(version.Release) < 2:
+		return Specifier{}, fmt.Errorf("invalid specifier %q, ~= needs at least two release segments", text)
+	}
+
+	return spec, nil
+}
+
+// ParseSpecifierSet parses comma separated specifiers, ignoring empty
+// clauses like packaging does.
+func ParseSpecifierSet(text string) (SpecifierSet, error) {
+	var set SpecifierSet
+	for _, clause := range strings.Split(text, ",") {
+		if strings.TrimSpace(clause) == "" {
+			continue
+		}
+		spec, err := ParseSpecifier(clause)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, spec)
+	}
+	return set, nil
+}
+
+// String returns the specifier without whitespace.
+func (s Specifier) String() string {
+	return s.Operator + s.Version
+}
+
+// IsWildcard reports whether the specifier is a prefix match such as ==1.4.*.
+func (s Specifier) IsWildcard() bool {
+	return s.wildcard
+}
+
+// Prereleases reports whether the specifier selects pre-releases by
+// itself, which inclusive specifiers naming a pre-release do.
+func (s Specifier) Prereleases() bool {
+	switch s.Operator {
+	case "==", ">=", "<=", "~=":
+		return s.version.IsPrerelease()
+	case "===":
+		version, err := Parse(s.Version)
+		return err == nil && version.IsPrerelease()
+	}
+	return false
+}
+
+// Contains reports whether the version matches the specifier.
+// Pre-releases only match when prereleases is set or the specifier
+// selects them by itself.
+func (s Specifier) Contains(v Version, prereleases bool) bool {
+	if v.IsPrerelease() && !prereleases && !s.Prereleases() {
+		return false
+	}
+	return s.matches(v)
+}
+
+// returns true if the version matches the operator of the specifier,
+// regardless of whether it is a pre-release
+func (s Specifier) matches(v Version) bool {
+	spec := s.version
+
+	switch s.Operator {
+	case "===":
+		return strings.EqualFold(v.String(), s.Version)
+	case "==":
+		return s.equal(v)
+	case "!=":
+		return !s.equal(v)
+	case "<=":
+		return v.Public().Compare(spec) <= 0
+	case ">=":
+		return v.Public().Compare(spec) >= 0
+	case "<":
+		if v.Compare(spec) >= 0 {
+			return false
+		}
+		// <3.1 does not match the pre-releases of 3.1 unless it names one itself
+		return spec.IsPrerelease() || !v.IsPrerelease() || !v.Base().Equal(spec.Base())
+	case ">":
+		if v.Compare(spec) <= 0 {
+			return false
+		}
+		// >3.1 does not match the post-releases of 3.1 unless it names one itself
+		if !spec.IsPostrelease() && v.IsPostrelease() && v.Base().Equal(spec.Base()) {
+			return false
+		}
+		// nor local versions of 3.1, which sort after it
+		return v.Local == "" || !v.Base().Equal(spec.Base())
+	case "~=":
+		// ~=2.2.1 is >=2.2.1 together with ==2.2.*
+		prefix := spec.Base()
+		prefix.Release = spec.Release[:len(spec.Release)-1]
+		return v.Public().Compare(spec) >= 0 && prefixMatches(v, prefix)
+	}
+
+	return false
+}
+
+// returns true if the version equals the version of an == or != specifier
+func (s Specifier) equal(v Version) bool {
+	if s.wildcard {
+		return prefixMatches(v, s.version)
+	}
+	// versions match any local version unless the specifier names one
+	if s.version.Local == "" {
+		v = v.Public()
+	}
+	return v.Compare(s.version) == 0
+}
+
+// returns true if the epoch and release of the version start with
+// the release of the prefix, padding the version with zeros
+func prefixMatches(v Version, prefix Version) bool {
+	if v.Epoch != prefix.Epoch {
+		return false
+	}
+	release := v.Release
+	if len(release) > len(prefix.Release) {
+		release = release[:len(prefix.Release)]
+	}
+	return compareReleases(release, prefix.Release) == 0
+}
+
+// String returns the specifiers joined by commas.
+func (s SpecifierSet) String() string {
+	clauses := make([]string, len(s))
+	for i, spec := range s {
+		clauses[i] = spec.String()
+	}
+	return strings.Join(clauses, ",")
+}
+
+// Prereleases reports whether a specifier of the set selects pre-releases.
+func (s SpecifierSet) Prereleases() bool {
+	for _, spec := range s {
+		if spec.Prereleases() {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the version matches every specifier of the set.
+// Pre-releases only match when prereleases is set or a specifier of the
+// set selects them.
+func (s SpecifierSet) Contains(v Version, prereleases bool) bool {
+	if v.IsPrerelease() && !prereleases && !s.Prereleases() {
+		return false
+	}
+	for _, spec := range s {
+		if !spec.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the versions the set contains, keeping their order.
+// Pre-releases are kept when prereleases is set or a specifier of the set
+// selects them. When no final release matches, the matching pre-releases
+// are returned instead, like packaging and pip do for a project that only
+// has pre-releases in the range.
+func (s SpecifierSet) Filter(versions []Version, prereleases bool) []Version {
+	allowed := prereleases || s.Prereleases()
+
+	var filtered, found []Version
+	for _, v := range versions {
+		if !s.Contains(v, true) {
+			continue
+		}
+		if v.IsPrerelease() && !allowed {
+			found = append(found, v)
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+
+	if len(filtered) == 0 {
+		return found
+	}
+	return filtered
+}
@@ -0,0 +1,342 @@
+package pep440
+
+import (
+	"slices"
+	"testing"
+)
+
+// expected results computed with the packaging library, with and without
+// pre-releases allowed, mostly from the test suite of packaging
+// prefix matches pad the version before cutting it and compare the epoch
+// like packaging does since version 22, older releases got the ==2.0.*,
+// !=2.0.*, ==0!2.* and ~=2022.01.01 cases wrong
+func TestSpecifierContains(t *testing.T) {
+	tests := []struct {
+		specifier   string
+		version     string
+		prereleases bool // result when pre-releases are allowed
+		expected    bool // result when the specifier decides
+	}{
+		{"==2", "2.0", true, true},
+		{"==2.0", "2.0", true, true},
+		{"==2.0.0", "2.0", true, true},
+		{"==2", "2.0+deadbeef", true, true},
+		{"==2.0", "2.0+deadbeef", true, true},
+		{"==2.0.0", "2.0+deadbeef", true, true},
+		{"==2+deadbeef", "2.0+deadbeef", true, true},
+		{"==2.0+deadbeef", "2.0+deadbeef", true, true},
+		{"==2.0.0+deadbeef", "2.0+deadbeef", true, true},
+		{"==2.0.0+deadbeef.00", "2.0+deadbeef.0", true, true},
+		{"==2.*", "2.dev1", true, false},
+		{"==2.*", "2a1", true, false},
+		{"==2.*", "2a1.post1", true, false},
+		{"==2.*", "2b1", true, false},
+		{"==2.*", "2b1.dev1", true, false},
+		{"==2.*", "2c1", true, false},
+		{"==2.*", "2c1.post1.dev1", true, false},
+		{"==2.0.*", "2c1.post1.dev1", true, false},
+		{"==2.*", "2rc1", true, false},
+		{"==2.0.*", "2rc1", true, false},
+		{"==2.*", "2", true, true},
+		{"==2.0.*", "2", true, true},
+		{"==0!2.*", "2", true, true},
+		{"==2.*", "0!2", true, true},
+		{"==2.*", "2.0", true, true},
+		{"==2.*", "2.0.0", true, true},
+		{"==2.1.*", "2.1+local.version", true, true},
+		{"!=2", "2.1", true, true},
+		{"!=2.0", "2.1", true, true},
+		{"!=2", "2.0.1", true, true},
+		{"!=2.0", "2.0.1", true, true},
+		{"!=2.0.0", "2.0.1", true, true},
+		{"!=2.0+deadbeef", "2.0", true, true},
+		{"!=3.*", "2.0", true, true},
+		{"!=2.0.*", "2.1", true, true},
+		{">=2", "2.0", true, true},
+		{">=2.0", "2.0", true, true},
+		{">=2.0.0", "2.0", true, true},
+		{">=2", "2.0.post1", true, true},
+		{">=2", "2.0.post1.dev1", true, false},
+		{">=2", "3", true, true},
+		{"<=2", "2.0", true, true},
+		{"<=2.0", "2.0", true, true},
+		{"<=2.0.0", "2.0", true, true},
+		{"<=2", "2.0.dev1", true, false},
+		{"<=2", "2.0a1", true, false},
+		{"<=2", "2.0a1.dev1", true, false},
+		{"<=2", "2.0b1", true, false},
+		{"<=2", "2.0b1.post1", true, false},
+		{"<=2", "2.0c1", true, false},
+		{"<=2", "2.0c1.post1.dev1", true, false},
+		{"<=2", "2.0rc1", true, false},
+		{"<=2", "1", true, true},
+		{">2", "3", true, true},
+		{">2.0", "2.1", true, true},
+		{">2", "2.0.1", true, true},
+		{">2", "2.1.post1", true, true},
+		{">2", "2.1+local.version", true, true},
+		{"<2", "1", true, true},
+		{"<2.1", "2.0", true, true},
+		{"<2.1", "2.0.dev0", true, false},
+		{"~=1.0", "1", true, true},
+		{"~=1.0", "1.0.1", true, true},
+		{"~=1.0", "1.1", true, true},
+		{"~=1.0", "1.9999999", true, true},
+		{"~=1.0a1", "1.1", true, true},
+		{"~=2022.01.01", "2022.01.01", true, true},
+		{"~=2!1.0", "2!1.0", true, true},
+		{"==2!1.*", "2!1.0", true, true},
+		{"==2!1.0", "2!1.0", true, true},
+		{"!=1.0", "2!1.0", true, true},
+		{"!=2!1.0", "1.0", true, true},
+		{"<=2!0.1", "1.0", true, true},
+		{">=2.0", "2!1.0", true, true},
+		{"<2!0.1", "1.0", true, true},
+		{">2.0", "2!1.0", true, true},
+		{">2.0dev", "2.0.5", true, true},
+		{"==2", "2.1", false, false},
+		{"==2.0", "2.1", false, false},
+		{"==2.0.0", "2.1", false, false},
+		{"==2.0+deadbeef", "2.0", false, false},
+		{"==3.*", "2.0", false, false},
+		{"==2.0.*", "2.1", false, false},
+		{"!=2", "2.0", false, false},
+		{"!=2.0", "2.0", false, false},
+		{"!=2.0.0", "2.0", false, false},
+		{"!=2", "2.0+deadbeef", false, false},
+		{"!=2.0", "2.0+deadbeef", false, false},
+		{"!=2.0.0", "2.0+deadbeef", false, false},
+		{"!=2+deadbeef", "2.0+deadbeef", false, false},
+		{"!=2.0+deadbeef", "2.0+deadbeef", false, false},
+		{"!=2.0.0+deadbeef", "2.0+deadbeef", false, false},
+		{"!=2.0.0+deadbeef.00", "2.0+deadbeef.0", false, false},
+		{"!=2.*", "2.dev1", false, false},
+		{"!=2.*", "2a1", false, false},
+		{"!=2.*", "2a1.post1", false, false},
+		{"!=2.*", "2b1", false, false},
+		{"!=2.*", "2b1.dev1", false, false},
+		{"!=2.*", "2c1", false, false},
+		{"!=2.*", "2c1.post1.dev1", false, false},
+		{"!=2.0.*", "2c1.post1.dev1", false, false},
+		{"!=2.*", "2rc1", false, false},
+		{"!=2.0.*", "2rc1", false, false},
+		{"!=2.*", "2", false, false},
+		{"!=2.0.*", "2", false, false},
+		{"!=2.*", "2.0", false, false},
+		{"!=2.*", "2.0.0", false, false},
+		{">=2", "2.0.dev1", false, false},
+		{">=2", "2.0a1", false, false},
+		{">=2", "2.0a1.dev1", false, false},
+		{">=2", "2.0b1", false, false},
+		{">=2", "2.0b1.post1", false, false},
+		{">=2", "2.0c1", false, false},
+		{">=2", "2.0c1.post1.dev1", false, false},
+		{">=2", "2.0rc1", false, false},
+		{">=2", "1", false, false},
+		{"<=2", "2.0.post1", false, false},
+		{"<=2", "2.0.post1.dev1", false, false},
+		{"<=2", "3", false, false},
+		{">2", "1", false, false},
+		{">2", "2.0.dev1", false, false},
+		{">2", "2.0a1", false, false},
+		{">2", "2.0a1.post1", false, false},
+		{">2", "2.0b1", false, false},
+		{">2", "2.0b1.dev1", false, false},
+		{">2", "2.0c1", false, false},
+		{">2", "2.0c1.post1.dev1", false, false},
+		{">2", "2.0rc1", false, false},
+		{">2", "2.0", false, false},
+		{">2", "2.0.post1", false, false},
+		{">2", "2.0.post1.dev1", false, false},
+		{">2", "2.0+local.version", false, false},
+		{"<2", "2.0.dev1", false, false},
+		{"<2", "2.0a1", false, false},
+		{"<2", "2.0a1.post1", false, false},
+		{"<2", "2.0b1", false, false},
+		{"<2", "2.0b2.dev1", false, false},
+		{"<2", "2.0c1", false, false},
+		{"<2", "2.0c1.post1.dev1", false, false},
+		{"<2", "2.0rc1", false, false},
+		{"<2", "2.0", false, false},
+		{"<2", "2.post1", false, false},
+		{"<2", "2.post1.dev1", false, false},
+		{"<2", "3", false, false},
+		{"~=1.0", "2.0", false, false},
+		{"~=1.0.0", "1.1.0", false, false},
+		{"~=1.0.0", "1.1.post1", false, false},
+		{"~=2!1.0", "1.0", false, false},
+		{"~=1.0", "2!1.0", false, false},
+		{"==1.0", "2!1.0", false, false},
+		{"==2!1.0", "1.0", false, false},
+		{"==1.*", "2!1.0", false, false},
+		{"==2!1.*", "1.0", false, false},
+		{"!=2!1.0", "2!1.0", false, false},
+		{">1.0.post0", "1.0.post1+local", false, false},
+		{"===1.0", "1.0", true, true},
+		{"===1.0", "1.0.0", false, false},
+		{"===1.0+local", "1.0+Local", true, true},
+	}
+
+	for _, test := range tests {
+		spec, err := ParseSpecifier(test.specifier)
+		if err != nil {
+			t.Errorf("ParseSpecifier(%q) failed: %v", test.specifier, err)
+			continue
+		}
+		version := MustParse(test.version)
+
+		if received := spec.Contains(version, true); received != test.prereleases {
+			t.Errorf("%q contains %s with pre-releases: expected %v, received %v", test.specifier, test.version, test.prereleases, received)
+		}
+		if received := spec.Contains(version, false); received != test.expected {
+			t.Errorf("%q contains %s: expected %v, received %v", test.specifier, test.version, test.expected, received)
+		}
+	}
+}
+
+func TestSpecifierPrereleases(t *testing.T) {
+	tests := []struct {
+		specifier   string
+		prereleases bool
+	}{
+		{">=1.0", false},
+		{">=1.0.dev0", true},
+		{">=1.0a1", true},
+		{">=1.0rc1", true},
+		{"==1.0.*", false},
+		{"==1.0a1", true},
+		{"!=1.0a1", false},
+		{"<=2.0b1", true},
+		{"~=1.0b1", true},
+		{"<1.0a1", false},
+		{">1.0a1", false},
+		{"===1.0a1", true},
+		{"===foo", false},
+	}
+
+	for _, test := range tests {
+		spec, err := ParseSpecifier(test.specifier)
+		if err != nil {
+			t.Fatalf("ParseSpecifier(%q) failed: %v", test.specifier, err)
+		}
+		if spec.Prereleases() != test.prereleases {
+			t.Errorf("%q selects pre-releases: expected %v, received %v", test.specifier, test.prereleases, spec.Prereleases())
+		}
+	}
+}
+
+func TestInvalidSpecifiers(t *testing.T) {
+	for _, text := range []string{
+		"", "1.0", "=>1.0", "==", ">=1.0.*", "~=1.*", "~=1", "~=1.0+local", ">=1.0+local",
+		"==1.0a1.*", "==1.0.post1.*", "==1.0+local.*", ">=v1.0", "==1.0 dev", "===foo bar", ">=french toast",
+	} {
+		if spec, err := ParseSpecifier(text); err == nil {
+			t.Errorf("expected %q to be invalid, received %+v", text, spec)
+		}
+	}
+
+	for _, text := range []string{"===foo", "==1.0+local", "!=1.0+local", "!=2.*", ">= 1.0", "~=1.0.post1", "~=2!1.0"} {
+		if _, err := ParseSpecifier(text); err != nil {
+			t.Errorf("expected %q to be valid: %v", text, err)
+		}
+	}
+}
+
+func TestParseSpecifierSet(t *testing.T) {
+	set, err := ParseSpecifierSet(" >= 1.0 , != 1.5.* ,, <2 ")
+	if err != nil {
+		t.Fatalf("ParseSpecifierSet failed: %v", err)
+	}
+	if set.String() != ">=1.0,!=1.5.*,<2" || !set[1].IsWildcard() || set[0].IsWildcard() {
+		t.Errorf("unexpected specifier set %q", set.String())
+	}
+
+	if set, err := ParseSpecifierSet(""); err != nil || len(set) != 0 {
+		t.Errorf("expected an empty set, received %v, %v", set, err)
+	}
+	if _, err := ParseSpecifierSet(">=1.0,2.0"); err == nil {
+		t.Errorf("expected a clause without an operator to fail")
+	}
+}
+
+func TestSpecifierSetContains(t *testing.T) {
+	tests := []struct {
+		specifier   string
+		version     string
+		prereleases bool // result when pre-releases are allowed
+		expected    bool // result when the specifiers decide
+	}{
+		{"", "1.0", true, true},
+		{"", "1.0a1", true, false},
+		{">=1.0", "2.0a1", true, false},
+		{">=1.0a1", "2.0a1", true, true},
+		{">=1.0,<2.0a1", "1.5", true, true},
+		{">=1.0,<2.0a1", "2.0a0", true, false},
+		{">=1.0.dev1,!=1.5", "1.5", false, false},
+		{">=1.0.dev1,!=1.5", "1.5.dev1", true, true},
+		{"~=1.4.5", "1.4.9", true, true},
+		{"~=1.4.5, !=1.4.7", "1.4.7", false, false},
+		{">1.0,<1.0.post1", "1.0.post0", false, false},
+		{"<2,>=1.5", "1.5rc1", false, false},
+	}
+
+	for _, test := range tests {
+		set, err := ParseSpecifierSet(test.specifier)
+		if err != nil {
+			t.Fatalf("ParseSpecifierSet(%q) failed: %v", test.specifier, err)
+		}
+		version := MustParse(test.version)
+
+		if received := set.Contains(version, true); received != test.prereleases {
+			t.Errorf("%q contains %s with pre-releases: expected %v, received %v", test.specifier, test.version, test.prereleases, received)
+		}
+		if received := set.Contains(version, false); received != test.expected {
+			t.Errorf("%q contains %s: expected %v, received %v", test.specifier, test.version, test.expected, received)
+		}
+	}
+}
+
+func TestSpecifierSetFilter(t *testing.T) {
+	tests := []struct {
+		specifier   string
+		versions    []string
+		expected    []string // kept when the specifiers decide
+		prereleases []string // kept when pre-releases are allowed
+	}{
+		{"", []string{"1.0", "2.0a1"}, []string{"1.0"}, []string{"1.0", "2.0a1"}},
+		{"", []string{"1.0a1", "2.0b1"}, []string{"1.0a1", "2.0b1"}, []string{"1.0a1", "2.0b1"}},
+		{"", []string{"1.0", "2.0a1", "0.9rc1"}, []string{"1.0"}, []string{"1.0", "2.0a1", "0.9rc1"}},
+		{">=1.0", []string{"1.0a1", "1.0", "2.0a1", "2.0"}, []string{"1.0", "2.0"}, []string{"1.0", "2.0a1", "2.0"}},
+		{">=1.0", []string{"1.0a1", "2.0a1"}, []string{"2.0a1"}, []string{"2.0a1"}},
+		{">=1.0", []string{"2.0b1"}, []string{"2.0b1"}, []string{"2.0b1"}},
+		{">=3.0", []string{"1.0", "2.0b1"}, []string{}, []string{}},
+		{">=1.0a1", []string{"0.9", "1.0a1", "1.0", "2.0b1"}, []string{"1.0a1", "1.0", "2.0b1"}, []string{"1.0a1", "1.0", "2.0b1"}},
+		{"<2,!=1.5", []string{"1.0", "1.5", "1.9", "2.0", "2.0a1"}, []string{"1.0", "1.9"}, []string{"1.0", "1.9"}},
+	}
+
+	filter := func(set SpecifierSet, texts []string, prereleases bool) []string {
+		var versions []Version
+		for _, text := range texts {
+			versions = append(versions, MustParse(text))
+		}
+		kept := []string{}
+		for _, version := range set.Filter(versions, prereleases) {
+			kept = append(kept, version.String())
+		}
+		return kept
+	}
+
+	for _, test := range tests {
+		set, err := ParseSpecifierSet(test.specifier)
+		if err != nil {
+			t.Fatalf("ParseSpecifierSet(%q) failed: %v", test.specifier, err)
+		}
+
+		if received := filter(set, test.versions, false); !slices.Equal(received, test.expected) {
+			t.Errorf("%q filters %v: expected %v, received %v", test.specifier, test.versions, test.expected, received)
+		}
+		if received := filter(set, test.versions, true); !slices.Equal(received, test.prereleases) {
+			t.Errorf("%q filters %v with pre-releases: expected %v, received %v", test.specifier, test.versions, test.prereleases, received)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package pep440 parses and orders Python package versions and evaluates
+// version specifiers as described by PEP 440, following the behavior of
+// the packaging library pip is built on.
+package pep440
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed PEP 440 version.
+type Version struct {
+	Epoch    int
+	Release  []int
+	PrePhase string // a, b or rc, empty for versions that are not pre-releases
+	Pre      int
+	Post     int    // -1 for versions that are not post-releases
+	Dev      int    // -1 for versions that are not development releases
+	Local    string // local version label without the +, normalized to dots and lower case
+}
+
+// the version scheme of PEP 440, accepting the spellings the
+// specification normalizes
+var versionRegex = regexp.MustCompile(`(?i)^v?` +
+	`(?:(\d+)!)?` +
+	`(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?(\d+)?)?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d+)?)?` +
+	`(?:[-_.]?(dev)[-_.]?(\d+)?)?` +
+	`(?:\+([a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// Parse parses a version, accepting every spelling PEP 440 normalizes.
+func Parse(text string) (Version, error) {
+	match := versionRegex.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return Version{}, fmt.Errorf("invalid version %q", text)
+	}
+
+	var numberErr error
+	number := func(digits string) int {
+		if digits == "" {
+			return 0
+		}
+		value, err := strconv.Atoi(digits)
+		if err != nil {
+			numberErr = fmt.Errorf("invalid version %q: %s is too large", text, digits)
+		}
+		return value
+	}
+
+	version := Version{Epoch: number(match[1]), Post: -1, Dev: -1}
+
+	for _, segment := range strings.Split(match[2], ".") {
+		version.Release = append(version.Release, number(segment))
+	}
+
+	if match[3] != "" {
+		switch strings.ToLower(match[3]) {
+		case "a", "alpha":
+			version.PrePhase = "a"
+		case "b", "beta":
+			version.PrePhase = "b"
+		default:
+			version.PrePhase = "rc"
+		}
+		version.Pre = number(match[4])
+	}
+
+	switch {
+	case match[5] != "":
+		version.Post = number(match[5])
+	case match[6] != "":
+		version.Post = number(match[7])
+	}
+
+	if match[8] != "" {
+		version.Dev = number(match[9])
+	}
+
+	version.Local = strings.ToLower(strings.NewReplacer("-", ".", "_", ".").Replace(match[10]))
+
+	return version, numberErr
+}
+
+// MustParse is like Parse but panics when the version is invalid.
+func MustParse(text string) Version {
+	version, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return version
+}
+
+// String returns the normalized form of the version.
+func (v Version) String() string {
+	var text strings.Builder
+
+	if v.Epoch != 0 {
+		fmt.Fprintf(&text, "%d!", v.Epoch)
+	}
+
+	release := make([]string, len(v.Release))
+	for i, segment := range v.Release {
+		release[i] = strconv.Itoa(segment)
+	}
+	text.WriteString(strings.Join(release, "."))
+
+	if v.PrePhase != "" {
+		fmt.Fprintf(&text, "%s%d", v.PrePhase, v.Pre)
+	}
+	if v.Post >= 0 {
+		fmt.Fprintf(&text, ".post%d", v.Post)
+	}
+	if v.Dev >= 0 {
+		fmt.Fprintf(&text, ".dev%d", v.Dev)
+	}
+	if v.Local != "" {
+		text.WriteString("+" + v.Local)
+	}
+
+	return text.String()
+}
+
+// IsPrerelease reports whether the version is a pre-release or a
+// development release.
+func (v Version) IsPrerelease() bool {
+	return v.PrePhase != "" || v.Dev >= 0
+}
+
+// IsPostrelease reports whether the version is a post-release.
+func (v Version) IsPostrelease() bool {
+	return v.Post >= 0
+}
+
+// IsDevrelease reports whether the version is a development release.
+func (v Version) IsDevrelease() bool {
+	return v.Dev >= 0
+}
+
+// Public returns the version without its local label.
+func (v Version) Public() Version {
+	v.Local = ""
+	return v
+}
+
+// Base returns the epoch and release segments of the version only.
+func (v Version) Base() Version {
+	return Version{Epoch: v.Epoch, Release: v.Release, Post: -1, Dev: -1}
+}
+
+// Major returns the first release segment.
+func (v Version) Major() int {
+	return v.segment(0)
+}
+
+// Minor returns the second release segment, zero when there is none.
+func (v Version) Minor() int {
+	return v.segment(1)
+}
+
+// Micro returns the third release segment, zero when there is none.
+func (v Version) Micro() int {
+	return v.segment(2)
+}
+
+func (v Version) segment(index int) int {
+	if index < len(v.Release) {
+		return v.Release[index]
+	}
+	return 0
+}
+
+// compares the release segments, padding the shorter one with zeros
+func compareReleases(a []int, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return compareInts(x, y)
+		}
+	}
+	return 0
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// returns the rank of the pre-release part, development releases of
+// a final release sort before its pre-releases and final releases after
+func (v Version) preRank() (int, int) {
+	switch {
+	case v.PrePhase == "" && v.Post < 0 && v.Dev >= 0:
+		return -1, 0
+	case v.PrePhase == "":
+		return 3, 0
+	}
+	return slices.Index([]string{"a", "b", "rc"}, v.PrePhase), v.Pre
+}
+
+// compares local version labels segment by segment, numeric segments
+// sorting after alphanumeric ones
+func compareLocals(a string, b string) int {
+	if a == "" || b == "" {
+		return compareInts(len(a), len(b))
+	}
+
+	x, y := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(x), len(y)); i++ {
+		m, errM := strconv.Atoi(x[i])
+		n, errN := strconv.Atoi(y[i])
+		switch {
+		case errM == nil && errN == nil:
+			if m != n {
+				return compareInts(m, n)
+			}
+		case errM == nil:
+			return 1
+		case errN == nil:
+			return -1
+		default:
+			if c := strings.Compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(x), len(y))
+}
+
+// Compare returns -1, 0 or 1 when v sorts before, equal to or after other.
+func (v Version) Compare(other Version) int {
+	if c := compareInts(v.Epoch, other.Epoch); c != 0 {
+		return c
+	}
+	if c := compareReleases(v.Release, other.Release); c != 0 {
+		return c
+	}
+
+	phase, pre := v.preRank()
+	otherPhase, otherPre := other.preRank()
+	if c := compareInts(phase, otherPhase); c != 0 {
+		return c
+	}
+	if c := compareInts(pre, otherPre); c != 0 {
+		return c
+	}
+
+	if c := compareInts(v.Post, other.Post); c != 0 {
+		return c
+	}
+
+	// versions without a development part sort after the ones with it
+	dev, otherDev := v.Dev, other.Dev
+	if dev < 0 {
+		dev = math.MaxInt
+	}
+	if otherDev < 0 {
+		otherDev = math.MaxInt
+	}
+	if c := compareInts(dev, otherDev); c != 0 {
+		return c
+	}
+
+	return compareLocals(v.Local, other.Local)
+}
+
+// Equal reports whether both versions sort equal, such as 1.0 and 1.0.0.
+func (v Version) Equal(other Version) bool {
+	return v.Compare(other) == 0
+}
+
+// Sort sorts the versions from the oldest to the newest.
+func Sort(versions []Version) {
+	slices.SortStableFunc(versions, Version.Compare)
+}
@@ -0,0 +1,145 @@
+package pep440
+
+import (
+	"slices"
+	"testing"
+)
+
+// normalized forms as printed by the packaging library
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		text       string
+		normalized string
+	}{
+		{"1.0dev", "1.0.dev0"},
+		{"1.0.dev", "1.0.dev0"},
+		{"1.0dev1", "1.0.dev1"},
+		{"1.0-dev", "1.0.dev0"},
+		{"1.0-dev1", "1.0.dev1"},
+		{"1.0DEV", "1.0.dev0"},
+		{"1.0.DEV1", "1.0.dev1"},
+		{"1.0_dev1", "1.0.dev1"},
+		{"1.0alpha1", "1.0a1"},
+		{"1.0.alpha1", "1.0a1"},
+		{"1.0-a1", "1.0a1"},
+		{"1.0a", "1.0a0"},
+		{"1.0beta1", "1.0b1"},
+		{"1.0-b_2", "1.0b2"},
+		{"1.0c1", "1.0rc1"},
+		{"1.0pre1", "1.0rc1"},
+		{"1.0preview1", "1.0rc1"},
+		{"1.0-rc.1", "1.0rc1"},
+		{"1.0rev1", "1.0.post1"},
+		{"1.0r1", "1.0.post1"},
+		{"1.0-1", "1.0.post1"},
+		{"1.0post", "1.0.post0"},
+		{"1.0.post", "1.0.post0"},
+		{"1.0-post-2", "1.0.post2"},
+		{"1.0+ubuntu-1", "1.0+ubuntu.1"},
+		{"1.0+ubuntu_1", "1.0+ubuntu.1"},
+		{"1.0.0+UBUNTU.1", "1.0.0+ubuntu.1"},
+		{"v1.0", "1.0"},
+		{"  v1.0\t\n", "1.0"},
+		{"1!1.0", "1!1.0"},
+		{"0!1.0", "1.0"},
+		{"01.02.03", "1.2.3"},
+		{"1.0.0a1.post2.dev3+abc.5", "1.0.0a1.post2.dev3+abc.5"},
+		{"2010.1.1", "2010.1.1"},
+	}
+
+	for _, test := range tests {
+		version, err := Parse(test.text)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.text, err)
+			continue
+		}
+		if version.String() != test.normalized {
+			t.Errorf("Parse(%q) = %q, expected %q", test.text, version.String(), test.normalized)
+		}
+		if reparsed := MustParse(version.String()); reparsed.String() != test.normalized {
+			t.Errorf("expected %q to parse to itself, received %q", test.normalized, reparsed.String())
+		}
+	}
+}
+
+func TestParseInvalidVersion(t *testing.T) {
+	for _, text := range []string{
+		"french toast", "1.0+a+", "1.0++", "1.0+_foobar", "1.0+foo&asd", "1.0+1+1", "1.0.", "", "1.0 dev",
+		"1.0-", "1..0", "1.0a1a2", "99999999999999999999999",
+	} {
+		if version, err := Parse(text); err == nil {
+			t.Errorf("expected %q to be invalid, received %s", text, version)
+		}
+	}
+}
+
+// every version sorts after the ones before it, as in the test suite of packaging
+func TestCompareVersions(t *testing.T) {
+	versions := []string{
+		"1.0.dev456", "1.0a1", "1.0a2.dev456", "1.0a12.dev456", "1.0a12", "1.0b1.dev456", "1.0b2",
+		"1.0b2.post345.dev456", "1.0b2.post345", "1.0b2-346", "1.0c1.dev456", "1.0c1", "1.0rc2", "1.0c3",
+		"1.0", "1.0.post456.dev34", "1.0.post456", "1.1.dev1", "1.2+123abc", "1.2+123abc456", "1.2+abc",
+		"1.2+abc123", "1.2+abc123def", "1.2+1234.abc", "1.2+123456", "1.2.r32+123456", "1.2.rev33+123456",
+	}
+	var ordered []string
+	for _, epoch := range []string{"", "1!"} {
+		for _, text := range versions {
+			ordered = append(ordered, epoch+text)
+		}
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			a, b := MustParse(ordered[i]), MustParse(ordered[j])
+			if c := a.Compare(b); c != compareInts(i, j) {
+				t.Errorf("Compare(%s, %s) = %d, expected %d", ordered[i], ordered[j], c, compareInts(i, j))
+			}
+		}
+	}
+
+	shuffled := []Version{MustParse("1.0"), MustParse("1.0a1"), MustParse("0.9"), MustParse("1.0.post1")}
+	Sort(shuffled)
+	var sorted []string
+	for _, version := range shuffled {
+		sorted = append(sorted, version.String())
+	}
+	if !slices.Equal(sorted, []string{"0.9", "1.0a1", "1.0", "1.0.post1"}) {
+		t.Errorf("unexpected order %v", sorted)
+	}
+}
+
+func TestVersionEquality(t *testing.T) {
+	for _, pair := range [][2]string{{"1.0", "1.0.0"}, {"1.0", "1.0.0.0"}, {"1.0a1", "1.0.0alpha1"}, {"0!1.0", "1.0"}, {"1.0+ABC", "1.0+abc"}} {
+		if !MustParse(pair[0]).Equal(MustParse(pair[1])) {
+			t.Errorf("expected %s to equal %s", pair[0], pair[1])
+		}
+	}
+	if MustParse("1.0").Equal(MustParse("1.0+local")) {
+		t.Errorf("expected a local version to differ from its public version")
+	}
+}
+
+func TestVersionParts(t *testing.T) {
+	version := MustParse("2!3.4rc1.post5.dev6+ubuntu.1")
+
+	if version.Epoch != 2 || version.Major() != 3 || version.Minor() != 4 || version.Micro() != 0 {
+		t.Errorf("unexpected release parts of %s", version)
+	}
+	if !version.IsPrerelease() || !version.IsPostrelease() || !version.IsDevrelease() {
+		t.Errorf("expected %s to be a pre-, post- and development release", version)
+	}
+	if version.Public().String() != "2!3.4rc1.post5.dev6" || version.Base().String() != "2!3.4" {
+		t.Errorf("unexpected public %s and base %s versions", version.Public(), version.Base())
+	}
+
+	for _, text := range []string{"1.0", "1.0.post1", "1.0+local"} {
+		if MustParse(text).IsPrerelease() {
+			t.Errorf("expected %s not to be a pre-release", text)
+		}
+	}
+	for _, text := range []string{"1.0a1", "1.0.dev1", "1.0.post1.dev1"} {
+		if !MustParse(text).IsPrerelease() {
+			t.Errorf("expected %s to be a pre-release", text)
+		}
+	}
+}
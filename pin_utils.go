@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// decides which version specifier pvm writes for a newly installed package
+type pinPolicy string
+
+const (
+	pinExact      pinPolicy = "exact"       // ==1.2.3
+	pinCompatible pinPolicy = "compatible"  // ~=1.2.3
+	pinLowerBound pinPolicy = "lower-bound" // >=1.2.3
+	pinNone       pinPolicy = "none"        // no specifier
+
+	defaultPinPolicy = pinExact
+)
+
+// returns the pin policy named by the passed string
+func parsePinPolicy(name string) (pinPolicy, error) {
+	switch policy := pinPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case pinExact, pinCompatible, pinLowerBound, pinNone:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("unknown pin policy %q (expected exact, compatible, lower-bound or none)", name)
+}
+
+// returns the pin policy to use for an install
+// the command line flag wins over the project configuration
+func resolvePinPolicy(flag string) (pinPolicy, error) {
+	if flag != "" {
+		return parsePinPolicy(flag)
+	}
+
+	config, err := loadProjectConfig()
+	if err != nil {
+		return "", err
+	}
+	if config.Pin != "" {
+		return parsePinPolicy(config.Pin)
+	}
+
+	return defaultPinPolicy, nil
+}
+
+// returns the version specifier the policy writes for the passed version
+// versions outside of PEP 440 can only be pinned with ===
+func pinSpecifier(policy pinPolicy, version string) string {
+	if policy == pinNone {
+		return ""
+	}
+
+	parsed, err := pep440.Parse(version)
+	if err != nil {
+		return "===" + version
+	}
+
+	// local version labels are only allowed with ==
+	public := parsed.Public()
+
+	switch policy {
+	case pinExact:
+		return "==" + version
+	case pinCompatible:
+		// ~= needs at least two release segments
+		if len(public.Release) < 2 {
+			public.Release = append(slices.Clone(public.Release), 0)
+		}
+		return "~=" + public.String()
+	case pinLowerBound:
+		return ">=" + public.String()
+	}
+
+	return ""
+}
+
+// adds a version specifier to the passed packages, based on the version
+// installed in the virtual environment and the pin policy
+// packages typed with a specifier or url and packages that are
+// already declared in the manifest section are left as they are
+func pinPackages(packages []string, policy pinPolicy, section dependencySection) ([]string, error) {
+	if policy == pinNone {
+		return packages, nil
+	}
+
+	requirements, err := parseRequirementArgs(packages)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]struct{})
+	current, err := getDeclaredRequirements(section)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range current {
+		declared[req.key()] = struct{}{}
+	}
+
+	needsPin := func(req requirement) bool {
+		_, found := declared[req.key()]
+		return !found && req.Specifier == "" && req.URL == ""
+	}
+
+	var toPin []string
+	for _, req := range requirements {
+		if needsPin(req) {
+			toPin = append(toPin, req.Name)
+		}
+	}
+
+	if len(toPin) == 0 {
+		return packages, nil
+	}
+
+	versions, err := getInstalledPackageVersions(toPin)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := make([]string, 0, len(requirements))
+	for i, req := range requirements {
+		version, found := versions[req.key()]
+		if !found || !needsPin(req) {
+			pinned = append(pinned, packages[i])
+			continue
+		}
+
+		req.Specifier = pinSpecifier(policy, version)
+		pinned = append(pinned, req.String())
+	}
+
+	return pinned, nil
+}
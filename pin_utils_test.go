@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParsePinPolicy(t *testing.T) {
+	for _, name := range []string{"exact", "Compatible", "lower-bound", " none "} {
+		if _, err := parsePinPolicy(name); err != nil {
+			t.Errorf("parsePinPolicy(%q) failed: %v", name, err)
+		}
+	}
+
+	if _, err := parsePinPolicy("latest"); err == nil {
+		t.Errorf("expected unknown pin policy to fail")
+	}
+}
+
+func TestPinSpecifier(t *testing.T) {
+	cases := []struct {
+		policy   pinPolicy
+		version  string
+		expected string
+	}{
+		{pinExact, "2.31.0", "==2.31.0"},
+		{pinExact, "2.1.0+cpu", "==2.1.0+cpu"},
+		{pinCompatible, "2.31.0", "~=2.31.0"},
+		{pinCompatible, "5", "~=5.0"},
+		{pinCompatible, "2.1.0+cpu", "~=2.1.0"},
+		{pinLowerBound, "1.26.4", ">=1.26.4"},
+		{pinNone, "1.26.4", ""},
+	}
+
+	for _, c := range cases {
+		if actual := pinSpecifier(c.policy, c.version); actual != c.expected {
+			t.Errorf("pinSpecifier(%s, %s): expected %q, received %q", c.policy, c.version, c.expected, actual)
+		}
+	}
+}
+
+func TestResolvePinPolicy(t *testing.T) {
+	setupTempDirectory(t)
+
+	policy, err := resolvePinPolicy("")
+	if err != nil {
+		t.Fatalf("resolvePinPolicy failed: %v", err)
+	}
+	if policy != defaultPinPolicy {
+		t.Errorf("expected default pin policy, received %s", policy)
+	}
+
+	if err := os.WriteFile("pvm.toml", []byte("pin = \"compatible\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	policy, err = resolvePinPolicy("")
+	if err != nil {
+		t.Fatalf("resolvePinPolicy failed: %v", err)
+	}
+	if policy != pinCompatible {
+		t.Errorf("expected project pin policy, received %s", policy)
+	}
+
+	policy, err = resolvePinPolicy("lower-bound")
+	if err != nil {
+		t.Fatalf("resolvePinPolicy failed: %v", err)
+	}
+	if policy != pinLowerBound {
+		t.Errorf("expected flag to override project pin policy, received %s", policy)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// directory passed with the --project flag, overrides the discovery
+var projectFlag string
+
+// files that mark the root directory of a project
+var projectMarkerFiles = []string{"pyproject.toml", "requirements.txt", "pvm.toml"}
+
+// directories that mark the root directory of a project
+// when they hold a virtual environment
+var projectMarkerVenvs = []string{".venv", "venv", "env"}
+
+// returns true if the directory holds one of the project markers
+func isProjectRoot(dir string) bool {
+	for _, name := range projectMarkerFiles {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+
+	for _, name := range projectMarkerVenvs {
+		if _, err := os.Stat(filepath.Join(dir, name, "pyvenv.cfg")); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the closest directory, starting at dir and walking up
+// its parents, that holds one of the project markers
+// returns an empty string if no directory does
+func findProjectRoot(dir string) string {
+	for {
+		if isProjectRoot(dir) {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// returns the root directory of the project the commands work on
+// the --project flag wins, otherwise the closest directory holding a
+// project marker is used, falling back to the working directory
+func getProjectRoot() (string, error) {
+	if projectFlag != "" {
+		root, err := filepath.Abs(projectFlag)
+		if err != nil {
+			return "", err
+		}
+
+		info, err := os.Stat(root)
+		if err != nil {
+			return "", fmt.Errorf("project directory %s not found", projectFlag)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("project directory %s is not a directory", projectFlag)
+		}
+
+		return root, nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	if root := findProjectRoot(cwd); root != "" {
+		return root, nil
+	}
+
+	return cwd, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "src", "package")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "pyproject.toml"), []byte("[project]\n"), 0644); err != nil {
+		t.Fatalf("failed to write pyproject.toml: %v", err)
+	}
+
+	if found := findProjectRoot(nested); found != root {
+		t.Errorf("expected %s, received %s", root, found)
+	}
+
+	// a directory named like a virtual environment only counts with a pyvenv.cfg
+	if err := os.MkdirAll(filepath.Join(root, "src", "env"), 0755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+	if found := findProjectRoot(nested); found != root {
+		t.Errorf("expected %s, received %s", root, found)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "src", "env", "pyvenv.cfg"), nil, 0644); err != nil {
+		t.Fatalf("failed to write pyvenv.cfg: %v", err)
+	}
+	if found := findProjectRoot(nested); found != filepath.Join(root, "src") {
+		t.Errorf("expected the virtual environment to mark the root, received %s", found)
+	}
+}
+
+func TestGetProjectRootFromSubdirectory(t *testing.T) {
+	reqPath := setupTempRequirements(t, []string{"requests"})
+	root := filepath.Dir(reqPath)
+
+	if err := os.MkdirAll("src", 0755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+	os.Chdir("src")
+
+	found, err := getProjectRoot()
+	if err != nil {
+		t.Fatalf("getProjectRoot failed: %v", err)
+	}
+	if found != root {
+		t.Errorf("expected %s, received %s", root, found)
+	}
+
+	packages, err := getPackagesFromRequirements()
+	if err != nil {
+		t.Fatalf("getPackagesFromRequirements failed: %v", err)
+	}
+	if len(packages) != 1 || packages[0] != "requests" {
+		t.Errorf("expected the requirements of the project root, received %v", packages)
+	}
+}
+
+func TestGetProjectRootWithProjectFlag(t *testing.T) {
+	setupTempDirectory(t)
+	other := t.TempDir()
+
+	projectFlag = other
+	t.Cleanup(func() { projectFlag = "" })
+
+	found, err := getProjectRoot()
+	if err != nil {
+		t.Fatalf("getProjectRoot failed: %v", err)
+	}
+	if found != other {
+		t.Errorf("expected %s, received %s", other, found)
+	}
+
+	projectFlag = filepath.Join(other, "missing")
+	if _, err := getProjectRoot(); err == nil {
+		t.Errorf("expected a missing project directory to fail")
+	}
+}
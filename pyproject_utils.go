@@ -0,0 +1,673 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var includeGroupRegex = regexp.MustCompile(`include-group\s*=\s*["']([^"']+)["']`)
+
+// a pyproject.toml file that is edited in place
+// only the dependency arrays pvm changes are rewritten,
+// every other byte of the file is kept as it was read
+type pyprojectDocument struct {
+	text string
+}
+
+// a key/value pair found while scanning a TOML document
+type tomlEntry struct {
+	path       string // full dotted key path, e.g. "project.dependencies"
+	table      string // table the key was written in
+	valueStart int    // offset of the first byte of the value
+	valueEnd   int    // offset after the last byte of the value
+	lineEnd    int    // offset of the line ending after the value
+}
+
+// a table header found while scanning a TOML document
+type tomlTable struct {
+	name    string
+	lineEnd int // offset of the line ending after the header
+}
+
+// a string inside a TOML array
+type tomlArrayItem struct {
+	start int // offset of the opening quote
+	end   int // offset after the closing quote
+	value string
+	quote string
+}
+
+// scans the top-level structure of a TOML document
+type tomlScanner struct {
+	text    string
+	pos     int
+	table   string
+	entries []tomlEntry
+	tables  []tomlTable
+}
+
+// returns the normalized dotted form of a key or table name
+func normalizeTOMLKey(raw string) string {
+	var parts []string
+	for _, part := range splitTOMLKey(raw) {
+		part = strings.TrimSpace(part)
+		if unquoted, err := strconv.Unquote(part); err == nil && strings.HasPrefix(part, "\"") {
+			part = unquoted
+		} else if len(part) >= 2 && part[0] == '\'' && part[len(part)-1] == '\'' {
+			part = part[1 : len(part)-1]
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// splits a dotted key on the dots that are not quoted
+func splitTOMLKey(raw string) []string {
+	var parts []string
+	quote := byte(0)
+	start := 0
+
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case quote != 0:
+			if raw[i] == '\\' && quote == '"' {
+				i++
+			} else if raw[i] == quote {
+				quote = 0
+			}
+		case raw[i] == '"' || raw[i] == '\'':
+			quote = raw[i]
+		case raw[i] == '.':
+			parts = append(parts, raw[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, raw[start:])
+}
+
+// scans the whole document and records every table and key
+func scanTOML(text string) (*tomlScanner, error) {
+	s := &tomlScanner{text: text}
+
+	for {
+		s.skipBlank(true)
+		if s.pos >= len(s.text) {
+			return s, nil
+		}
+
+		if s.text[s.pos] == '[' {
+			if err := s.scanTable(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := s.scanEntry(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skips whitespace and comments, and line endings if requested
+func (s *tomlScanner) skipBlank(newlines bool) {
+	for s.pos < len(s.text) {
+		switch ch := s.text[s.pos]; {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			s.pos++
+		case ch == '\n' && newlines:
+			s.pos++
+		case ch == '#':
+			for s.pos < len(s.text) && s.text[s.pos] != '\n' {
+				s.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// returns the offset of the end of the current line
+func (s *tomlScanner) lineEnd() int {
+	s.skipBlank(false)
+	return s.pos
+}
+
+// scans a [table] or [[array.of.tables]] header
+func (s *tomlScanner) scanTable() error {
+	opening, closing := "[", "]"
+	if strings.HasPrefix(s.text[s.pos:], "[[") {
+		opening, closing = "[[", "]]"
+	}
+
+	end := strings.IndexByte(s.text[s.pos:], '\n')
+	if end < 0 {
+		end = len(s.text) - s.pos
+	}
+	line := s.text[s.pos : s.pos+end]
+
+	end = strings.Index(line, closing)
+	if end < 0 {
+		return fmt.Errorf("invalid table header %q", line)
+	}
+
+	s.table = normalizeTOMLKey(line[len(opening):end])
+	s.pos += end + len(closing)
+	s.tables = append(s.tables, tomlTable{name: s.table, lineEnd: s.lineEnd()})
+
+	return nil
+}
+
+// scans a key = value pair
+func (s *tomlScanner) scanEntry() error {
+	start := s.pos
+	quote := byte(0)
+
+	for s.pos < len(s.text) && (quote != 0 || s.text[s.pos] != '=') {
+		ch := s.text[s.pos]
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case quote == 0 && ch == '\n':
+			return fmt.Errorf("expected '=' after key %q", strings.TrimSpace(s.text[start:s.pos]))
+		}
+		s.pos++
+	}
+
+	if s.pos >= len(s.text) {
+		return fmt.Errorf("expected '=' after key %q", strings.TrimSpace(s.text[start:]))
+	}
+
+	key := normalizeTOMLKey(s.text[start:s.pos])
+	s.pos++
+	s.skipBlank(false)
+
+	entry := tomlEntry{path: key, table: s.table, valueStart: s.pos}
+	if s.table != "" {
+		entry.path = s.table + "." + key
+	}
+
+	if err := s.skipValue(); err != nil {
+		return err
+	}
+
+	entry.valueEnd = s.pos
+	entry.lineEnd = s.lineEnd()
+	s.entries = append(s.entries, entry)
+
+	return nil
+}
+
+// moves past the value starting at the current position
+func (s *tomlScanner) skipValue() error {
+	if s.pos >= len(s.text) {
+		return fmt.Errorf("missing value")
+	}
+
+	switch s.text[s.pos] {
+	case '"', '\'':
+		_, _, err := s.scanString()
+		return err
+	case '[':
+		_, _, err := s.scanArray()
+		return err
+	case '{':
+		return s.skipInlineTable()
+	}
+
+	for s.pos < len(s.text) && !strings.ContainsRune(",]}\n#", rune(s.text[s.pos])) {
+		s.pos++
+	}
+	for s.pos > 0 && (s.text[s.pos-1] == ' ' || s.text[s.pos-1] == '\t' || s.text[s.pos-1] == '\r') {
+		s.pos--
+	}
+
+	return nil
+}
+
+// scans a string and returns its decoded value and quote style
+func (s *tomlScanner) scanString() (string, string, error) {
+	start := s.pos
+	rest := s.text[s.pos:]
+
+	quote := rest[:1]
+	if strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`) {
+		quote = rest[:3]
+	}
+	s.pos += len(quote)
+
+	for s.pos < len(s.text) {
+		if s.text[s.pos] == '\\' && quote[0] == '"' {
+			s.pos += 2
+			continue
+		}
+		if strings.HasPrefix(s.text[s.pos:], quote) {
+			s.pos += len(quote)
+			return decodeTOMLString(s.text[start+len(quote):s.pos-len(quote)], quote), quote, nil
+		}
+		if s.text[s.pos] == '\n' && len(quote) == 1 {
+			break
+		}
+		s.pos++
+	}
+
+	return "", "", fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// decodes the contents of a TOML string
+func decodeTOMLString(raw string, quote string) string {
+	if quote[0] == '\'' {
+		return strings.TrimPrefix(raw, "\n")
+	}
+
+	raw = strings.TrimPrefix(raw, "\n")
+	if value, err := strconv.Unquote(`"` + strings.ReplaceAll(raw, "\n", `\n`) + `"`); err == nil {
+		return value
+	}
+	return raw
+}
+
+// scans an array and returns the strings it contains, along with
+// the groups named by PEP 735 {include-group = "..."} tables
+func (s *tomlScanner) scanArray() ([]tomlArrayItem, []string, error) {
+	var items []tomlArrayItem
+	var includes []string
+	s.pos++
+
+	for {
+		s.skipBlank(true)
+		if s.pos >= len(s.text) {
+			return nil, nil, fmt.Errorf("unterminated array")
+		}
+
+		switch s.text[s.pos] {
+		case ']':
+			s.pos++
+			return items, includes, nil
+		case ',':
+			s.pos++
+		case '"', '\'':
+			start := s.pos
+			value, quote, err := s.scanString()
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, tomlArrayItem{start: start, end: s.pos, value: value, quote: quote})
+		case '{':
+			start := s.pos
+			if err := s.skipInlineTable(); err != nil {
+				return nil, nil, err
+			}
+			if match := includeGroupRegex.FindStringSubmatch(s.text[start:s.pos]); match != nil {
+				includes = append(includes, match[1])
+			}
+		default:
+			if err := s.skipValue(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+// moves past an inline table
+func (s *tomlScanner) skipInlineTable() error {
+	s.pos++
+
+	for {
+		s.skipBlank(true)
+		if s.pos >= len(s.text) {
+			return fmt.Errorf("unterminated inline table")
+		}
+
+		switch s.text[s.pos] {
+		case '}':
+			s.pos++
+			return nil
+		case ',':
+			s.pos++
+		case '=':
+			s.pos++
+			s.skipBlank(false)
+			if err := s.skipValue(); err != nil {
+				return err
+			}
+		default:
+			s.pos++
+		}
+	}
+}
+
+// parses and validates a pyproject.toml document
+func parsePyprojectDocument(text string) (*pyprojectDocument, error) {
+	if _, err := scanTOML(text); err != nil {
+		return nil, fmt.Errorf("invalid pyproject.toml: %v", err)
+	}
+	return &pyprojectDocument{text: text}, nil
+}
+
+// returns the entry for the dotted key path
+func (d *pyprojectDocument) entry(path string) (*tomlScanner, *tomlEntry) {
+	scanner, err := scanTOML(d.text)
+	if err != nil {
+		return nil, nil
+	}
+
+	for i := range scanner.entries {
+		if scanner.entries[i].path == path {
+			return scanner, &scanner.entries[i]
+		}
+	}
+	return scanner, nil
+}
+
+// returns true if the document has a table or key under the passed name
+func (d *pyprojectDocument) hasTable(name string) bool {
+	scanner, err := scanTOML(d.text)
+	if err != nil {
+		return false
+	}
+
+	for _, table := range scanner.tables {
+		if table.name == name {
+			return true
+		}
+	}
+	for _, entry := range scanner.entries {
+		if strings.HasPrefix(entry.path, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the strings of the array stored under the dotted key path
+func (d *pyprojectDocument) array(path string) ([]tomlArrayItem, *tomlEntry, error) {
+	_, entry := d.entry(path)
+	if entry == nil {
+		return nil, nil, nil
+	}
+
+	if d.text[entry.valueStart] != '[' {
+		return nil, nil, fmt.Errorf("%s is not an array", path)
+	}
+
+	scanner := &tomlScanner{text: d.text, pos: entry.valueStart}
+	items, _, err := scanner.scanArray()
+	return items, entry, err
+}
+
+// returns the dependency groups included by the array
+// stored under the dotted key path
+func (d *pyprojectDocument) includes(path string) ([]string, error) {
+	_, entry := d.entry(path)
+	if entry == nil || d.text[entry.valueStart] != '[' {
+		return nil, nil
+	}
+
+	scanner := &tomlScanner{text: d.text, pos: entry.valueStart}
+	_, includes, err := scanner.scanArray()
+	return includes, err
+}
+
+// returns the strings of the array stored under the dotted key path
+func (d *pyprojectDocument) strings(path string) ([]string, error) {
+	items, _, err := d.array(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, item := range items {
+		values = append(values, item.value)
+	}
+	return values, nil
+}
+
+// returns the string stored under the dotted key path,
+// or an empty string if the key is missing
+func (d *pyprojectDocument) stringValue(path string) (string, error) {
+	_, entry := d.entry(path)
+	if entry == nil {
+		return "", nil
+	}
+
+	if !strings.ContainsRune("\"'", rune(d.text[entry.valueStart])) {
+		return "", fmt.Errorf("%s is not a string", path)
+	}
+
+	scanner := &tomlScanner{text: d.text, pos: entry.valueStart}
+	value, _, err := scanner.scanString()
+	return value, err
+}
+
+// returns the keys directly below the passed table, e.g. the
+// extras of project.optional-dependencies
+func (d *pyprojectDocument) keys(table string) []string {
+	scanner, err := scanTOML(d.text)
+	if err != nil {
+		return nil
+	}
+
+	var keys []string
+	for _, entry := range scanner.entries {
+		if rest, found := strings.CutPrefix(entry.path, table+"."); found && !strings.Contains(rest, ".") {
+			keys = append(keys, rest)
+		}
+	}
+	return keys
+}
+
+// returns the value quoted as a TOML string, using the preferred
+// quote style when the value allows it
+func quoteTOMLString(value string, quote string) string {
+	if quote == "'" && !strings.ContainsAny(value, "'\n") {
+		return "'" + value + "'"
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// replaces the string at the passed index of the array
+func (d *pyprojectDocument) replaceArrayItem(path string, index int, value string) error {
+	items, _, err := d.array(path)
+	if err != nil {
+		return err
+	}
+
+	item := items[index]
+	quote := item.quote
+	if len(quote) == 3 {
+		quote = quote[:1]
+	}
+
+	d.text = d.text[:item.start] + quoteTOMLString(value, quote) + d.text[item.end:]
+	return nil
+}
+
+// removes the string at the passed index of the array
+// an item written on its own line is removed together with its line
+func (d *pyprojectDocument) removeArrayItem(path string, index int) error {
+	items, entry, err := d.array(path)
+	if err != nil {
+		return err
+	}
+
+	item := items[index]
+	start, end := item.start, item.end
+
+	// take the separating comma with the item
+	after := skipSpaces(d.text, end)
+	if after < len(d.text) && d.text[after] == ',' {
+		end = after + 1
+	} else if index > 0 {
+		before := strings.LastIndexByte(d.text[:start], ',')
+		if before > items[index-1].end-1 {
+			start = before
+		}
+	}
+
+	lineStart := strings.LastIndexByte(d.text[:start], '\n') + 1
+	lineEnd := strings.IndexByte(d.text[end:], '\n')
+	if lineEnd >= 0 {
+		lineEnd += end
+	}
+
+	ownLine := strings.TrimSpace(d.text[lineStart:start]) == "" && lineEnd >= 0 && lineStart > entry.valueStart &&
+		(strings.TrimSpace(d.text[end:lineEnd]) == "" || strings.HasPrefix(strings.TrimSpace(d.text[end:lineEnd]), "#"))
+
+	if ownLine {
+		d.text = d.text[:lineStart] + d.text[lineEnd+1:]
+		return nil
+	}
+
+	// single line array, drop the space that followed the comma
+	if end < len(d.text) && d.text[end] == ' ' && d.text[end-1] == ',' {
+		end++
+	}
+
+	d.text = d.text[:start] + d.text[end:]
+	return nil
+}
+
+// returns the offset of the first non space character from the offset
+func skipSpaces(text string, offset int) int {
+	for offset < len(text) && (text[offset] == ' ' || text[offset] == '\t') {
+		offset++
+	}
+	return offset
+}
+
+// appends a string to the array stored under the dotted key path
+// the array and its table are created when they do not exist
+func (d *pyprojectDocument) appendArrayItem(path string, value string) error {
+	items, entry, err := d.array(path)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return d.insertArray(path, value)
+	}
+
+	closing := entry.valueEnd - 1
+
+	if len(items) == 0 {
+		d.text = d.text[:closing] + quoteTOMLString(value, `"`) + d.text[closing:]
+		return nil
+	}
+
+	last := items[len(items)-1]
+	quote := last.quote[:1]
+	multiline := strings.Contains(d.text[entry.valueStart:entry.valueEnd], "\n")
+
+	afterLast := skipSpaces(d.text, last.end)
+	trailingComma := afterLast < len(d.text) && d.text[afterLast] == ','
+
+	if !multiline {
+		insert := ", " + quoteTOMLString(value, quote)
+		at := last.end
+		if trailingComma {
+			insert = " " + quoteTOMLString(value, quote) + ","
+			at = afterLast + 1
+		}
+		d.text = d.text[:at] + insert + d.text[at:]
+		return nil
+	}
+
+	lineStart := strings.LastIndexByte(d.text[:last.start], '\n') + 1
+	indent := d.text[lineStart:last.start]
+	if strings.TrimSpace(indent) != "" {
+		indent = "    "
+	}
+
+	line := indent + quoteTOMLString(value, quote)
+	if trailingComma {
+		// keep the trailing comma style of the array
+		line += ","
+		lineEnd := strings.IndexByte(d.text[last.end:], '\n')
+		if lineEnd < 0 || last.end+lineEnd > closing {
+			d.text = d.text[:afterLast+1] + "\n" + line + d.text[afterLast+1:]
+			return nil
+		}
+		at := last.end + lineEnd + 1
+		d.text = d.text[:at] + line + "\n" + d.text[at:]
+		return nil
+	}
+
+	// the comma goes right after the last item, the new item on the next
+	// line so that a comment after the last item stays with it
+	d.text = d.text[:last.end] + "," + d.text[last.end:]
+	afterComma := last.end + 1
+	lineEnd := strings.IndexByte(d.text[afterComma:], '\n')
+	if lineEnd < 0 || afterComma+lineEnd > closing+1 {
+		d.text = d.text[:afterComma] + "\n" + line + d.text[afterComma:]
+		return nil
+	}
+	at := afterComma + lineEnd + 1
+	d.text = d.text[:at] + line + "\n" + d.text[at:]
+	return nil
+}
+
+// creates the array stored under the dotted key path with a single value
+func (d *pyprojectDocument) insertArray(path string, value string) error {
+	scanner, err := scanTOML(d.text)
+	if err != nil {
+		return err
+	}
+
+	dot := strings.LastIndex(path, ".")
+	table, key := path[:dot], path[dot+1:]
+	if strings.ContainsAny(key, " .\"'") || key == "" {
+		key = strconv.Quote(key)
+	}
+	array := key + " = [\n    " + quoteTOMLString(value, `"`) + ",\n]"
+
+	// insert after the last key of the table
+	insertAt := -1
+	for _, t := range scanner.tables {
+		if t.name == table {
+			insertAt = t.lineEnd
+		}
+	}
+	if insertAt < 0 {
+		text := strings.TrimRight(d.text, "\n")
+		if text != "" {
+			text += "\n\n"
+		}
+		d.text = text + "[" + table + "]\n" + array + "\n"
+		return nil
+	}
+	for _, e := range scanner.entries {
+		if e.table == table && e.lineEnd > insertAt {
+			insertAt = e.lineEnd
+		}
+	}
+
+	if insertAt >= len(d.text) {
+		d.text += "\n" + array + "\n"
+		return nil
+	}
+	d.text = d.text[:insertAt+1] + array + "\n" + d.text[insertAt+1:]
+	return nil
+}
+
+// reads and parses the pyproject.toml file at the passed path
+func loadPyprojectDocument(path string) (*pyprojectDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePyprojectDocument(string(data))
+}
+
+// writes the document to the passed path
+func (d *pyprojectDocument) save(path string) error {
+	return os.WriteFile(path, []byte(d.text), 0644)
+}
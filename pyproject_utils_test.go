@@ -0,0 +1,396 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const samplePyproject = `[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = "service"  # the service name
+version = "0.1.0"
+dependencies = [
+    "requests>=2.31",  # http client
+    'numpy ; python_version >= "3.9"',
+    "Flask[async]==3.0.0",
+]
+
+[project.optional-dependencies]
+docs = ["sphinx", "furo"]
+
+[tool.black]
+line-length = 100
+`
+
+func TestPyprojectDocumentReadsDependencies(t *testing.T) {
+	doc, err := parsePyprojectDocument(samplePyproject)
+	if err != nil {
+		t.Fatalf("parsePyprojectDocument failed: %v", err)
+	}
+
+	dependencies, err := doc.strings("project.dependencies")
+	if err != nil {
+		t.Fatalf("strings failed: %v", err)
+	}
+
+	expected := []string{"requests>=2.31", `numpy ; python_version >= "3.9"`, "Flask[async]==3.0.0"}
+	if !reflect.DeepEqual(dependencies, expected) {
+		t.Errorf("unexpected dependencies: %q", dependencies)
+	}
+
+	docs, err := doc.strings("project.optional-dependencies.docs")
+	if err != nil {
+		t.Fatalf("strings failed: %v", err)
+	}
+	if !reflect.DeepEqual(docs, []string{"sphinx", "furo"}) {
+		t.Errorf("unexpected optional dependencies: %q", docs)
+	}
+
+	if !doc.hasTable("project") || doc.hasTable("tool.poetry") {
+		t.Errorf("unexpected tables detected")
+	}
+}
+
+func TestPyprojectDocumentEditsMultilineArray(t *testing.T) {
+	doc, err := parsePyprojectDocument(samplePyproject)
+	if err != nil {
+		t.Fatalf("parsePyprojectDocument failed: %v", err)
+	}
+
+	if err := doc.appendArrayItem("project.dependencies", "pandas==2.1.0"); err != nil {
+		t.Fatalf("appendArrayItem failed: %v", err)
+	}
+	if err := doc.replaceArrayItem("project.dependencies", 0, "requests==2.32.0"); err != nil {
+		t.Fatalf("replaceArrayItem failed: %v", err)
+	}
+	if err := doc.removeArrayItem("project.dependencies", 1); err != nil {
+		t.Fatalf("removeArrayItem failed: %v", err)
+	}
+
+	expected := `[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = "service"  # the service name
+version = "0.1.0"
+dependencies = [
+    "requests==2.32.0",  # http client
+    "Flask[async]==3.0.0",
+    "pandas==2.1.0",
+]
+
+[project.optional-dependencies]
+docs = ["sphinx", "furo"]
+
+[tool.black]
+line-length = 100
+`
+	if doc.text != expected {
+		t.Errorf("unexpected document:\n%s", doc.text)
+	}
+}
+
+func TestPyprojectDocumentAppendsAfterComment(t *testing.T) {
+	tests := []struct {
+		document string
+		expected string
+	}{
+		{
+			"dependencies = [\n    \"requests\",\n    \"click\"  # cli\n]\n",
+			"dependencies = [\n    \"requests\",\n    \"click\",  # cli\n    \"flask\"\n]\n",
+		},
+		{
+			"dependencies = [\n    \"requests\",\n    \"click\"]\n",
+			"dependencies = [\n    \"requests\",\n    \"click\",\n    \"flask\"]\n",
+		},
+	}
+
+	for _, test := range tests {
+		doc, err := parsePyprojectDocument(test.document)
+		if err != nil {
+			t.Fatalf("parsePyprojectDocument failed: %v", err)
+		}
+		if err := doc.appendArrayItem("dependencies", "flask"); err != nil {
+			t.Fatalf("appendArrayItem failed: %v", err)
+		}
+		if doc.text != test.expected {
+			t.Errorf("expected:\n%s\nreceived:\n%s", test.expected, doc.text)
+		}
+	}
+}
+
+func TestPyprojectDocumentEditsSingleLineArray(t *testing.T) {
+	doc, err := parsePyprojectDocument(samplePyproject)
+	if err != nil {
+		t.Fatalf("parsePyprojectDocument failed: %v", err)
+	}
+
+	path := "project.optional-dependencies.docs"
+	if err := doc.appendArrayItem(path, "myst-parser"); err != nil {
+		t.Fatalf("appendArrayItem failed: %v", err)
+	}
+	if err := doc.removeArrayItem(path, 0); err != nil {
+		t.Fatalf("removeArrayItem failed: %v", err)
+	}
+
+	docs, _ := doc.strings(path)
+	if !reflect.DeepEqual(docs, []string{"furo", "myst-parser"}) {
+		t.Errorf("unexpected optional dependencies: %q", docs)
+	}
+
+	if !strings.Contains(doc.text, "\ndocs = [\"furo\", \"myst-parser\"]\n") {
+		t.Errorf("single line array lost its formatting:\n%s", doc.text)
+	}
+}
+
+func TestPyprojectDocumentCreatesMissingArrays(t *testing.T) {
+	doc, err := parsePyprojectDocument("[project]\nname = \"service\"\n\n[tool.black]\nline-length = 100\n")
+	if err != nil {
+		t.Fatalf("parsePyprojectDocument failed: %v", err)
+	}
+
+	if err := doc.appendArrayItem("project.dependencies", "requests"); err != nil {
+		t.Fatalf("appendArrayItem failed: %v", err)
+	}
+	if err := doc.appendArrayItem("project.optional-dependencies.test", "pytest"); err != nil {
+		t.Fatalf("appendArrayItem failed: %v", err)
+	}
+
+	expected := "[project]\nname = \"service\"\ndependencies = [\n    \"requests\",\n]\n\n[tool.black]\nline-length = 100\n\n" +
+		"[project.optional-dependencies]\ntest = [\n    \"pytest\",\n]\n"
+	if doc.text != expected {
+		t.Errorf("unexpected document:\n%s", doc.text)
+	}
+}
+
+func TestInvalidPyprojectDocument(t *testing.T) {
+	for _, text := range []string{"[project\nname = 1", "dependencies = [\"a\"", "name \"x\"\n"} {
+		if _, err := parsePyprojectDocument(text); err == nil {
+			t.Errorf("expected %q to fail", text)
+		}
+	}
+}
+
+func TestManifestUsesPyproject(t *testing.T) {
+	setupTempDirectory(t)
+
+	if err := os.WriteFile("pyproject.toml", []byte(samplePyproject), 0644); err != nil {
+		t.Fatalf("failed to write pyproject.toml: %v", err)
+	}
+
+	if getManifestName() != "pyproject.toml" {
+		t.Fatalf("expected pyproject.toml to be used as the manifest")
+	}
+
+	if err := addPackagesToManifest([]string{"pandas==2.1.0", "REQUESTS"}, dependencySection{}); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+	if err := removePackagesFromManifest([]string{"flask"}, dependencySection{}); err != nil {
+		t.Fatalf("removePackagesFromManifest failed: %v", err)
+	}
+	if err := addPackagesToManifest([]string{"pytest"}, dependencySection{Optional: "test"}); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+
+	packages, err := getPackagesFromRequirements()
+	if err != nil {
+		t.Fatalf("getPackagesFromRequirements failed: %v", err)
+	}
+
+	expected := []string{"requests>=2.31", `numpy; python_version >= "3.9"`, "pandas==2.1.0"}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("expected %q, received %q", expected, packages)
+	}
+
+	test, err := getDeclaredRequirements(dependencySection{Optional: "test"})
+	if err != nil {
+		t.Fatalf("getDeclaredRequirements failed: %v", err)
+	}
+	if len(test) != 1 || test[0].Name != "pytest" {
+		t.Errorf("unexpected optional dependencies: %+v", test)
+	}
+}
+
+func TestOptionalDependenciesNeedPyproject(t *testing.T) {
+	setupTempRequirements(t, []string{"requests"})
+
+	if err := addPackagesToManifest([]string{"pytest"}, dependencySection{Optional: "test"}); err == nil {
+		t.Errorf("expected optional dependencies without pyproject.toml to fail")
+	}
+}
+
+func TestDependencyGroupsInPyproject(t *testing.T) {
+	setupTempDirectory(t)
+
+	content := samplePyproject + `
+[dependency-groups]
+Test = ["pytest>=8"]
+dev = [
+    "ruff",
+    {include-group = "test"},
+]
+`
+	if err := os.WriteFile("pyproject.toml", []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write pyproject.toml: %v", err)
+	}
+
+	groups, err := listDependencyGroups()
+	if err != nil {
+		t.Fatalf("listDependencyGroups failed: %v", err)
+	}
+	if !reflect.DeepEqual(groups, []string{"dev", "test"}) {
+		t.Errorf("unexpected groups: %q", groups)
+	}
+
+	if err := addPackagesToManifest([]string{"pytest-cov"}, groupSection("TEST")); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+	if err := removePackagesFromManifest([]string{"ruff"}, groupSection("dev")); err != nil {
+		t.Fatalf("removePackagesFromManifest failed: %v", err)
+	}
+
+	dev, err := getDeclaredRequirements(groupSection("dev"))
+	if err != nil {
+		t.Fatalf("getDeclaredRequirements failed: %v", err)
+	}
+
+	var names []string
+	for _, req := range dev {
+		names = append(names, req.key())
+	}
+	if !reflect.DeepEqual(names, []string{"pytest", "pytest-cov"}) {
+		t.Errorf("expected the dev group to include the test group, received %q", names)
+	}
+
+	data, _ := os.ReadFile("pyproject.toml")
+	if !strings.Contains(string(data), "Test = [\"pytest>=8\", \"pytest-cov\"]\n") {
+		t.Errorf("test group was not edited in place:\n%s", data)
+	}
+
+	packages, err := getPackagesFromRequirements()
+	if err != nil {
+		t.Fatalf("getPackagesFromRequirements failed: %v", err)
+	}
+	if len(packages) != 3 {
+		t.Errorf("expected the main dependencies to be unchanged: %q", packages)
+	}
+}
+
+func TestDependencyGroupIncludeCycle(t *testing.T) {
+	setupTempDirectory(t)
+
+	content := "[project]\nname = \"service\"\n\n[dependency-groups]\na = [{include-group = \"b\"}]\nb = [{include-group = \"a\"}]\n"
+	if err := os.WriteFile("pyproject.toml", []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write pyproject.toml: %v", err)
+	}
+
+	if _, err := getDeclaredRequirements(groupSection("a")); err == nil {
+		t.Errorf("expected a cycle of included groups to fail")
+	}
+}
+
+func TestDependencyGroupsInRequirementsFiles(t *testing.T) {
+	setupTempRequirements(t, []string{"requests"})
+
+	if err := addPackagesToManifest([]string{"pytest"}, groupSection("dev")); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+
+	data, err := os.ReadFile("requirements-dev.txt")
+	if err != nil {
+		t.Fatalf("expected requirements-dev.txt to be created: %v", err)
+	}
+	if string(data) != "pytest\n" {
+		t.Errorf("unexpected requirements-dev.txt: %q", data)
+	}
+
+	if getSectionManifestName(groupSection("dev")) != "requirements-dev.txt" {
+		t.Errorf("unexpected manifest name: %s", getSectionManifestName(groupSection("dev")))
+	}
+
+	if _, err := selectDependencyGroups([]string{"docs"}); err == nil {
+		t.Errorf("expected an unknown group to fail")
+	}
+
+	requirements, err := getRequirementsOfGroups([]string{"main", "Dev"})
+	if err != nil {
+		t.Fatalf("getRequirementsOfGroups failed: %v", err)
+	}
+	if len(requirements) != 2 || requirements[0].Name != "requests" || requirements[1].Name != "pytest" {
+		t.Errorf("unexpected requirements: %+v", requirements)
+	}
+
+	if err := removePackagesFromManifest([]string{"pytest"}, groupSection("dev")); err != nil {
+		t.Fatalf("removePackagesFromManifest failed: %v", err)
+	}
+	packages, _ := getPackagesFromRequirements()
+	if !reflect.DeepEqual(packages, []string{"requests"}) {
+		t.Errorf("expected the main dependencies to be unchanged: %q", packages)
+	}
+}
+
+func TestDependencyGroupFileNamesAreKept(t *testing.T) {
+	setupTempRequirements(t, []string{"requests"})
+
+	for name, content := range map[string]string{
+		"requirements-Dev_Tools.txt": "pytest\n",
+		"requirements-lock.txt":      "requests==2.31.0\n",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	groups, err := listDependencyGroups()
+	if err != nil {
+		t.Fatalf("listDependencyGroups failed: %v", err)
+	}
+	if !reflect.DeepEqual(groups, []string{"dev-tools"}) {
+		t.Errorf("unexpected groups: %q", groups)
+	}
+
+	if err := addPackagesToManifest([]string{"ruff"}, groupSection("dev-tools")); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+	requirements, err := getRequirementsOfGroups([]string{"dev-tools"})
+	if err != nil {
+		t.Fatalf("getRequirementsOfGroups failed: %v", err)
+	}
+	if len(requirements) != 3 || requirements[1].Name != "pytest" || requirements[2].Name != "ruff" {
+		t.Errorf("expected the group to be read from requirements-Dev_Tools.txt: %+v", requirements)
+	}
+	if _, err := os.Stat("requirements-dev-tools.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected no requirements-dev-tools.txt to be created")
+	}
+
+	if err := addPackagesToManifest([]string{"pytest"}, groupSection("lock")); err == nil {
+		t.Errorf("expected lock to be refused as a group name")
+	}
+}
+
+func TestPyprojectDocumentStringValue(t *testing.T) {
+	doc, err := parsePyprojectDocument(samplePyproject)
+	if err != nil {
+		t.Fatalf("parsePyprojectDocument failed: %v", err)
+	}
+
+	name, err := doc.stringValue("project.name")
+	if err != nil || name != "service" {
+		t.Errorf("expected service, received %q, %v", name, err)
+	}
+
+	missing, err := doc.stringValue("project.requires-python")
+	if err != nil || missing != "" {
+		t.Errorf("expected a missing key to be empty, received %q, %v", missing, err)
+	}
+
+	if _, err := doc.stringValue("project.dependencies"); err == nil {
+		t.Errorf("expected an array to fail")
+	}
+}
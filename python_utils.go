@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// name of the file that pins the python version of the project
+const pythonVersionFileName = ".python-version"
+
+// script run by every discovered interpreter to report its version
+const pythonQueryScript = `import json, os, platform, sys
+print(json.dumps({
+    "version": platform.python_version(),
+    "implementation": platform.python_implementation(),
+    "architecture": platform.machine(),
+    "executable": os.path.realpath(sys.executable),
+}))`
+
+// a python interpreter found on the system
+type pythonInterpreter struct {
+	Path           string `json:"path"`           // path the interpreter was found at
+	Version        string `json:"version"`        // e.g. 3.11.7
+	Implementation string `json:"implementation"` // e.g. CPython or PyPy
+	Architecture   string `json:"architecture"`   // machine type, e.g. x86_64 or arm64
+	Executable     string `json:"executable"`     // path with every symlink resolved
+	Project        bool   `json:"project"`        // the virtual environment of the project was built from it
+}
+
+var (
+	pythonExecutableRegex = regexp.MustCompile(`^python(\d+(\.\d+)?)?(\.exe)?$`)
+	releaseVersionRegex   = regexp.MustCompile(`^v?(\d+(\.\d+)*)`)
+	bareVersionRegex      = regexp.MustCompile(`^\d+(\.\d+)*$`)
+)
+
+// returns the directories besides PATH where python
+// installations are commonly kept
+func pythonSearchDirectories() []string {
+	var dirs []string
+
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, pattern := range []string{
+			filepath.Join(home, ".pyenv", "versions", "*", "bin"),
+			filepath.Join(home, ".asdf", "installs", "python", "*", "bin"),
+			filepath.Join(home, ".local", "share", "uv", "python", "*", "bin"),
+		} {
+			matches, _ := filepath.Glob(pattern)
+			dirs = append(dirs, matches...)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			matches, _ := filepath.Glob(filepath.Join(local, "Programs", "Python", "Python*"))
+			dirs = append(dirs, matches...)
+		}
+	} else {
+		dirs = append(dirs, "/usr/bin", "/usr/local/bin", "/opt/homebrew/bin")
+	}
+
+	return dirs
+}
+
+// returns the paths of every python executable on PATH and in
+// the common installation directories, without duplicates
+func pythonCandidatePaths() []string {
+	var candidates []string
+
+	dirs := slices.Concat(filepath.SplitList(os.Getenv("PATH")), pythonSearchDirectories())
+	for _, dir := range dirs {
+		// version manager shims point at interpreters found elsewhere
+		if filepath.Base(dir) == "shims" {
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !pythonExecutableRegex.MatchString(strings.ToLower(entry.Name())) {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			if !slices.Contains(candidates, path) {
+				candidates = append(candidates, path)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// runs the interpreter to learn its version
+func queryPythonInterpreter(path string) (pythonInterpreter, error) {
+	output, err := exec.Command(path, "-c", pythonQueryScript).Output()
+	if err != nil {
+		return pythonInterpreter{}, err
+	}
+
+	interpreter := pythonInterpreter{Path: path}
+	if err := json.Unmarshal(output, &interpreter); err != nil {
+		return pythonInterpreter{}, fmt.Errorf("unexpected output from %s: %v", path, err)
+	}
+
+	return interpreter, nil
+}
+
+// returns every working python interpreter found on the system,
+// newest version first
+// interpreters reached through several paths are reported once
+func discoverPythonInterpreters() []pythonInterpreter {
+	var interpreters []pythonInterpreter
+
+	for _, path := range pythonCandidatePaths() {
+		interpreter, err := queryPythonInterpreter(path)
+		if err != nil {
+			continue
+		}
+
+		if slices.ContainsFunc(interpreters, func(found pythonInterpreter) bool {
+			return found.Executable == interpreter.Executable
+		}) {
+			continue
+		}
+
+		interpreters = append(interpreters, interpreter)
+	}
+
+	// newest first, interpreters reporting an unknown version last
+	slices.SortStableFunc(interpreters, func(a, b pythonInterpreter) int {
+		left, leftErr := pep440.Parse(a.Version)
+		right, rightErr := pep440.Parse(b.Version)
+		switch {
+		case leftErr != nil && rightErr != nil:
+			return 0
+		case leftErr != nil:
+			return 1
+		case rightErr != nil:
+			return -1
+		}
+		return right.Compare(left)
+	})
+
+	return interpreters
+}
+
+// returns true if the python version satisfies the request
+// the request is either a bare version such as 3.11, which matches
+// every 3.11.x release, or comma separated specifiers such as >=3.10,<3.13
+// pre-releases of python match like final releases
+func pythonVersionMatches(request string, version string) (bool, error) {
+	request = strings.TrimSpace(request)
+	if request == "" {
+		return true, nil
+	}
+
+	if bareVersionRegex.MatchString(request) {
+		request = "==" + request + ".*"
+	}
+
+	specifiers, err := pep440.ParseSpecifierSet(request)
+	if err != nil || len(specifiers) == 0 {
+		return false, fmt.Errorf("invalid python version %q", request)
+	}
+
+	// builds from a development checkout report versions such as 3.14.0a1+
+	parsed, err := pep440.Parse(version)
+	if err != nil {
+		match := releaseVersionRegex.FindStringSubmatch(strings.TrimSpace(version))
+		if match == nil {
+			return false, fmt.Errorf("invalid python version %q", version)
+		}
+		parsed = pep440.MustParse(match[1])
+	}
+
+	return specifiers.Contains(parsed, true), nil
+}
+
+// returns the python version requested by the .python-version
+// file of the project, or an empty string without the file
+func readPythonVersionFile() (string, error) {
+	path, err := getFilePath(pythonVersionFileName)
+	if err != nil || path == "" {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// pyenv uses "system" for the interpreter found on PATH
+		if line == "system" {
+			return "", nil
+		}
+		return strings.TrimPrefix(line, "python"), nil
+	}
+
+	return "", nil
+}
+
+// writes the requested python version to the .python-version file
+func writePythonVersionFile(request string) error {
+	root, err := getProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(root, pythonVersionFileName), []byte(request+"\n"), 0644)
+}
+
+// returns the newest interpreter whose version satisfies the request
+// fails with the versions that were found when none does
+func findPythonInterpreter(request string, interpreters []pythonInterpreter) (pythonInterpreter, error) {
+	var found []string
+
+	for _, interpreter := range interpreters {
+		matches, err := pythonVersionMatches(request, interpreter.Version)
+		if err != nil {
+			return pythonInterpreter{}, err
+		}
+		if matches {
+			return interpreter, nil
+		}
+		found = append(found, fmt.Sprintf("%s (%s)", interpreter.Version, interpreter.Path))
+	}
+
+	if len(found) == 0 {
+		return pythonInterpreter{}, fmt.Errorf("no python interpreter found")
+	}
+
+	return pythonInterpreter{}, fmt.Errorf("no python interpreter satisfies %s, found: %s", request, strings.Join(found, ", "))
+}
+
+// returns the python version the project asks for and where it is
+// declared, preferring .python-version over the python setting of
+// the project configuration and the requires-python field of pyproject.toml
+// returns empty strings if the project declares no version
+func projectPythonRequest() (string, string, error) {
+	request, err := readPythonVersionFile()
+	if err != nil || request != "" {
+		return request, pythonVersionFileName, err
+	}
+
+	config, err := loadProjectConfig()
+	if err != nil {
+		return "", "", err
+	}
+	if config.Python != "" {
+		return config.Python, "the pvm configuration", nil
+	}
+
+	path, err := getFilePath("pyproject.toml")
+	if err != nil || path == "" {
+		return "", "", err
+	}
+
+	doc, err := loadPyprojectDocument(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	request, err = doc.stringValue("project.requires-python")
+	if err != nil || request == "" {
+		return "", "", err
+	}
+
+	return request, "pyproject.toml", nil
+}
+
+// returns a message describing why the virtual environment does not
+// match the python version of the project, or an empty string if it does
+func venvPythonMismatch() (string, error) {
+	config, err := readVenvConfig()
+	if err != nil || config == nil || config.Version == "" {
+		return "", err
+	}
+
+	request, source, err := projectPythonRequest()
+	if err != nil || request == "" {
+		return "", err
+	}
+
+	matches, err := pythonVersionMatches(request, config.Version)
+	if err != nil || matches {
+		return "", err
+	}
+
+	return fmt.Sprintf("the virtual environment uses Python %s but %s requires %s", config.Version, source, request), nil
+}
+
+// returns the interpreter the virtual environment should be created with
+// the request falls back to the version declared by the project, and
+// without either the first python on PATH is used
+func selectPythonInterpreter(request string) (pythonInterpreter, error) {
+	if request == "" {
+		var err error
+		request, _, err = projectPythonRequest()
+		if err != nil {
+			return pythonInterpreter{}, err
+		}
+	}
+
+	if request == "" {
+		path, err := getGlobalPythonPath()
+		if err != nil {
+			return pythonInterpreter{}, err
+		}
+		return queryPythonInterpreter(path)
+	}
+
+	return findPythonInterpreter(request, discoverPythonInterpreters())
+}
+
+// returns true if the virtual environment described by the
+// pyvenv.cfg settings was created with the interpreter
+func (interpreter pythonInterpreter) createdVenv(config venvConfig) bool {
+	if config.Executable != "" {
+		executable, err := filepath.EvalSymlinks(config.Executable)
+		if err != nil {
+			executable = config.Executable
+		}
+		return executable == interpreter.Executable
+	}
+
+	if config.Home == "" || config.Version != interpreter.Version {
+		return false
+	}
+
+	home, err := filepath.EvalSymlinks(config.Home)
+	if err != nil {
+		home = config.Home
+	}
+	return filepath.Dir(interpreter.Path) == config.Home || filepath.Dir(interpreter.Executable) == home
+}
+
+// marks the interpreter the virtual environment of the project
+// was created with, adding it when the search did not find it
+func markProjectInterpreter(interpreters []pythonInterpreter) ([]pythonInterpreter, error) {
+	config, err := readVenvConfig()
+	if err != nil || config == nil {
+		return interpreters, err
+	}
+
+	for i := range interpreters {
+		if interpreters[i].createdVenv(*config) {
+			interpreters[i].Project = true
+			return interpreters, nil
+		}
+	}
+
+	if config.Executable != "" {
+		if interpreter, err := queryPythonInterpreter(config.Executable); err == nil {
+			interpreter.Project = true
+			interpreters = append(interpreters, interpreter)
+		}
+	}
+
+	return interpreters, nil
+}
+
+// writes the interpreters as a table, or as a JSON array for scripts
+// the interpreter of the project virtual environment is marked with *
+func writePythonInterpreters(w io.Writer, interpreters []pythonInterpreter, asJSON bool) error {
+	if asJSON {
+		if interpreters == nil {
+			interpreters = []pythonInterpreter{}
+		}
+		return writeJSON(w, interpreters)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, interpreter := range interpreters {
+		marker := " "
+		if interpreter.Project {
+			marker = "*"
+		}
+		fmt.Fprintf(table, "%s %s\t%s\t%s\t%s\n", marker, interpreter.Version, interpreter.Implementation, interpreter.Architecture, interpreter.Path)
+	}
+
+	return table.Flush()
+}
+
+// writes the value as indented JSON
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+func TestPythonVersionMatches(t *testing.T) {
+	cases := []struct {
+		request  string
+		version  string
+		expected bool
+	}{
+		{"", "3.8.10", true},
+		{"3", "3.12.1", true},
+		{"3.11", "3.11.7", true},
+		{"3.11", "3.1.0", false},
+		{"3.11", "3.12.0", false},
+		{"3.11.7", "3.11.7", true},
+		{"3.11.7", "3.11.8", false},
+		{">=3.10", "3.11.7", true},
+		{">=3.10,<3.12", "3.12.0", false},
+		{">= 3.10, < 3.13", "3.12.3", true},
+		{"==3.11.*", "3.11.2", true},
+		{"!=3.11.*", "3.11.2", false},
+		{"~=3.10", "3.12.0", true},
+		{"~=3.10.2", "3.11.0", false},
+		{">3.9", "3.9.18", true},
+		{"<=3.9", "3.9.18", false},
+		{">=3.12", "3.13.0rc1", true},
+	}
+
+	for _, c := range cases {
+		actual, err := pythonVersionMatches(c.request, c.version)
+		if err != nil {
+			t.Errorf("pythonVersionMatches(%q, %q) failed: %v", c.request, c.version, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("pythonVersionMatches(%q, %q): expected %v, received %v", c.request, c.version, c.expected, actual)
+		}
+	}
+}
+
+func TestInvalidPythonVersion(t *testing.T) {
+	for _, request := range []string{"latest", ">=3.x", "~=3", ">=3.*", "3.11,"} {
+		if _, err := pythonVersionMatches(request, "3.11.7"); err == nil {
+			t.Errorf("expected %q to fail", request)
+		}
+	}
+}
+
+func TestFindPythonInterpreter(t *testing.T) {
+	interpreters := []pythonInterpreter{
+		{Path: "/usr/bin/python3.12", Version: "3.12.1"},
+		{Path: "/usr/bin/python3.11", Version: "3.11.7"},
+		{Path: "/usr/bin/python3.8", Version: "3.8.18"},
+	}
+
+	interpreter, err := findPythonInterpreter("<3.12", interpreters)
+	if err != nil {
+		t.Fatalf("findPythonInterpreter failed: %v", err)
+	}
+	if interpreter.Path != "/usr/bin/python3.11" {
+		t.Errorf("expected the newest matching interpreter, received %s", interpreter.Path)
+	}
+
+	_, err = findPythonInterpreter("3.10", interpreters)
+	if err == nil {
+		t.Fatalf("expected a missing version to fail")
+	}
+	expected := "no python interpreter satisfies 3.10, found: 3.12.1 (/usr/bin/python3.12), 3.11.7 (/usr/bin/python3.11), 3.8.18 (/usr/bin/python3.8)"
+	if err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReadPythonVersionFile(t *testing.T) {
+	setupTempDirectory(t)
+
+	version, err := readPythonVersionFile()
+	if err != nil || version != "" {
+		t.Fatalf("expected no version without the file, received %q, %v", version, err)
+	}
+
+	if err := os.WriteFile(pythonVersionFileName, []byte("# project python\n3.11\n"), 0644); err != nil {
+		t.Fatalf("failed to write .python-version: %v", err)
+	}
+
+	version, err = readPythonVersionFile()
+	if err != nil {
+		t.Fatalf("readPythonVersionFile failed: %v", err)
+	}
+	if version != "3.11" {
+		t.Errorf("expected 3.11, received %q", version)
+	}
+}
+
+func TestDiscoverPythonInterpreters(t *testing.T) {
+	if _, err := getGlobalPythonPath(); err != nil {
+		t.Skip("Python not found on system, skipping test")
+	}
+
+	interpreters := discoverPythonInterpreters()
+	if len(interpreters) == 0 {
+		t.Fatalf("expected at least one interpreter")
+	}
+
+	for i, interpreter := range interpreters {
+		if interpreter.Version == "" || interpreter.Executable == "" {
+			t.Errorf("interpreter was not queried: %+v", interpreter)
+		}
+		if i > 0 && pep440.MustParse(interpreters[i-1].Version).Compare(pep440.MustParse(interpreter.Version)) < 0 {
+			t.Errorf("interpreters are not sorted by version")
+		}
+	}
+}
+
+func TestInterpreterCreatedVenv(t *testing.T) {
+	interpreter := pythonInterpreter{Path: "/usr/bin/python3", Version: "3.11.7", Executable: "/usr/bin/python3.11"}
+
+	cases := []struct {
+		config   venvConfig
+		expected bool
+	}{
+		{venvConfig{Home: "/usr/bin", Version: "3.11.7", Executable: "/usr/bin/python3.11"}, true},
+		{venvConfig{Home: "/usr/bin", Version: "3.11.7", Executable: "/usr/local/bin/python3.11"}, false},
+		{venvConfig{Home: "/usr/bin", Version: "3.11.7"}, true},
+		{venvConfig{Home: "/usr/bin", Version: "3.8.18"}, false},
+		{venvConfig{Home: "/opt/python/bin", Version: "3.11.7"}, false},
+	}
+
+	for _, c := range cases {
+		if actual := interpreter.createdVenv(c.config); actual != c.expected {
+			t.Errorf("createdVenv(%+v): expected %v, received %v", c.config, c.expected, actual)
+		}
+	}
+}
+
+func TestWritePythonInterpreters(t *testing.T) {
+	interpreters := []pythonInterpreter{
+		{Path: "/usr/bin/python3.12", Version: "3.12.1", Implementation: "CPython", Architecture: "x86_64"},
+		{Path: "/opt/pypy/bin/python", Version: "3.10.13", Implementation: "PyPy", Architecture: "x86_64", Project: true},
+	}
+
+	var table strings.Builder
+	if err := writePythonInterpreters(&table, interpreters, false); err != nil {
+		t.Fatalf("writePythonInterpreters failed: %v", err)
+	}
+
+	expected := "  3.12.1   CPython  x86_64  /usr/bin/python3.12\n" +
+		"* 3.10.13  PyPy     x86_64  /opt/pypy/bin/python\n"
+	if table.String() != expected {
+		t.Errorf("unexpected table:\n%s", table.String())
+	}
+
+	var output strings.Builder
+	if err := writePythonInterpreters(&output, nil, true); err != nil {
+		t.Fatalf("writePythonInterpreters failed: %v", err)
+	}
+	if output.String() != "[]\n" {
+		t.Errorf("expected an empty JSON array, received %q", output.String())
+	}
+}
+
+func TestProjectPythonRequest(t *testing.T) {
+	setupTempDirectory(t)
+
+	if err := os.WriteFile("pyproject.toml", []byte("[project]\nname = \"service\"\nrequires-python = \">=3.10\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pyproject.toml: %v", err)
+	}
+
+	request, source, err := projectPythonRequest()
+	if err != nil {
+		t.Fatalf("projectPythonRequest failed: %v", err)
+	}
+	if request != ">=3.10" || source != "pyproject.toml" {
+		t.Errorf("unexpected request %q from %q", request, source)
+	}
+
+	if err := os.WriteFile(pythonVersionFileName, []byte("3.12\n"), 0644); err != nil {
+		t.Fatalf("failed to write .python-version: %v", err)
+	}
+
+	request, source, err = projectPythonRequest()
+	if err != nil {
+		t.Fatalf("projectPythonRequest failed: %v", err)
+	}
+	if request != "3.12" || source != pythonVersionFileName {
+		t.Errorf("expected .python-version to take precedence, received %q from %q", request, source)
+	}
+}
+
+func TestVenvPythonMismatch(t *testing.T) {
+	setupTempDirectory(t)
+
+	if err := os.MkdirAll(".venv/bin", 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(".venv/bin/python", nil, 0755); err != nil {
+		t.Fatalf("failed to create venv python: %v", err)
+	}
+	if err := os.WriteFile(".venv/pyvenv.cfg", []byte("home = /usr/bin\nversion = 3.8.18\n"), 0644); err != nil {
+		t.Fatalf("failed to write pyvenv.cfg: %v", err)
+	}
+
+	mismatch, err := venvPythonMismatch()
+	if err != nil || mismatch != "" {
+		t.Fatalf("expected no mismatch without a declared version, received %q, %v", mismatch, err)
+	}
+
+	if err := os.WriteFile(pythonVersionFileName, []byte("3.12\n"), 0644); err != nil {
+		t.Fatalf("failed to write .python-version: %v", err)
+	}
+
+	mismatch, err = venvPythonMismatch()
+	if err != nil {
+		t.Fatalf("venvPythonMismatch failed: %v", err)
+	}
+	if mismatch != "the virtual environment uses Python 3.8.18 but .python-version requires 3.12" {
+		t.Errorf("unexpected mismatch: %q", mismatch)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// a single requirement as described by PEP 508,
+// extended with the pip specific parts of a requirements file line
+type requirement struct {
+	Name      string   // project name as written by the user
+	Extras    []string // optional extras, e.g. [socks]
+	Specifier string   // version specifiers joined by commas, e.g. ">=2.0,<3"
+	URL       string   // direct reference (name @ url) or a bare url/path
+	Marker    string   // environment marker written after ';'
+	Hashes    []string // values of --hash options, e.g. sha256:abcd...
+	Editable  bool     // requirement was given with -e/--editable
+}
+
+var (
+	nameRegex          = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?`)
+	nameSeparatorRegex = regexp.MustCompile(`[-_.]+`)
+	specifierRegex     = regexp.MustCompile(`^(~=|===|==|!=|<=|>=|<|>)\s*([^\s,;()]+)$`)
+	versionRegex       = regexp.MustCompile(`^[A-Za-z0-9_.*+!-]+$`)
+	eggRegex           = regexp.MustCompile(`(?:^|&)egg=([^&]+)`)
+	wheelNameRegex     = regexp.MustCompile(`^([A-Za-z0-9](?:[A-Za-z0-9._]*[A-Za-z0-9])?)-\d`)
+	urlSchemeRegex     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://`)
+)
+
+// returns the PEP 503 normalized form of a project name
+// e.g. "Foo.Bar_baz" becomes "foo-bar-baz"
+func normalizeName(name string) string {
+	return strings.ToLower(nameSeparatorRegex.ReplaceAllString(name, "-"))
+}
+
+// returns the canonical name used to compare requirements
+// references without a known name are compared by their url
+func (r requirement) key() string {
+	if r.Name == "" {
+		return r.URL
+	}
+	return normalizeName(r.Name)
+}
+
+// returns the requirement formatted as a requirements file line
+func (r requirement) String() string {
+	var b strings.Builder
+
+	if r.Editable {
+		b.WriteString("-e ")
+	}
+
+	if r.URL != "" && (r.Name == "" || r.Editable || !isDirectReference(r.URL)) {
+		// pip only understands bare urls and paths for these
+		b.WriteString(r.URL)
+	} else {
+		b.WriteString(r.Name)
+		if len(r.Extras) > 0 {
+			b.WriteString("[" + strings.Join(r.Extras, ",") + "]")
+		}
+		if r.URL != "" {
+			b.WriteString(" @ " + r.URL)
+		} else {
+			b.WriteString(r.Specifier)
+		}
+	}
+
+	if r.Marker != "" {
+		if r.URL != "" {
+			// a url must be separated from the marker by whitespace
+			b.WriteString(" ; " + r.Marker)
+		} else {
+			b.WriteString("; " + r.Marker)
+		}
+	}
+
+	for _, hash := range r.Hashes {
+		b.WriteString(" --hash=" + hash)
+	}
+
+	return b.String()
+}
+
+// returns true if the reference is a local path or a vcs url
+// that pip accepts without the "name @" prefix
+func isBareReference(ref string) bool {
+	return strings.HasPrefix(ref, ".") || strings.HasPrefix(ref, "/") ||
+		strings.HasPrefix(ref, "~") || strings.HasPrefix(ref, "file:") ||
+		(urlSchemeRegex.MatchString(ref) && strings.Contains(strings.SplitN(ref, "://", 2)[0], "+"))
+}
+
+// returns true if the url can be written as "name @ url"
+// local paths and vcs urls naming their egg stay bare
+func isDirectReference(url string) bool {
+	return urlSchemeRegex.MatchString(url) && !eggRegex.MatchString(strings.SplitN(url+"#", "#", 2)[1])
+}
+
+// returns true if the text starts like a url or a path
+// instead of a project name
+func looksLikeReference(text string) bool {
+	if isBareReference(text) || urlSchemeRegex.MatchString(text) {
+		return true
+	}
+	if strings.Contains(text, "@") {
+		// "name @ url" is a regular PEP 508 requirement
+		return false
+	}
+
+	lower := strings.ToLower(strings.Fields(text)[0])
+	for _, ext := range []string{".whl", ".tar.gz", ".zip", ".tar.bz2", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parses a single requirement line as written in a requirements file
+// the line must not contain comments or line continuations
+func parseRequirement(line string) (requirement, error) {
+	var req requirement
+
+	text, options := splitRequirementOptions(strings.TrimSpace(line))
+
+	for i := 0; i < len(options); i++ {
+		option := options[i]
+		switch {
+		case strings.HasPrefix(option, "--hash="):
+			req.Hashes = append(req.Hashes, strings.TrimPrefix(option, "--hash="))
+		case option == "--hash" && i+1 < len(options):
+			i++
+			req.Hashes = append(req.Hashes, options[i])
+		default:
+			return requirement{}, fmt.Errorf("unsupported option %q in requirement %q", option, line)
+		}
+	}
+
+	for _, prefix := range []string{"-e ", "--editable ", "--editable="} {
+		if strings.HasPrefix(text, prefix) {
+			req.Editable = true
+			text = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+			break
+		}
+	}
+
+	if text == "" {
+		return requirement{}, fmt.Errorf("empty requirement")
+	}
+
+	if req.Editable || looksLikeReference(text) {
+		return parseReferenceRequirement(req, text)
+	}
+
+	return parsePEP508Requirement(req, text)
+}
+
+// splits trailing pip options (e.g. --hash) from the requirement text
+func splitRequirementOptions(line string) (string, []string) {
+	inQuote := rune(0)
+
+	for i, ch := range line {
+		switch {
+		case inQuote != 0:
+			if ch == inQuote {
+				inQuote = 0
+			}
+		case ch == '\'' || ch == '"':
+			inQuote = ch
+		case ch == '-' && i > 0 && strings.HasPrefix(line[i:], "--") &&
+			(line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimSpace(line[:i]), strings.Fields(line[i:])
+		}
+	}
+
+	return line, nil
+}
+
+// parses a bare url or path requirement, e.g.
+// "git+https://github.com/psf/requests#egg=requests" or "./dist/pkg-1.0.whl"
+func parseReferenceRequirement(req requirement, text string) (requirement, error) {
+	reference := text
+
+	// pip requires whitespace before the marker separator in urls
+	if i := strings.Index(text, " ;"); i >= 0 {
+		reference = strings.TrimSpace(text[:i])
+		req.Marker = strings.TrimSpace(text[i+2:])
+	} else if i := strings.Index(text, "; "); i >= 0 && !strings.Contains(text[:i], "://") {
+		reference = strings.TrimSpace(text[:i])
+		req.Marker = strings.TrimSpace(text[i+1:])
+	}
+
+	req.URL = reference
+
+	if _, fragment, found := strings.Cut(reference, "#"); found {
+		if match := eggRegex.FindStringSubmatch(fragment); match != nil {
+			name, extras, _ := strings.Cut(match[1], "[")
+			req.Name = name
+			if extras != "" {
+				req.Extras = splitExtras(strings.TrimSuffix(extras, "]"))
+			}
+		}
+	}
+
+	if req.Name == "" {
+		base := path.Base(strings.SplitN(reference, "#", 2)[0])
+		if match := wheelNameRegex.FindStringSubmatch(base); match != nil {
+			req.Name = match[1]
+		}
+	}
+
+	return req, nil
+}
+
+// parses a PEP 508 dependency specification, e.g.
+// "requests[socks]>=2.8.1,==2.8.*; python_version < '2.7'"
+func parsePEP508Requirement(req requirement, text string) (requirement, error) {
+	name := nameRegex.FindString(text)
+	if name == "" {
+		return requirement{}, fmt.Errorf("invalid requirement %q: expected a project name", text)
+	}
+	req.Name = name
+	rest := strings.TrimSpace(text[len(name):])
+
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return requirement{}, fmt.Errorf("invalid requirement %q: unclosed extras", text)
+		}
+		req.Extras = splitExtras(rest[1:end])
+		for _, extra := range req.Extras {
+			if nameRegex.FindString(extra) != extra {
+				return requirement{}, fmt.Errorf("invalid requirement %q: invalid extra %q", text, extra)
+			}
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if strings.HasPrefix(rest, "@") {
+		rest = strings.TrimSpace(rest[1:])
+		url := rest
+		if i := strings.Index(rest, " ;"); i >= 0 {
+			url = strings.TrimSpace(rest[:i])
+			req.Marker = strings.TrimSpace(rest[i+2:])
+		} else if strings.ContainsAny(rest, " \t") {
+			return requirement{}, fmt.Errorf("invalid requirement %q: unexpected text after url", text)
+		}
+		if url == "" {
+			return requirement{}, fmt.Errorf("invalid requirement %q: missing url after @", text)
+		}
+		req.URL = url
+		return req, nil
+	}
+
+	specifier := rest
+	if i := strings.Index(rest, ";"); i >= 0 {
+		specifier = strings.TrimSpace(rest[:i])
+		req.Marker = strings.TrimSpace(rest[i+1:])
+		if req.Marker == "" {
+			return requirement{}, fmt.Errorf("invalid requirement %q: empty marker", text)
+		}
+	}
+
+	if strings.HasPrefix(specifier, "(") {
+		if !strings.HasSuffix(specifier, ")") {
+			return requirement{}, fmt.Errorf("invalid requirement %q: unclosed parenthesis", text)
+		}
+		specifier = strings.TrimSpace(specifier[1 : len(specifier)-1])
+	}
+
+	if specifier != "" {
+		normalized, err := normalizeSpecifier(specifier)
+		if err != nil {
+			return requirement{}, fmt.Errorf("invalid requirement %q: %v", text, err)
+		}
+		req.Specifier = normalized
+	}
+
+	return req, nil
+}
+
+// validates a comma separated list of version specifiers and
+// returns it without insignificant whitespace
+func normalizeSpecifier(specifier string) (string, error) {
+	var clauses []string
+
+	for _, clause := range strings.Split(specifier, ",") {
+		match := specifierRegex.FindStringSubmatch(strings.TrimSpace(clause))
+		if match == nil {
+			return "", fmt.Errorf("invalid version specifier %q", strings.TrimSpace(clause))
+		}
+		if match[1] != "===" && !versionRegex.MatchString(match[2]) {
+			return "", fmt.Errorf("invalid version %q", match[2])
+		}
+		clauses = append(clauses, match[1]+match[2])
+	}
+
+	return strings.Join(clauses, ","), nil
+}
+
+// splits a comma separated list of extras
+func splitExtras(extras string) []string {
+	var result []string
+	for _, extra := range strings.Split(extras, ",") {
+		if extra = strings.TrimSpace(extra); extra != "" {
+			result = append(result, extra)
+		}
+	}
+	return result
+}
+
+// removes a trailing comment from a requirements file line
+// pip only treats '#' as a comment when it starts the line
+// or is preceded by whitespace
+func stripComment(line string) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return ""
+	}
+
+	for i := 1; i < len(line); i++ {
+		if line[i] == '#' && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// returns true if the line is a pip option such as -r, -c or --index-url
+// rather than a requirement
+func isOptionLine(line string) bool {
+	if !strings.HasPrefix(line, "-") {
+		return false
+	}
+	for _, prefix := range []string{"-e ", "--editable ", "--editable="} {
+		if strings.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// parses the requirements out of the contents of a requirements file
+// comments, blank lines and pip options are skipped
+func parseRequirements(content string) ([]requirement, error) {
+	doc, err := parseRequirementsDocument(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.requirements(), nil
+}
+
+// parses every passed argument as a requirement
+func parseRequirementArgs(args []string) ([]requirement, error) {
+	requirements := make([]requirement, 0, len(args))
+	for _, arg := range args {
+		req, err := parseRequirement(arg)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, req)
+	}
+	return requirements, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	cases := map[string]string{
+		"requests":         "requests",
+		"Django":           "django",
+		"Foo.Bar_baz":      "foo-bar-baz",
+		"zope.interface":   "zope-interface",
+		"typing__-.extras": "typing-extras",
+	}
+
+	for name, expected := range cases {
+		if actual := normalizeName(name); actual != expected {
+			t.Errorf("normalizeName(%q): expected %q, received %q", name, expected, actual)
+		}
+	}
+}
+
+func TestParseRequirement(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected requirement
+	}{
+		{"requests", requirement{Name: "requests"}},
+		{"requests==2.31.0", requirement{Name: "requests", Specifier: "==2.31.0"}},
+		{"Requests[socks, security] >= 2, < 3", requirement{Name: "Requests", Extras: []string{"socks", "security"}, Specifier: ">=2,<3"}},
+		{"name (>=1.0)", requirement{Name: "name", Specifier: ">=1.0"}},
+		{"numpy~=1.26; python_version >= '3.9'", requirement{Name: "numpy", Specifier: "~=1.26", Marker: "python_version >= '3.9'"}},
+		{"pywin32 ; sys_platform == \"win32\"", requirement{Name: "pywin32", Marker: "sys_platform == \"win32\""}},
+		{"pip @ https://github.com/pypa/pip/archive/22.0.zip", requirement{Name: "pip", URL: "https://github.com/pypa/pip/archive/22.0.zip"}},
+		{"pip @ file:///tmp/pip.zip ; os_name == 'posix'", requirement{Name: "pip", URL: "file:///tmp/pip.zip", Marker: "os_name == 'posix'"}},
+		{"git+https://github.com/psf/requests@main#egg=requests", requirement{Name: "requests", URL: "git+https://github.com/psf/requests@main#egg=requests"}},
+		{"./dist/my_pkg-1.0-py3-none-any.whl", requirement{Name: "my_pkg", URL: "./dist/my_pkg-1.0-py3-none-any.whl"}},
+		{"-e ./local/package", requirement{URL: "./local/package", Editable: true}},
+		{"flask==3.0.0 --hash=sha256:aaa --hash sha256:bbb", requirement{Name: "flask", Specifier: "==3.0.0", Hashes: []string{"sha256:aaa", "sha256:bbb"}}},
+	}
+
+	for _, c := range cases {
+		actual, err := parseRequirement(c.line)
+		if err != nil {
+			t.Errorf("parseRequirement(%q) failed: %v", c.line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("parseRequirement(%q): expected %+v, received %+v", c.line, c.expected, actual)
+		}
+	}
+}
+
+func TestParseInvalidRequirement(t *testing.T) {
+	for _, line := range []string{"", "==1.0", "requests[socks", "requests >>= 2", "requests; ", "pip @ ", "flask --no-binary"} {
+		if _, err := parseRequirement(line); err == nil {
+			t.Errorf("expected parseRequirement(%q) to fail", line)
+		}
+	}
+}
+
+func TestRequirementString(t *testing.T) {
+	for _, line := range []string{
+		"requests",
+		"Requests[socks,security]>=2,<3",
+		"numpy~=1.26; python_version >= '3.9'",
+		"pip @ file:///tmp/pip.zip ; os_name == 'posix'",
+		"git+https://github.com/psf/requests@main#egg=requests",
+		"-e ./local/package",
+		"flask==3.0.0 --hash=sha256:aaa",
+	} {
+		req, err := parseRequirement(line)
+		if err != nil {
+			t.Fatalf("parseRequirement(%q) failed: %v", line, err)
+		}
+
+		if req.String() != line {
+			t.Errorf("expected %q, received %q", line, req.String())
+		}
+	}
+}
+
+func TestParseRequirements(t *testing.T) {
+	content := "# production dependencies\n" +
+		"-r base.txt\n" +
+		"--index-url https://pypi.org/simple\n" +
+		"\n" +
+		"requests==2.31.0  # pinned for the api client\n" +
+		"flask \\\n" +
+		"    >=3.0 \\\n" +
+		"    --hash=sha256:abc\n" +
+		"-e git+https://github.com/org/tool#egg=tool\n"
+
+	requirements, err := parseRequirements(content)
+	if err != nil {
+		t.Fatalf("parseRequirements failed: %v", err)
+	}
+
+	var names []string
+	for _, req := range requirements {
+		names = append(names, req.key())
+	}
+
+	if !reflect.DeepEqual(names, []string{"requests", "flask", "tool"}) {
+		t.Fatalf("unexpected requirements: %v", names)
+	}
+
+	if requirements[1].Specifier != ">=3.0" || len(requirements[1].Hashes) != 1 {
+		t.Errorf("continuation lines were not joined: %+v", requirements[1])
+	}
+}
+
+func TestRemovePackagesMatchesCanonicalName(t *testing.T) {
+	setupTempRequirements(t, []string{"requests==2.31.0", "Flask_Login[extra]>=0.6", "numpy"})
+
+	err := removePackagesFromManifest([]string{"Requests", "flask-login"}, dependencySection{})
+	if err != nil {
+		t.Fatalf("removePackagesFromManifest failed: %v", err)
+	}
+
+	packages, err := getPackagesFromRequirements()
+	if err != nil {
+		t.Fatalf("getPackagesFromRequirements failed: %v", err)
+	}
+
+	if len(packages) != 1 || packages[0] != "numpy" {
+		t.Errorf("unexpected packages: %v", packages)
+	}
+}
+
+func TestAddPackagesUpdatesSpecifier(t *testing.T) {
+	setupTempRequirements(t, []string{"requests>=2", "numpy"})
+
+	err := addPackagesToManifest([]string{"REQUESTS==2.31.0", "Numpy", "flask"}, dependencySection{})
+	if err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+
+	packages, err := getPackagesFromRequirements()
+	if err != nil {
+		t.Fatalf("getPackagesFromRequirements failed: %v", err)
+	}
+
+	expected := []string{"REQUESTS==2.31.0", "numpy", "flask"}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("expected %v, received %v", expected, packages)
+	}
+}
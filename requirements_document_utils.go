@@ -0,0 +1,233 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// a lossless model of a requirements file
+// every line that pvm does not touch is written back exactly as read
+type requirementsDocument struct {
+	entries         []*documentEntry
+	newline         string // line ending used by the file
+	trailingNewline bool   // true if the file ends with a line ending
+}
+
+// a logical line of a requirements file, which may span several
+// physical lines joined with backslash continuations
+type documentEntry struct {
+	raw     string       // original text without the final line ending
+	req     *requirement // nil for comments, blank lines and pip options
+	comment string       // inline comment including the whitespace before it
+}
+
+// parses the contents of a requirements file into a document
+func parseRequirementsDocument(content string) (*requirementsDocument, error) {
+	doc := &requirementsDocument{newline: "\n"}
+	if strings.Contains(content, "\r\n") {
+		doc.newline = "\r\n"
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+
+	if content == "" {
+		return doc, nil
+	}
+
+	physical := strings.Split(content, "\n")
+	if physical[len(physical)-1] == "" {
+		doc.trailingNewline = true
+		physical = physical[:len(physical)-1]
+	}
+
+	var group []string
+	for i, line := range physical {
+		group = append(group, line)
+		if strings.HasSuffix(line, "\\") && i < len(physical)-1 {
+			continue
+		}
+
+		entry, err := parseDocumentEntry(group)
+		if err != nil {
+			return nil, err
+		}
+		doc.entries = append(doc.entries, entry)
+		group = nil
+	}
+
+	return doc, nil
+}
+
+// parses the physical lines of a single logical line
+func parseDocumentEntry(lines []string) (*documentEntry, error) {
+	entry := &documentEntry{raw: strings.Join(lines, "\n")}
+
+	var logical strings.Builder
+	for _, line := range lines {
+		logical.WriteString(strings.TrimSuffix(line, "\\"))
+	}
+
+	line := logical.String()
+	text := stripComment(line)
+	if len(lines) == 1 && len(text) < len(line) {
+		// keep the original spacing in front of the comment
+		entry.comment = line[len(strings.TrimRight(text, " \t")):]
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" || isOptionLine(text) {
+		return entry, nil
+	}
+
+	req, err := parseRequirement(text)
+	if err != nil {
+		return nil, err
+	}
+	entry.req = &req
+
+	return entry, nil
+}
+
+// returns the requirements of the document in file order
+func (d *requirementsDocument) requirements() []requirement {
+	var requirements []requirement
+	for _, entry := range d.entries {
+		if entry.req != nil {
+			requirements = append(requirements, *entry.req)
+		}
+	}
+	return requirements
+}
+
+// returns the requirement with the passed canonical name
+func (d *requirementsDocument) find(key string) (requirement, bool) {
+	for _, entry := range d.entries {
+		if entry.req != nil && entry.req.key() == key {
+			return *entry.req, true
+		}
+	}
+	return requirement{}, false
+}
+
+// updates the entries for the requirement in place, keeping their inline
+// comments, or inserts it after the last requirement of the document
+// entries of the same package under another marker are left alone, except
+// when the requirement has no marker and replaces them all
+// returns true if the document changed
+func (d *requirementsDocument) set(req requirement) bool {
+	last := -1
+	var sameName, matching []int
+
+	for i, entry := range d.entries {
+		if entry.req == nil {
+			continue
+		}
+		last = i
+
+		if entry.req.key() != req.key() {
+			continue
+		}
+		sameName = append(sameName, i)
+		if sameMarker(entry.req.Marker, req.Marker) {
+			matching = append(matching, i)
+		}
+	}
+
+	if len(matching) == 0 && req.Marker == "" {
+		matching = sameName
+	}
+
+	if len(matching) > 0 {
+		changed := false
+
+		// the first entry is rewritten and the others are dropped
+		entry := d.entries[matching[0]]
+		if entry.req.String() != req.String() {
+			updated := req
+			entry.req = &updated
+			entry.raw = req.String() + entry.comment
+			changed = true
+		}
+
+		for _, i := range slices.Backward(matching[1:]) {
+			d.entries = slices.Delete(d.entries, i, i+1)
+			changed = true
+		}
+
+		return changed
+	}
+
+	added := req
+	entry := &documentEntry{raw: req.String(), req: &added}
+
+	if len(d.entries) == 0 {
+		// a newly written file ends with a line ending
+		d.trailingNewline = true
+	}
+
+	// the package stays next to its entries under other markers
+	if len(sameName) > 0 {
+		last = sameName[len(sameName)-1]
+	}
+
+	if last < 0 {
+		d.entries = append(d.entries, entry)
+	} else {
+		d.entries = slices.Insert(d.entries, last+1, entry)
+	}
+
+	return true
+}
+
+// returns true if the markers are the same, ignoring whitespace
+// and the kind of quotes
+func sameMarker(a string, b string) bool {
+	normalize := func(marker string) string {
+		return strings.ReplaceAll(strings.Join(strings.Fields(marker), ""), "'", `"`)
+	}
+	return normalize(a) == normalize(b)
+}
+
+// removes every entry for the passed canonical name
+// returns true if the document changed
+func (d *requirementsDocument) remove(key string) bool {
+	var kept []*documentEntry
+	for _, entry := range d.entries {
+		if entry.req == nil || entry.req.key() != key {
+			kept = append(kept, entry)
+		}
+	}
+
+	removed := len(kept) != len(d.entries)
+	d.entries = kept
+	return removed
+}
+
+// returns the document formatted as file contents
+func (d *requirementsDocument) String() string {
+	var lines []string
+	for _, entry := range d.entries {
+		lines = append(lines, strings.ReplaceAll(entry.raw, "\n", d.newline))
+	}
+
+	content := strings.Join(lines, d.newline)
+	if d.trailingNewline && len(lines) > 0 {
+		content += d.newline
+	}
+	return content
+}
+
+// reads and parses the requirements file at the passed path
+func loadRequirementsDocument(path string) (*requirementsDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRequirementsDocument(string(data))
+}
+
+// writes the document to the passed path
+func (d *requirementsDocument) save(path string) error {
+	return os.WriteFile(path, []byte(d.String()), 0644)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+const curatedRequirements = `# Production dependencies
+-r base.txt
+-c constraints.txt
+--index-url https://pypi.org/simple
+
+requests==2.31.0  # pinned for the api client
+Flask>=3.0 \
+    --hash=sha256:abc
+
+# Data
+numpy
+`
+
+func TestRequirementsDocumentRoundTrip(t *testing.T) {
+	for _, content := range []string{
+		curatedRequirements,
+		"requests\r\nflask  # web\r\n",
+		"requests\nflask",
+		"",
+	} {
+		doc, err := parseRequirementsDocument(content)
+		if err != nil {
+			t.Fatalf("parseRequirementsDocument failed: %v", err)
+		}
+
+		if doc.String() != content {
+			t.Errorf("document changed during round trip: expected %q, received %q", content, doc.String())
+		}
+	}
+}
+
+func TestRequirementsDocumentSet(t *testing.T) {
+	doc, err := parseRequirementsDocument(curatedRequirements)
+	if err != nil {
+		t.Fatalf("parseRequirementsDocument failed: %v", err)
+	}
+
+	if !doc.set(requirement{Name: "requests", Specifier: "==2.32.0"}) {
+		t.Fatalf("expected requests to be updated")
+	}
+	if !doc.set(requirement{Name: "pandas"}) {
+		t.Fatalf("expected pandas to be added")
+	}
+	if doc.set(requirement{Name: "numpy"}) {
+		t.Errorf("expected unchanged requirement to leave the document unchanged")
+	}
+
+	expected := `# Production dependencies
+-r base.txt
+-c constraints.txt
+--index-url https://pypi.org/simple
+
+requests==2.32.0  # pinned for the api client
+Flask>=3.0 \
+    --hash=sha256:abc
+
+# Data
+numpy
+pandas
+`
+	if doc.String() != expected {
+		t.Errorf("unexpected document:\n%s", doc.String())
+	}
+}
+
+func TestRequirementsDocumentSetWithMarkers(t *testing.T) {
+	doc, err := parseRequirementsDocument("foo==1; sys_platform == \"win32\"  # windows build\nfoo==2; sys_platform != \"win32\"\nbar\n")
+	if err != nil {
+		t.Fatalf("parseRequirementsDocument failed: %v", err)
+	}
+
+	if !doc.set(requirement{Name: "foo", Specifier: "==3", Marker: "sys_platform!='win32'"}) {
+		t.Fatalf("expected the entry with the same marker to be updated")
+	}
+	if !doc.set(requirement{Name: "foo", Specifier: "==4", Marker: "sys_platform == \"darwin\""}) {
+		t.Fatalf("expected an entry with a new marker to be added")
+	}
+
+	expected := "foo==1; sys_platform == \"win32\"  # windows build\nfoo==3; sys_platform!='win32'\nfoo==4; sys_platform == \"darwin\"\nbar\n"
+	if doc.String() != expected {
+		t.Errorf("unexpected document:\n%s", doc.String())
+	}
+
+	// a requirement without a marker replaces every entry of the package
+	if !doc.set(requirement{Name: "foo", Specifier: "==5"}) {
+		t.Fatalf("expected the entries to be replaced")
+	}
+	if doc.String() != "foo==5  # windows build\nbar\n" {
+		t.Errorf("unexpected document:\n%s", doc.String())
+	}
+}
+
+func TestRequirementsDocumentRemove(t *testing.T) {
+	doc, err := parseRequirementsDocument(curatedRequirements)
+	if err != nil {
+		t.Fatalf("parseRequirementsDocument failed: %v", err)
+	}
+
+	if !doc.remove("flask") {
+		t.Fatalf("expected flask to be removed")
+	}
+	if doc.remove("django") {
+		t.Errorf("expected removing a missing requirement to leave the document unchanged")
+	}
+
+	expected := `# Production dependencies
+-r base.txt
+-c constraints.txt
+--index-url https://pypi.org/simple
+
+requests==2.31.0  # pinned for the api client
+
+# Data
+numpy
+`
+	if doc.String() != expected {
+		t.Errorf("unexpected document:\n%s", doc.String())
+	}
+}
+
+func TestRequirementsDocumentSetOnEmptyFile(t *testing.T) {
+	doc, err := parseRequirementsDocument("")
+	if err != nil {
+		t.Fatalf("parseRequirementsDocument failed: %v", err)
+	}
+
+	doc.set(requirement{Name: "requests"})
+	doc.set(requirement{Name: "flask"})
+
+	if doc.String() != "requests\nflask\n" {
+		t.Errorf("unexpected document: %q", doc.String())
+	}
+}
+
+func TestInstallAndUninstallKeepCuratedContent(t *testing.T) {
+	reqPath := setupTempRequirements(t, []string{})
+	if err := os.WriteFile(reqPath, []byte(curatedRequirements), 0644); err != nil {
+		t.Fatalf("failed to write requirements.txt: %v", err)
+	}
+
+	if err := addPackagesToManifest([]string{"pandas"}, dependencySection{}); err != nil {
+		t.Fatalf("addPackagesToManifest failed: %v", err)
+	}
+	if err := removePackagesFromManifest([]string{"pandas"}, dependencySection{}); err != nil {
+		t.Fatalf("removePackagesFromManifest failed: %v", err)
+	}
+
+	data, err := os.ReadFile(reqPath)
+	if err != nil {
+		t.Fatalf("failed to read requirements.txt: %v", err)
+	}
+
+	if string(data) != curatedRequirements {
+		t.Errorf("requirements file was not preserved:\n%s", data)
+	}
+}
@@ -0,0 +1,1324 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// the package standing for the project in the resolution
+const resolverRoot = ""
+
+// a set of versions of a package, one entry per version the package
+// index lists, oldest first, followed by an entry for the versions it
+// does not list and an entry for the package not being selected at all
+// a set without that last entry requires the package to be selected
+// a specifier no listed version matches only matches the versions the
+// index does not list, so that requiring it is not always false
+type versionSet []bool
+
+// returns a set of the package without any version
+func emptySet(p *resolverPackage) versionSet {
+	return make(versionSet, len(p.versions)+2)
+}
+
+// returns true if the set holds no version and does not allow the
+// package to be left out
+func (s versionSet) isEmpty() bool {
+	return !slices.Contains(s, true)
+}
+
+func (s versionSet) intersect(other versionSet) versionSet {
+	result := make(versionSet, len(s))
+	for i := range s {
+		result[i] = s[i] && other[i]
+	}
+	return result
+}
+
+func (s versionSet) complement() versionSet {
+	result := make(versionSet, len(s))
+	for i := range s {
+		result[i] = !s[i]
+	}
+	return result
+}
+
+func (s versionSet) subsetOf(other versionSet) bool {
+	for i := range s {
+		if s[i] && !other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s versionSet) union(other versionSet) versionSet {
+	return s.complement().intersect(other.complement()).complement()
+}
+
+// returns the listed versions of the set
+func (s versionSet) versions() []bool {
+	return s[:len(s)-2]
+}
+
+// a statement about the version of a package, such as "flask>=3"
+// or, when the set allows leaving the package out, "not flask>=3"
+type term struct {
+	Package string
+	Set     versionSet
+}
+
+// returns true if the term requires the package to be selected
+func (t term) positive() bool {
+	return !t.Set[len(t.Set)-1]
+}
+
+func (t term) negate() term {
+	return term{Package: t.Package, Set: t.Set.complement()}
+}
+
+// why the terms of an incompatibility cannot all be true
+type incompatibilityKind int
+
+const (
+	causeRoot        incompatibilityKind = iota // the project has to be selected
+	causeDependency                             // a version of a package depends on another package
+	causeNoVersions                             // the index has no version in the set
+	causeUnavailable                            // the versions cannot be installed, see reason
+	causeDerived                                // derived from two other incompatibilities
+)
+
+// a set of terms that cannot all be true at the same time
+type incompatibility struct {
+	terms  []term
+	kind   incompatibilityKind
+	reason string           // why the versions of an unavailable incompatibility cannot be installed
+	left   *incompatibility // the incompatibilities a derived incompatibility was derived from
+	right  *incompatibility
+}
+
+// returns an incompatibility with the terms of the same package intersected
+// the project term is left out of derived incompatibilities, where it is
+// always true and only makes the explanation longer
+func newIncompatibility(terms []term, kind incompatibilityKind) *incompatibility {
+	var merged []term
+	for _, t := range terms {
+		index := slices.IndexFunc(merged, func(m term) bool { return m.Package == t.Package })
+		if index < 0 {
+			merged = append(merged, t)
+		} else {
+			merged[index].Set = merged[index].Set.intersect(t.Set)
+		}
+	}
+
+	if kind == causeDerived && len(merged) > 1 {
+		merged = slices.DeleteFunc(merged, func(t term) bool {
+			return t.Package == resolverRoot && t.positive()
+		})
+	}
+
+	return &incompatibility{terms: merged, kind: kind}
+}
+
+// returns true if the incompatibility rules out every resolution
+func (inc *incompatibility) failure() bool {
+	return len(inc.terms) == 0 || (len(inc.terms) == 1 && inc.terms[0].Package == resolverRoot && inc.terms[0].positive())
+}
+
+// returns the positive and the negative term of a dependency incompatibility
+func (inc *incompatibility) dependency() (term, term) {
+	if inc.terms[0].positive() {
+		return inc.terms[0], inc.terms[1]
+	}
+	return inc.terms[1], inc.terms[0]
+}
+
+// a term the resolver decided or derived
+type assignment struct {
+	term  term
+	level int              // number of decisions made when it was assigned
+	cause *incompatibility // nil for decisions
+}
+
+// a package, or a package with one of its extras, known to the resolver
+type resolverPackage struct {
+	name     string           // canonical project name, empty for the project
+	extra    string           // normalized extra, empty for the package itself
+	versions []pep440.Version // oldest first
+	base     *resolverPackage // the package itself, for packages with an extra
+
+	files        map[string][]indexFile // files of every version, keyed by normalized version
+	specifiers   map[string]string      // version sets named after the specifier they were built from
+	dependencies map[int][]requirement  // requirements of the versions already read
+	artifacts    map[int]indexFile      // file chosen for every version already read
+	unavailable  map[int]string         // why versions cannot be installed
+}
+
+// returns the name of the package as written in explanations
+func (p *resolverPackage) String() string {
+	if p.name == resolverRoot {
+		return "the project"
+	}
+	if p.extra != "" {
+		return p.name + "[" + p.extra + "]"
+	}
+	return p.name
+}
+
+// returns the key of the package with the extra
+func resolverKey(name string, extra string) string {
+	if extra == "" {
+		return normalizeName(name)
+	}
+	return normalizeName(name) + "[" + normalizeName(extra) + "]"
+}
+
+// a distribution chosen by the resolver
+type resolvedPackage struct {
+	Name         string
+	Version      string
+	File         indexFile // the file pip installs on this machine
+	RequiresDist []string
+}
+
+// returned when the requirements cannot be resolved, explaining why
+type resolutionError struct {
+	explanation string
+}
+
+func (e *resolutionError) Error() string {
+	return e.explanation
+}
+
+// resolves requirements to versions on the package indexes, reading the
+// dependencies of every version from its Requires-Dist metadata
+// the resolution follows PubGrub: it decides one package version at a
+// time, derives what every decision implies and, on a conflict, learns
+// the incompatibility causing it and backtracks to the decision that
+// made it possible
+type resolver struct {
+	indexes []*packageIndex
+	env     markerEnvironment
+	python  *pep440.Version // the python version of the environment, nil when unknown
+	roots   []requirement
+
+	mutex    sync.Mutex // guards packages while listings are fetched
+	packages map[string]*resolverPackage
+
+	incompatibilities map[string][]*incompatibility
+	assignments       []assignment
+	decisions         map[string]int        // version index chosen for every decided package
+	accumulated       map[string]versionSet // intersection of the assigned terms of every package
+}
+
+// returns a resolver of the requirements for the environment
+func newResolver(indexes []*packageIndex, roots []requirement, env markerEnvironment) *resolver {
+	r := &resolver{
+		indexes:           indexes,
+		env:               env,
+		packages:          make(map[string]*resolverPackage),
+		incompatibilities: make(map[string][]*incompatibility),
+		decisions:         make(map[string]int),
+		accumulated:       make(map[string]versionSet),
+	}
+	if version, err := pep440.Parse(env["python_full_version"]); err == nil {
+		r.python = &version
+	}
+
+	for _, root := range roots {
+		if root.appliesTo(env) {
+			r.roots = append(r.roots, root)
+		}
+	}
+
+	r.packages[resolverRoot] = &resolverPackage{
+		versions:     []pep440.Version{pep440.MustParse("0")},
+		specifiers:   make(map[string]string),
+		dependencies: map[int][]requirement{0: r.roots},
+		artifacts:    make(map[int]indexFile),
+		unavailable:  make(map[int]string),
+	}
+	return r
+}
+
+// returns the package for the key, fetching its versions from the
+// index the first time it is used
+// projects the index does not know have no versions
+func (r *resolver) load(name string, extra string) (*resolverPackage, error) {
+	key := resolverKey(name, extra)
+	if p, found := r.packages[key]; found {
+		return p, nil
+	}
+
+	if extra != "" {
+		base, err := r.load(name, "")
+		if err != nil {
+			return nil, err
+		}
+		p := &resolverPackage{name: base.name, extra: normalizeName(extra), versions: base.versions, base: base, specifiers: make(map[string]string)}
+		r.packages[key] = p
+		return p, nil
+	}
+
+	if err := r.prefetch([]string{key}); err != nil {
+		return nil, err
+	}
+	return r.packages[key], nil
+}
+
+// fetches the versions of the projects the resolver does not know yet,
+// several at a time
+func (r *resolver) prefetch(names []string) error {
+	var missing []string
+	for _, name := range names {
+		if _, found := r.packages[normalizeName(name)]; !found && !slices.Contains(missing, normalizeName(name)) {
+			missing = append(missing, normalizeName(name))
+		}
+	}
+
+	var errs []error
+	var wait sync.WaitGroup
+	semaphore := make(chan struct{}, indexConcurrency)
+	for _, name := range missing {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			versions, files, err := fetchProjectReleases(r.indexes, name)
+			if err != nil && !errors.Is(err, errProjectNotFound) {
+				r.mutex.Lock()
+				errs = append(errs, err)
+				r.mutex.Unlock()
+				return
+			}
+
+			slices.Reverse(versions)
+			p := &resolverPackage{
+				name:         name,
+				versions:     versions,
+				files:        files,
+				specifiers:   make(map[string]string),
+				dependencies: make(map[int][]requirement),
+				artifacts:    make(map[int]indexFile),
+				unavailable:  make(map[int]string),
+			}
+
+			r.mutex.Lock()
+			r.packages[name] = p
+			r.mutex.Unlock()
+		}()
+	}
+	wait.Wait()
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// returns the set of the versions of the package matching the specifier,
+// leaving out pre-releases unless the specifier names one
+func (r *resolver) specifierSet(p *resolverPackage, specifier string) (versionSet, error) {
+	specifiers, err := pep440.ParseSpecifierSet(specifier)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make(map[string]bool)
+	for _, version := range specifiers.Filter(p.versions, false) {
+		matching[version.String()] = true
+	}
+
+	set := emptySet(p)
+	for i, version := range p.versions {
+		set[i] = matching[version.String()]
+	}
+	if set.isEmpty() {
+		set[len(p.versions)] = true
+	}
+	p.specifiers[setKey(set)] = specifiers.String()
+	return set, nil
+}
+
+// returns the set holding only the version at the index
+func singleVersion(p *resolverPackage, index int) versionSet {
+	set := emptySet(p)
+	set[index] = true
+	return set
+}
+
+// returns a key identifying the versions of the set
+func setKey(set versionSet) string {
+	var key strings.Builder
+	for _, member := range set.versions() {
+		if member {
+			key.WriteByte('1')
+		} else {
+			key.WriteByte('0')
+		}
+	}
+	return key.String()
+}
+
+func (r *resolver) addIncompatibility(inc *incompatibility) {
+	for _, t := range inc.terms {
+		r.incompatibilities[t.Package] = append(r.incompatibilities[t.Package], inc)
+	}
+}
+
+// returns the intersection of the terms assigned to the package,
+// every version and leaving it out when nothing was assigned
+func (r *resolver) assigned(key string) versionSet {
+	if set, found := r.accumulated[key]; found {
+		return set
+	}
+	set := emptySet(r.packages[key])
+	for i := range set {
+		set[i] = true
+	}
+	return set
+}
+
+func (r *resolver) assign(a assignment) {
+	r.assignments = append(r.assignments, a)
+	r.accumulated[a.term.Package] = r.assigned(a.term.Package).intersect(a.term.Set)
+}
+
+// how the assignments relate to a term or an incompatibility
+type termRelation int
+
+const (
+	relationSatisfied termRelation = iota
+	relationContradicted
+	relationInconclusive
+	relationAlmostSatisfied // every term but one is satisfied, and that one is inconclusive
+)
+
+func (r *resolver) termRelation(t term) termRelation {
+	set := r.assigned(t.Package)
+	switch {
+	case set.subsetOf(t.Set):
+		return relationSatisfied
+	case set.intersect(t.Set).isEmpty():
+		return relationContradicted
+	}
+	return relationInconclusive
+}
+
+// returns how the assignments relate to the incompatibility and, when
+// it is almost satisfied, the term that is not satisfied yet
+func (r *resolver) relation(inc *incompatibility) (termRelation, term) {
+	var unsatisfied *term
+	for i, t := range inc.terms {
+		switch r.termRelation(t) {
+		case relationContradicted:
+			return relationContradicted, term{}
+		case relationInconclusive:
+			if unsatisfied != nil {
+				return relationInconclusive, term{}
+			}
+			unsatisfied = &inc.terms[i]
+		}
+	}
+
+	if unsatisfied == nil {
+		return relationSatisfied, term{}
+	}
+	return relationAlmostSatisfied, *unsatisfied
+}
+
+// derives the consequences of the assignments of the package,
+// resolving the conflicts they cause
+func (r *resolver) propagate(key string) error {
+	changed := []string{key}
+	for len(changed) > 0 {
+		current := changed[len(changed)-1]
+		changed = changed[:len(changed)-1]
+
+		incompatibilities := r.incompatibilities[current]
+		for i := len(incompatibilities) - 1; i >= 0; i-- {
+			relation, unsatisfied := r.relation(incompatibilities[i])
+
+			if relation == relationSatisfied {
+				cause, err := r.resolveConflict(incompatibilities[i])
+				if err != nil {
+					return err
+				}
+				_, unsatisfied = r.relation(cause)
+				r.assign(assignment{term: unsatisfied.negate(), level: len(r.decisions), cause: cause})
+				changed = []string{unsatisfied.Package}
+				break
+			}
+
+			if relation == relationAlmostSatisfied {
+				r.assign(assignment{term: unsatisfied.negate(), level: len(r.decisions), cause: incompatibilities[i]})
+				if !slices.Contains(changed, unsatisfied.Package) {
+					changed = append(changed, unsatisfied.Package)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// returns the index of the earliest assignment after which the
+// assignments of the package satisfy the term
+// returns an error when no assignment does, which means the resolver
+// tried to resolve a conflict the assignments do not cause
+func (r *resolver) satisfier(t term) (int, error) {
+	set := make(versionSet, len(t.Set))
+	for i := range set {
+		set[i] = true
+	}
+	for i, a := range r.assignments {
+		if a.term.Package != t.Package {
+			continue
+		}
+		set = set.intersect(a.term.Set)
+		if set.subsetOf(t.Set) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("the resolver found no assignment satisfying its term of %s", r.packages[t.Package])
+}
+
+// removes the assignments made after the decision level
+func (r *resolver) backtrack(level int) {
+	for len(r.assignments) > 0 && r.assignments[len(r.assignments)-1].level > level {
+		last := r.assignments[len(r.assignments)-1]
+		r.assignments = r.assignments[:len(r.assignments)-1]
+		if last.cause == nil {
+			delete(r.decisions, last.term.Package)
+		}
+	}
+
+	r.accumulated = make(map[string]versionSet)
+	for _, a := range r.assignments {
+		r.accumulated[a.term.Package] = r.assigned(a.term.Package).intersect(a.term.Set)
+	}
+}
+
+// learns the root cause of the incompatibility the assignments satisfy
+// and backtracks to the point where it is no longer satisfied
+// returns a resolution error when the conflict cannot be avoided
+func (r *resolver) resolveConflict(inc *incompatibility) (*incompatibility, error) {
+	learned := false
+
+	for !inc.failure() {
+		var recentTerm term
+		var difference versionSet
+		recent := -1
+		previousLevel := 1
+
+		for _, t := range inc.terms {
+			satisfier, err := r.satisfier(t)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case recent < 0:
+				recentTerm, recent = t, satisfier
+			case recent < satisfier:
+				previousLevel = max(previousLevel, r.assignments[recent].level)
+				recentTerm, recent, difference = t, satisfier, nil
+			default:
+				previousLevel = max(previousLevel, r.assignments[satisfier].level)
+			}
+
+			if recentTerm.Package == t.Package && recent == satisfier {
+				// the satisfier may only satisfy the term together with an earlier assignment
+				difference = r.assignments[recent].term.Set.intersect(t.Set.complement())
+				if difference.isEmpty() {
+					difference = nil
+				} else {
+					previous, err := r.satisfier(term{Package: t.Package, Set: difference.complement()})
+					if err != nil {
+						return nil, err
+					}
+					previousLevel = max(previousLevel, r.assignments[previous].level)
+				}
+			}
+		}
+
+		satisfier := r.assignments[recent]
+		if satisfier.cause == nil || previousLevel < satisfier.level {
+			r.backtrack(previousLevel)
+			if learned {
+				r.addIncompatibility(inc)
+			}
+			return inc, nil
+		}
+
+		var terms []term
+		for _, t := range inc.terms {
+			if t.Package != recentTerm.Package {
+				terms = append(terms, t)
+			}
+		}
+		for _, t := range satisfier.cause.terms {
+			if t.Package != satisfier.term.Package {
+				terms = append(terms, t)
+			}
+		}
+		if difference != nil {
+			terms = append(terms, term{Package: recentTerm.Package, Set: difference.complement()})
+		}
+
+		derived := newIncompatibility(terms, causeDerived)
+		derived.left, derived.right = inc, satisfier.cause
+		inc = derived
+		learned = true
+	}
+
+	return nil, &resolutionError{explanation: r.explain(inc)}
+}
+
+// returns the index of the newest version in the set, preferring final
+// releases, or -1 when the set holds no version
+func newestVersion(p *resolverPackage, set versionSet) int {
+	newest := -1
+	for i := len(p.versions) - 1; i >= 0; i-- {
+		if !set[i] {
+			continue
+		}
+		if !p.versions[i].IsPrerelease() {
+			return i
+		}
+		if newest < 0 {
+			newest = i
+		}
+	}
+	return newest
+}
+
+// returns true if the python of the environment matches the Requires-Python of a file
+func (r *resolver) pythonMatches(requiresPython string) bool {
+	specifiers, err := pep440.ParseSpecifierSet(requiresPython)
+	return err != nil || r.python == nil || specifiers.Contains(*r.python, true)
+}
+
+// reads the requirements of a version from its metadata, choosing the file
+// pip would install on this machine
+// returns why the version cannot be installed when it cannot
+func (r *resolver) readVersion(p *resolverPackage, index int) (string, error) {
+	if _, found := p.dependencies[index]; found {
+		return "", nil
+	}
+	if reason, found := p.unavailable[index]; found {
+		return reason, nil
+	}
+
+	files := p.files[p.versions[index].String()]
+
+	var usable []indexFile
+	for _, file := range files {
+		if r.pythonMatches(file.RequiresPython) {
+			usable = append(usable, file)
+		}
+	}
+	if len(usable) == 0 {
+		p.unavailable[index] = "requires Python " + files[0].RequiresPython
+		return p.unavailable[index], nil
+	}
+
+	// a wheel built for this machine, the source distribution otherwise
+	artifact := slices.IndexFunc(usable, func(file indexFile) bool { return wheelSupported(file.Filename, r.env) })
+	if artifact < 0 {
+		artifact = slices.IndexFunc(usable, func(file indexFile) bool { return !strings.HasSuffix(file.Filename, ".whl") })
+	}
+	if artifact < 0 {
+		p.unavailable[index] = "has no wheel for this platform"
+		return p.unavailable[index], nil
+	}
+
+	// the metadata of other wheels of the version is read when the
+	// chosen file does not have its own, source distributions may
+	// only know their dependencies once built
+	sources := []indexFile{usable[artifact]}
+	for _, file := range usable {
+		if strings.HasSuffix(file.Filename, ".whl") && file.URL != usable[artifact].URL {
+			sources = append(sources, file)
+		}
+	}
+	slices.SortStableFunc(sources, func(a, b indexFile) int {
+		switch {
+		case a.Metadata == b.Metadata:
+			return 0
+		case a.Metadata:
+			return -1
+		}
+		return 1
+	})
+
+	var dist *installedDistribution
+	for _, source := range sources {
+		var metadata installedDistribution
+		var err error
+		switch {
+		case source.Metadata:
+			metadata, err = r.downloadMetadata(source.URL + ".metadata")
+		case strings.HasSuffix(source.Filename, ".whl"):
+			var data []byte
+			if data, err = r.indexes[0].download(source.URL); err == nil {
+				metadata, err = readWheelMetadata(data)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read the metadata of %s: %v", source.Filename, err)
+		}
+		dist = &metadata
+		break
+	}
+	if dist == nil {
+		p.unavailable[index] = "only has a source distribution, its dependencies are only known once it is built"
+		return p.unavailable[index], nil
+	}
+	if !r.pythonMatches(dist.RequiresPython) {
+		p.unavailable[index] = "requires Python " + dist.RequiresPython
+		return p.unavailable[index], nil
+	}
+
+	var requirements []requirement
+	for _, entry := range dist.RequiresDist {
+		req, err := parseRequirement(entry)
+		if err != nil {
+			return "", fmt.Errorf("%s %s: %v", p.name, p.versions[index], err)
+		}
+		requirements = append(requirements, req)
+	}
+
+	p.artifacts[index] = usable[artifact]
+	p.dependencies[index] = requirements
+	return "", nil
+}
+
+// downloads and parses a PEP 658 metadata file
+func (r *resolver) downloadMetadata(metadataURL string) (installedDistribution, error) {
+	data, err := r.indexes[0].download(metadataURL)
+	if err != nil {
+		return installedDistribution{}, err
+	}
+	return parseDistributionMetadata(strings.NewReader(string(data)))
+}
+
+// returns the requirements of the version of the package that apply
+// to the environment, and the reason it cannot be installed when it cannot
+func (r *resolver) dependencies(p *resolverPackage, index int) ([]requirement, string, error) {
+	base := p
+	if p.base != nil {
+		base = p.base
+	}
+
+	if reason, err := r.readVersion(base, index); reason != "" || err != nil {
+		return nil, reason, err
+	}
+
+	var extras []string
+	if p.extra != "" {
+		extras = []string{p.extra}
+	}
+
+	var requirements []requirement
+	for _, req := range base.dependencies[index] {
+		if p.name == resolverRoot {
+			requirements = append(requirements, req)
+			continue
+		}
+		if applies, err := markerApplies(req.Marker, r.env, extras); err == nil && !applies {
+			continue
+		}
+		if req.URL != "" {
+			return nil, "depends on " + req.Name + " from " + req.URL + ", which pvm cannot resolve", nil
+		}
+		requirements = append(requirements, req)
+	}
+
+	return requirements, "", nil
+}
+
+// decides the version of the next package that needs one
+// returns the package to propagate, or false when every package is decided
+func (r *resolver) decide() (string, bool, error) {
+	var key string
+	count := -1
+	for _, candidate := range slices.Sorted(maps.Keys(r.accumulated)) {
+		set := r.accumulated[candidate]
+		if _, decided := r.decisions[candidate]; decided || !(term{Package: candidate, Set: set}).positive() {
+			continue
+		}
+		// the package with the fewest versions left is the most likely to conflict
+		versions := 0
+		for _, member := range set.versions() {
+			if member {
+				versions++
+			}
+		}
+		if count < 0 || versions < count {
+			key, count = candidate, versions
+		}
+	}
+	if count < 0 {
+		return "", false, nil
+	}
+
+	p := r.packages[key]
+	set := r.accumulated[key]
+
+	index := newestVersion(p, set)
+	if index < 0 {
+		r.addIncompatibility(newIncompatibility([]term{{Package: key, Set: set}}, causeNoVersions))
+		return key, true, nil
+	}
+
+	requirements, reason, err := r.dependencies(p, index)
+	if err != nil {
+		return "", false, err
+	}
+	if reason != "" {
+		unavailable := newIncompatibility([]term{{Package: key, Set: singleVersion(p, index)}}, causeUnavailable)
+		unavailable.reason = reason
+		r.addIncompatibility(unavailable)
+		return key, true, nil
+	}
+
+	var names []string
+	for _, req := range requirements {
+		names = append(names, req.Name)
+	}
+	if err := r.prefetch(names); err != nil {
+		return "", false, err
+	}
+
+	var dependencies []term
+	for _, req := range requirements {
+		// a requirement with extras depends on the package and on every extra
+		for _, extra := range append([]string{""}, req.Extras...) {
+			dependency, err := r.load(req.Name, extra)
+			if err != nil {
+				return "", false, err
+			}
+			set, err := r.specifierSet(dependency, req.Specifier)
+			if err != nil {
+				return "", false, fmt.Errorf("%s %s requires %s: %v", p, p.versions[index], req.Name, err)
+			}
+			dependencies = append(dependencies, term{Package: resolverKey(req.Name, extra), Set: set})
+		}
+	}
+
+	// a package with an extra is the package itself at the same version
+	if p.base != nil {
+		dependencies = append(dependencies, term{Package: p.name, Set: singleVersion(p.base, index)})
+	}
+
+	conflict := false
+	for _, dependency := range dependencies {
+		if dependency.Package == key {
+			continue
+		}
+		// versions with the same dependency share an incompatibility,
+		// which keeps explanations to "every version of a depends on b"
+		depender := singleVersion(p, index)
+		for _, existing := range r.incompatibilities[key] {
+			if existing.kind != causeDependency {
+				continue
+			}
+			from, to := existing.dependency()
+			if from.Package == key && to.Package == dependency.Package && slices.Equal(to.Set, dependency.negate().Set) {
+				depender = depender.union(from.Set)
+			}
+		}
+
+		inc := newIncompatibility([]term{{Package: key, Set: depender}, dependency.negate()}, causeDependency)
+		r.addIncompatibility(inc)
+
+		// a dependency the assignments already rule out is not decided
+		conflict = conflict || r.termRelation(dependency.negate()) == relationSatisfied
+	}
+
+	if !conflict {
+		r.decisions[key] = index
+		r.assign(assignment{term: term{Package: key, Set: singleVersion(p, index)}, level: len(r.decisions)})
+	}
+	return key, true, nil
+}
+
+// resolves the requirements, returning the chosen distributions
+// sorted by name
+func (r *resolver) resolve() ([]resolvedPackage, error) {
+	for _, root := range r.roots {
+		if root.URL != "" {
+			return nil, fmt.Errorf("%s is installed from %s, which the resolver does not support", root.Name, root.URL)
+		}
+	}
+
+	root := r.packages[resolverRoot]
+	r.addIncompatibility(newIncompatibility([]term{{Package: resolverRoot, Set: singleVersion(root, 0).complement()}}, causeRoot))
+
+	next := resolverRoot
+	for {
+		if err := r.propagate(next); err != nil {
+			return nil, err
+		}
+
+		key, found, err := r.decide()
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+		next = key
+	}
+
+	var resolved []resolvedPackage
+	for _, key := range slices.Sorted(maps.Keys(r.decisions)) {
+		p := r.packages[key]
+		if key == resolverRoot || p.base != nil {
+			continue
+		}
+
+		index := r.decisions[key]
+		pkg := resolvedPackage{Name: key, Version: p.versions[index].String(), File: p.artifacts[index]}
+
+		// the lock file needs the hash of every file, which some indexes do not list
+		if pkg.File.Hashes["sha256"] == "" {
+			data, err := r.indexes[0].download(pkg.File.URL)
+			if err != nil {
+				return nil, err
+			}
+			pkg.File.Hashes = maps.Clone(pkg.File.Hashes)
+			if pkg.File.Hashes == nil {
+				pkg.File.Hashes = make(map[string]string)
+			}
+			pkg.File.Hashes["sha256"] = fmt.Sprintf("%x", sha256.Sum256(data))
+		}
+		for _, req := range p.dependencies[index] {
+			pkg.RequiresDist = append(pkg.RequiresDist, req.String())
+		}
+		resolved = append(resolved, pkg)
+	}
+	return resolved, nil
+}
+
+// resolves the requirements against the configured package indexes
+func resolveRequirements(roots []requirement, env markerEnvironment) ([]resolvedPackage, error) {
+	indexes, err := getPackageIndexes()
+	if err != nil {
+		return nil, err
+	}
+	return newResolver(indexes, roots, env).resolve()
+}
+
+// returns the package and versions of the term, such as "flask>=3.0",
+// the versions a negative term rules out for negative terms
+// allowEvery names a term allowing every version "every version of flask"
+func (r *resolver) describe(t term, allowEvery bool) string {
+	p := r.packages[t.Package]
+	if t.Package == resolverRoot {
+		return p.String()
+	}
+
+	set := t.Set
+	if !t.positive() {
+		set = set.complement()
+	}
+
+	if specifier, found := p.specifiers[setKey(set)]; found && specifier != "" {
+		return p.String() + specifier
+	}
+
+	// runs of consecutive versions of the set, ignoring the pre-releases
+	// left out of it since specifiers leave them out by default
+	var runs [][2]int
+	for i, member := range set.versions() {
+		switch {
+		case member && len(runs) > 0 && runs[len(runs)-1][1] == i-1:
+			runs[len(runs)-1][1] = i
+		case member:
+			runs = append(runs, [2]int{i, i})
+		case p.versions[i].IsPrerelease() && len(runs) > 0 && runs[len(runs)-1][1] == i-1:
+			runs[len(runs)-1][1] = i
+		}
+	}
+
+	last := len(p.versions) - 1
+	if len(runs) == 0 || (len(runs) == 1 && runs[0][0] == 0 && runs[0][1] == last) {
+		if allowEvery && len(runs) > 0 {
+			return "every version of " + p.String()
+		}
+		return p.String()
+	}
+
+	var ranges []string
+	for _, run := range runs {
+		// a run ends at its last member, not at a pre-release after it
+		for run[1] > run[0] && !set[run[1]] {
+			run[1]--
+		}
+		low, high := p.versions[run[0]].String(), p.versions[run[1]].String()
+		switch {
+		case run[0] == run[1]:
+			ranges = append(ranges, "=="+low)
+		case run[0] == 0:
+			ranges = append(ranges, "<="+high)
+		case run[1] == last:
+			ranges = append(ranges, ">="+low)
+		default:
+			ranges = append(ranges, ">="+low+",<="+high)
+		}
+	}
+	if len(ranges) == 1 {
+		return p.String() + ranges[0]
+	}
+	return p.String() + " (" + strings.Join(ranges, " or ") + ")"
+}
+
+// returns the incompatibility as a sentence, such as "flask==3.0.0 depends on werkzeug>=3.0.0"
+func (r *resolver) sentence(inc *incompatibility) string {
+	switch inc.kind {
+	case causeDependency:
+		depender, dependee := inc.dependency()
+		return r.describe(depender, true) + " depends on " + r.describe(dependee.negate(), false)
+	case causeNoVersions:
+		if len(r.packages[inc.terms[0].Package].versions) == 0 {
+			return r.packages[inc.terms[0].Package].String() + " " + errProjectNotFound.Error()
+		}
+		return "there is no version of " + r.describe(inc.terms[0], false)
+	case causeUnavailable:
+		return r.describe(inc.terms[0], false) + " " + inc.reason
+	}
+	if inc.failure() {
+		return "the requirements cannot be resolved"
+	}
+
+	if len(inc.terms) == 1 {
+		if inc.terms[0].positive() {
+			return r.describe(inc.terms[0], true) + " is forbidden"
+		}
+		return r.describe(inc.terms[0], true) + " is required"
+	}
+
+	if len(inc.terms) == 2 && inc.terms[0].positive() == inc.terms[1].positive() {
+		if inc.terms[0].positive() {
+			return r.describe(inc.terms[0], true) + " is incompatible with " + r.describe(inc.terms[1], true)
+		}
+		return "either " + r.describe(inc.terms[0], false) + " or " + r.describe(inc.terms[1], false)
+	}
+
+	var positive, negative []string
+	for _, t := range inc.terms {
+		if t.positive() {
+			positive = append(positive, r.describe(t, len(inc.terms) > 1))
+		} else {
+			negative = append(negative, r.describe(t, false))
+		}
+	}
+	switch {
+	case len(positive) == 1 && len(negative) > 0:
+		return positive[0] + " requires " + strings.Join(negative, " or ")
+	case len(positive) > 1 && len(negative) > 0:
+		return "if " + strings.Join(positive, " and ") + " then " + strings.Join(negative, " or ")
+	case len(positive) > 0:
+		return "one of " + strings.Join(positive, " or ") + " must be false"
+	}
+	return "one of " + strings.Join(negative, " or ") + " must be true"
+}
+
+// returns the terms of the incompatibility with the sign
+func termsWithSign(inc *incompatibility, positive bool) []term {
+	var terms []term
+	for _, t := range inc.terms {
+		if t.positive() == positive {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// returns " (n)" referring to a numbered line, or nothing
+func lineReference(number int) string {
+	if number == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d)", number)
+}
+
+// returns the verb of an incompatibility requiring its negative terms
+func requireVerb(inc *incompatibility) string {
+	if inc.kind == causeDependency {
+		return "depends on"
+	}
+	return "requires"
+}
+
+// joins the sentences of two incompatibilities, shortening the common
+// cases "a depends on both b and c", "a depends on b which depends on c"
+// and "a depends on b which is forbidden"
+func (r *resolver) joinSentences(first *incompatibility, second *incompatibility, firstLine int, secondLine int) string {
+	describeAll := func(terms []term) string {
+		var described []string
+		for _, t := range terms {
+			described = append(described, r.describe(t, false))
+		}
+		return strings.Join(described, " or ")
+	}
+
+	// a depends on both b and c
+	if len(first.terms) > 1 && len(second.terms) > 1 {
+		firstPositive, secondPositive := termsWithSign(first, true), termsWithSign(second, true)
+		if len(firstPositive) == 1 && len(secondPositive) == 1 && firstPositive[0].Package == secondPositive[0].Package &&
+			slices.Equal(firstPositive[0].Set, secondPositive[0].Set) {
+			verb := "requires"
+			if first.kind == causeDependency && second.kind == causeDependency {
+				verb = "depends on"
+			}
+			return r.describe(firstPositive[0], true) + " " + verb + " both " +
+				describeAll(termsWithSign(first, false)) + lineReference(firstLine) + " and " +
+				describeAll(termsWithSign(second, false)) + lineReference(secondLine)
+		}
+	}
+
+	// a depends on b which depends on c
+	if len(first.terms) > 1 && len(second.terms) > 1 {
+		for _, order := range [][2]*incompatibility{{first, second}, {second, first}} {
+			prior, latter := order[0], order[1]
+			priorLine, latterLine := firstLine, secondLine
+			if prior == second {
+				priorLine, latterLine = secondLine, firstLine
+			}
+
+			priorNegative, latterPositive := termsWithSign(prior, false), termsWithSign(latter, true)
+			latterNegative := termsWithSign(latter, false)
+			if len(priorNegative) != 1 || len(latterPositive) != 1 || len(latterNegative) == 0 ||
+				priorNegative[0].Package != latterPositive[0].Package ||
+				!priorNegative[0].negate().Set.subsetOf(latterPositive[0].Set) {
+				continue
+			}
+
+			return r.requiring(prior, priorNegative[0], priorLine) + " which " + requireVerb(latter) + " " +
+				describeAll(latterNegative) + lineReference(latterLine)
+		}
+	}
+
+	// a depends on b which is forbidden
+	for _, order := range [][2]*incompatibility{{first, second}, {second, first}} {
+		prior, latter := order[0], order[1]
+		priorLine, latterLine := firstLine, secondLine
+		if prior == second {
+			priorLine, latterLine = secondLine, firstLine
+		}
+
+		priorNegative := termsWithSign(prior, false)
+		if len(latter.terms) != 1 || len(priorNegative) != 1 || len(termsWithSign(prior, true)) == 0 ||
+			!priorNegative[0].negate().Set.subsetOf(latter.terms[0].Set) || latter.terms[0].Package != priorNegative[0].Package {
+			continue
+		}
+
+		var reason string
+		switch latter.kind {
+		case causeNoVersions:
+			reason = "which does not match any version"
+			if len(r.packages[latter.terms[0].Package].versions) == 0 {
+				reason = "which " + errProjectNotFound.Error()
+			}
+		case causeUnavailable:
+			reason = "which " + latter.reason
+		default:
+			reason = "which is forbidden"
+		}
+		return r.requiring(prior, priorNegative[0], priorLine) + " " + reason + lineReference(latterLine)
+	}
+
+	return r.sentence(first) + lineReference(firstLine) + " and " + r.sentence(second) + lineReference(secondLine)
+}
+
+// returns "a depends on b" for an incompatibility with a single negative term b
+func (r *resolver) requiring(inc *incompatibility, negative term, line int) string {
+	var positives []string
+	for _, t := range termsWithSign(inc, true) {
+		positives = append(positives, r.describe(t, false))
+	}
+
+	var text string
+	if len(positives) > 1 {
+		text = "if " + strings.Join(positives, " and ") + " then "
+	} else {
+		text = r.describe(termsWithSign(inc, true)[0], true) + " " + requireVerb(inc) + " "
+	}
+	return text + r.describe(negative, false) + lineReference(line)
+}
+
+// a line of an explanation, numbered when later lines refer to it
+type explanationLine struct {
+	text   string
+	number int
+}
+
+// explains a failed resolution from the incompatibilities it was derived from,
+// numbering the lines of the incompatibilities used more than once
+type conflictExplanation struct {
+	r           *resolver
+	failure     *incompatibility
+	derivations map[*incompatibility]int
+	numbers     map[*incompatibility]int
+	lines       []explanationLine
+}
+
+// returns the explanation of the failure, one sentence per line
+func (r *resolver) explain(failure *incompatibility) string {
+	e := &conflictExplanation{
+		r:           r,
+		failure:     failure,
+		derivations: make(map[*incompatibility]int),
+		numbers:     make(map[*incompatibility]int),
+	}
+
+	if failure.kind == causeDerived {
+		e.countDerivations(failure)
+		e.visit(failure, false)
+	} else {
+		e.write(failure, "Because "+r.sentence(failure)+", the requirements cannot be resolved.", false)
+	}
+
+	padding := 0
+	if len(e.numbers) > 0 {
+		padding = len(fmt.Sprintf("(%d) ", len(e.numbers)))
+	}
+
+	var text strings.Builder
+	lastEmpty := false
+	for _, line := range e.lines {
+		if line.text == "" {
+			if !lastEmpty {
+				text.WriteString("\n")
+			}
+			lastEmpty = true
+			continue
+		}
+		lastEmpty = false
+
+		prefix := ""
+		if line.number > 0 {
+			prefix = fmt.Sprintf("(%d) ", line.number)
+		}
+		text.WriteString(prefix + strings.Repeat(" ", padding-len(prefix)) + line.text + "\n")
+	}
+	return strings.TrimSuffix(text.String(), "\n")
+}
+
+func (e *conflictExplanation) countDerivations(inc *incompatibility) {
+	e.derivations[inc]++
+	if e.derivations[inc] == 1 && inc.kind == causeDerived {
+		e.countDerivations(inc.left)
+		e.countDerivations(inc.right)
+	}
+}
+
+func (e *conflictExplanation) write(inc *incompatibility, text string, numbered bool) {
+	line := explanationLine{text: text}
+	if numbered {
+		line.number = len(e.numbers) + 1
+		e.numbers[inc] = line.number
+	}
+	e.lines = append(e.lines, line)
+}
+
+// returns true if the incompatibility can be explained within the line of
+// the incompatibility derived from it
+func (e *conflictExplanation) collapsible(inc *incompatibility) bool {
+	if e.derivations[inc] > 1 {
+		return false
+	}
+	leftDerived, rightDerived := inc.left.kind == causeDerived, inc.right.kind == causeDerived
+	if leftDerived == rightDerived {
+		return false
+	}
+
+	derived := inc.left
+	if rightDerived {
+		derived = inc.right
+	}
+	_, numbered := e.numbers[derived]
+	return !numbered
+}
+
+// writes the lines explaining a derived incompatibility, after the lines
+// explaining the incompatibilities it was derived from
+func (e *conflictExplanation) visit(inc *incompatibility, conclusion bool) {
+	r := e.r
+	numbered := conclusion || e.derivations[inc] > 1
+	conjunction := "And"
+	if conclusion || inc == e.failure {
+		conjunction = "So,"
+	}
+	text := r.sentence(inc)
+
+	left, right := inc.left, inc.right
+	switch {
+	case left.kind == causeDerived && right.kind == causeDerived:
+		leftLine, rightLine := e.numbers[left], e.numbers[right]
+		switch {
+		case leftLine > 0 && rightLine > 0:
+			e.write(inc, "Because "+r.joinSentences(left, right, leftLine, rightLine)+", "+text+".", numbered)
+		case leftLine > 0 || rightLine > 0:
+			withLine, withoutLine, line := left, right, leftLine
+			if rightLine > 0 {
+				withLine, withoutLine, line = right, left, rightLine
+			}
+			e.visit(withoutLine, false)
+			e.write(inc, conjunction+" because "+r.sentence(withLine)+lineReference(line)+", "+text+".", numbered)
+		default:
+			leftSingle := left.left.kind != causeDerived && left.right.kind != causeDerived
+			rightSingle := right.left.kind != causeDerived && right.right.kind != causeDerived
+			if leftSingle || rightSingle {
+				first, second := left, right
+				if rightSingle {
+					first, second = right, left
+				}
+				e.visit(first, false)
+				e.visit(second, false)
+				e.write(inc, "Thus, "+text+".", numbered)
+			} else {
+				e.visit(left, true)
+				e.lines = append(e.lines, explanationLine{})
+				e.visit(right, false)
+				e.write(inc, conjunction+" because "+r.sentence(left)+lineReference(e.numbers[left])+", "+text+".", numbered)
+			}
+		}
+
+	case left.kind == causeDerived || right.kind == causeDerived:
+		derived, external := left, right
+		if right.kind == causeDerived {
+			derived, external = right, left
+		}
+
+		switch {
+		case e.numbers[derived] > 0:
+			e.write(inc, "Because "+r.joinSentences(external, derived, 0, e.numbers[derived])+", "+text+".", numbered)
+		case e.collapsible(derived):
+			collapsedDerived, collapsedExternal := derived.left, derived.right
+			if collapsedExternal.kind == causeDerived {
+				collapsedDerived, collapsedExternal = derived.right, derived.left
+			}
+			e.visit(collapsedDerived, false)
+			e.write(inc, conjunction+" because "+r.joinSentences(collapsedExternal, external, 0, 0)+", "+text+".", numbered)
+		default:
+			e.visit(derived, false)
+			e.write(inc, conjunction+" because "+r.sentence(external)+", "+text+".", numbered)
+		}
+
+	default:
+		e.write(inc, "Because "+r.joinSentences(left, right, 0, 0)+", "+text+".", numbered)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a release of a project on the resolver test index
+type testRelease struct {
+	version        string
+	requiresDist   []string
+	requiresPython string
+	wheelOnly      bool // the index does not serve the metadata next to the wheel
+}
+
+// returns the METADATA file of a release
+func (release testRelease) metadata(name string) string {
+	var text strings.Builder
+	text.WriteString("Metadata-Version: 2.1\nName: " + name + "\nVersion: " + release.version + "\n")
+	if release.requiresPython != "" {
+		text.WriteString("Requires-Python: " + release.requiresPython + "\n")
+	}
+	for _, entry := range release.requiresDist {
+		text.WriteString("Requires-Dist: " + entry + "\n")
+	}
+	return text.String()
+}
+
+// returns a wheel holding only the METADATA file of a release
+func (release testRelease) wheel(t *testing.T, name string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	file, err := archive.Create(name + "-" + release.version + ".dist-info/METADATA")
+	if err != nil {
+		t.Fatalf("failed to create the wheel: %v", err)
+	}
+	file.Write([]byte(release.metadata(name)))
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to create the wheel: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// starts a package index serving a pure python wheel for every release,
+// with its PEP 658 metadata unless the release is wheel only
+func setupResolverIndex(t *testing.T, projects map[string][]testRelease) []*packageIndex {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filename, found := strings.CutPrefix(r.URL.Path, "/files/"); found {
+			for name, releases := range projects {
+				for _, release := range releases {
+					wheel := name + "-" + release.version + "-py3-none-any.whl"
+					switch {
+					case filename == wheel+".metadata" && !release.wheelOnly:
+						w.Write([]byte(release.metadata(name)))
+						return
+					case filename == wheel:
+						w.Write(release.wheel(t, name))
+						return
+					}
+				}
+			}
+			http.NotFound(w, r)
+			return
+		}
+
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/simple/"), "/")
+		releases, found := projects[name]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		var entries []string
+		for _, release := range releases {
+			filename := name + "-" + release.version + "-py3-none-any.whl"
+			entries = append(entries, fmt.Sprintf(`{"filename": %q, "url": "/files/%s", "hashes": {"sha256": "%s"}, "requires-python": %q, "core-metadata": %v}`,
+				filename, filename, strings.ReplaceAll(release.version, ".", ""), release.requiresPython, !release.wheelOnly))
+		}
+		w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
+		fmt.Fprintf(w, `{"meta": {"api-version": "1.1"}, "name": %q, "files": [%s]}`, name, strings.Join(entries, ","))
+	}))
+	t.Cleanup(server.Close)
+
+	return []*packageIndex{newPackageIndex(server.URL + "/simple")}
+}
+
+// returns the resolved packages as name==version
+func resolvedPins(resolved []resolvedPackage) []string {
+	var pins []string
+	for _, pkg := range resolved {
+		pins = append(pins, pkg.Name+"=="+pkg.Version)
+	}
+	return pins
+}
+
+func TestResolveRequirements(t *testing.T) {
+	indexes := setupResolverIndex(t, map[string][]testRelease{
+		"requests": {
+			{version: "2.31.0", requiresDist: []string{"idna<4,>=2.5", `PySocks>=1.5.6; extra == "socks"`}},
+			{version: "2.32.0", requiresDist: []string{"idna<4,>=2.5"}, requiresPython: ">=3.13"},
+		},
+		"idna":     {{version: "3.6"}, {version: "4.0"}, {version: "3.7rc1"}},
+		"pysocks":  {{version: "1.7.1", wheelOnly: true}},
+		"colorama": {{version: "0.4.6"}},
+	})
+
+	roots := []requirement{
+		{Name: "requests", Extras: []string{"socks"}, Specifier: ">=2"},
+		{Name: "colorama", Marker: `sys_platform == "win32"`},
+	}
+	resolved, err := newResolver(indexes, roots, testMarkerEnvironment()).resolve()
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+
+	expected := []string{"idna==3.6", "pysocks==1.7.1", "requests==2.31.0"}
+	if !reflect.DeepEqual(resolvedPins(resolved), expected) {
+		t.Fatalf("expected %q, received %q", expected, resolvedPins(resolved))
+	}
+
+	requests := resolved[2]
+	if !strings.HasSuffix(requests.File.URL, "/files/requests-2.31.0-py3-none-any.whl") || requests.File.Hashes["sha256"] != "2310" {
+		t.Errorf("unexpected file %+v", requests.File)
+	}
+	if !reflect.DeepEqual(requests.RequiresDist, []string{"idna<4,>=2.5", `PySocks>=1.5.6; extra == "socks"`}) {
+		t.Errorf("unexpected dependencies %q", requests.RequiresDist)
+	}
+}
+
+func TestResolveRequirementsBacktracks(t *testing.T) {
+	indexes := setupResolverIndex(t, map[string][]testRelease{
+		"app": {
+			{version: "2.0", requiresDist: []string{"lib==1.0"}},
+			{version: "3.0", requiresDist: []string{"plugin>=2"}},
+		},
+		"plugin": {{version: "1.0"}, {version: "2.0", requiresDist: []string{"lib>=2"}}},
+		"lib":    {{version: "1.0"}, {version: "2.0"}},
+	})
+
+	roots := []requirement{{Name: "app"}, {Name: "lib", Specifier: "<2"}}
+	resolved, err := newResolver(indexes, roots, testMarkerEnvironment()).resolve()
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+
+	expected := []string{"app==2.0", "lib==1.0"}
+	if !reflect.DeepEqual(resolvedPins(resolved), expected) {
+		t.Errorf("expected %q, received %q", expected, resolvedPins(resolved))
+	}
+}
+
+func TestResolveRequirementsExplainsConflicts(t *testing.T) {
+	indexes := setupResolverIndex(t, map[string][]testRelease{
+		"web":   {{version: "1.0", requiresDist: []string{"jinja>=2"}}, {version: "2.0", requiresDist: []string{"jinja>=2"}}},
+		"docs":  {{version: "1.0", requiresDist: []string{"jinja<2"}}},
+		"jinja": {{version: "1.0"}, {version: "2.0"}, {version: "3.0"}},
+		"new":   {{version: "1.0", requiresPython: ">=3.13"}},
+	})
+
+	tests := []struct {
+		roots    []requirement
+		expected string
+	}{
+		{
+			[]requirement{{Name: "web"}, {Name: "docs", Specifier: "==1.0"}},
+			"Because docs==1.0 depends on jinja<2 and every version of web depends on jinja>=2, docs==1.0 is incompatible with every version of web.\n" +
+				"So, because the project depends on both web and docs==1.0, the requirements cannot be resolved.",
+		},
+		{
+			[]requirement{{Name: "new"}},
+			"Because the project depends on new which requires Python >=3.13, the requirements cannot be resolved.",
+		},
+		{
+			[]requirement{{Name: "ghost"}},
+			"Because the project depends on ghost which was not found on the package index, the requirements cannot be resolved.",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := newResolver(indexes, test.roots, testMarkerEnvironment()).resolve()
+		if _, ok := err.(*resolutionError); !ok {
+			t.Errorf("expected a resolution error for %v, received %v", test.roots, err)
+			continue
+		}
+		if err.Error() != test.expected {
+			t.Errorf("unexpected explanation for %v:\n%s\nexpected:\n%s", test.roots, err, test.expected)
+		}
+	}
+}
+
+func TestResolveRequirementsWithURL(t *testing.T) {
+	indexes := setupResolverIndex(t, nil)
+
+	_, err := newResolver(indexes, []requirement{{Name: "tool", URL: "https://example.com/tool-1.0.tar.gz"}}, testMarkerEnvironment()).resolve()
+	if err == nil || !strings.Contains(err.Error(), "tool") {
+		t.Errorf("expected direct references to fail, received %v", err)
+	}
+}
+
+func TestResolverSatisfierWithoutAssignments(t *testing.T) {
+	r := newResolver(setupResolverIndex(t, nil), nil, testMarkerEnvironment())
+	root := r.packages[resolverRoot]
+
+	if _, err := r.satisfier(term{Package: resolverRoot, Set: singleVersion(root, 0)}); err == nil {
+		t.Errorf("expected a term no assignment satisfies to fail")
+	}
+}
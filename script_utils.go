@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// splits a command line into its arguments, honoring single
+// and double quotes and backslash escapes like a POSIX shell
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// returns the path of the program, preferring the executables
+// installed in the virtual environment over the ones on PATH
+func resolveVenvProgram(program string) (string, error) {
+	if strings.ContainsRune(program, filepath.Separator) || strings.ContainsRune(program, '/') {
+		return program, nil
+	}
+
+	pythonPath, err := getVenvPythonPath()
+	if err != nil {
+		return "", err
+	}
+
+	binDir := filepath.Dir(pythonPath)
+	for _, name := range []string{program, program + ".exe"} {
+		path := filepath.Join(binDir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+
+	return exec.LookPath(program)
+}
+
+// returns the environment for commands run in the virtual environment,
+// set up like the activate script does, with VIRTUAL_ENV set, its
+// executables directory first on PATH and PYTHONHOME unset, plus the
+// variables of the dotenv files
+func venvEnvironment() ([]string, error) {
+	pythonPath, err := getVenvPythonPath()
+	if err != nil {
+		return nil, err
+	}
+	binDir := filepath.Dir(pythonPath)
+	venvPath := filepath.Dir(binDir)
+
+	dotenv, err := loadDotenvVariables()
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	pathFound := false
+
+	for _, variable := range os.Environ() {
+		// windows spells the variable Path
+		name, value, _ := strings.Cut(variable, "=")
+		switch {
+		case strings.EqualFold(name, "PATH"):
+			variable = name + "=" + binDir + string(os.PathListSeparator) + value
+			pathFound = true
+		case name == "VIRTUAL_ENV" || name == "PYTHONHOME":
+			continue
+		}
+		env = append(env, variable)
+	}
+
+	if !pathFound {
+		env = append(env, "PATH="+binDir)
+	}
+	for _, variable := range dotenv {
+		env = append(env, variable.Name+"="+variable.Value)
+	}
+
+	return append(env, "VIRTUAL_ENV="+venvPath), nil
+}
+
+// returns the names of the tasks to run for the named task,
+// every dependency once and before the tasks that need it
+func taskOrder(scripts map[string]scriptConfig, name string) ([]string, error) {
+	var order []string
+	var visiting []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if slices.Contains(order, name) {
+			return nil
+		}
+		if index := slices.Index(visiting, name); index >= 0 {
+			return fmt.Errorf("tasks depend on each other: %s", strings.Join(slices.Concat(visiting[index:], []string{name}), " -> "))
+		}
+
+		script, found := scripts[name]
+		if !found {
+			return fmt.Errorf("unknown task %s", name)
+		}
+
+		visiting = append(visiting, name)
+		for _, dependency := range script.Depends {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+
+		order = append(order, name)
+		return nil
+	}
+
+	return order, visit(name)
+}
+
+// runs the command line in the virtual environment from the project
+// root, appending the extra arguments
+func runConfiguredScript(command string, extraArgs []string) error {
+	args, err := splitCommandLine(command)
+	if err != nil {
+		return err
+	}
+	args = append(args, extraArgs...)
+	if len(args) == 0 {
+		return fmt.Errorf("the task has no command")
+	}
+
+	program, err := resolveVenvProgram(args[0])
+	if err != nil {
+		return err
+	}
+
+	env, err := venvEnvironment()
+	if err != nil {
+		return err
+	}
+
+	root, err := getProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(program, args[1:]...)
+	cmd.Dir = root
+	cmd.Env = env
+	return runAttached(cmd)
+}
+
+// runs the command attached to the terminal of pvm
+// interrupts are left to the command, which receives them too
+func runAttached(cmd *exec.Cmd) error {
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	return cmd.Run()
+}
+
+// runs the program with the arguments in the virtual environment,
+// preferring the executables installed in it
+func execInVenv(program string, args []string) error {
+	path, err := resolveVenvProgram(program)
+	if err != nil {
+		return err
+	}
+
+	env, err := venvEnvironment()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = env
+	return runAttached(cmd)
+}
+
+// runs the python module with the arguments in the virtual environment
+func runModule(module string, args []string) error {
+	pythonPath, err := getVenvPythonPath()
+	if err != nil {
+		return err
+	}
+
+	return execInVenv(pythonPath, append([]string{"-m", module}, args...))
+}
+
+// returns the arguments passed through to a script, without the
+// -- that separates them from the script name
+func passThroughArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// returns the exit code of a command that ran and failed
+// commands killed by a signal report 128 plus the signal number like a shell
+func exitCodeOf(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), true
+	}
+
+	return exitErr.ExitCode(), true
+}
+
+// runs the named task of the project configuration after the tasks it
+// depends on, the extra arguments are only passed to the named task
+func runTask(scripts map[string]scriptConfig, name string, extraArgs []string) error {
+	order, err := taskOrder(scripts, name)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range order {
+		var args []string
+		if task == name {
+			args = extraArgs
+		}
+
+		if err := runConfiguredScript(scripts[task].Command, args); err != nil {
+			return fmt.Errorf("task %s failed: %w", task, err)
+		}
+	}
+
+	return nil
+}
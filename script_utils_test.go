@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	cases := map[string][]string{
+		"pytest -q":                         {"pytest", "-q"},
+		"  python   -m app --port 8000 ":    {"python", "-m", "app", "--port", "8000"},
+		`echo "hello world" 'it''s'`:        {"echo", "hello world", "its"},
+		`printf "a \"quoted\" \\path"`:      {"printf", `a "quoted" \path`},
+		`touch file\ name ""`:               {"touch", "file name", ""},
+		`python -c 'print("single $HOME")'`: {"python", "-c", `print("single $HOME")`},
+	}
+
+	for line, expected := range cases {
+		args, err := splitCommandLine(line)
+		if err != nil {
+			t.Errorf("splitCommandLine(%q) failed: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("splitCommandLine(%q): expected %q, received %q", line, expected, args)
+		}
+	}
+
+	if _, err := splitCommandLine(`echo "open`); err == nil {
+		t.Errorf("expected an unterminated quote to fail")
+	}
+}
+
+func TestTaskOrder(t *testing.T) {
+	scripts := map[string]scriptConfig{
+		"lint":   {Command: "ruff check ."},
+		"types":  {Command: "mypy ."},
+		"check":  {Command: "true", Depends: []string{"lint", "types"}},
+		"test":   {Command: "pytest -q", Depends: []string{"check", "lint"}},
+		"loop-a": {Command: "true", Depends: []string{"loop-b"}},
+		"loop-b": {Command: "true", Depends: []string{"loop-a"}},
+	}
+
+	order, err := taskOrder(scripts, "test")
+	if err != nil {
+		t.Fatalf("taskOrder failed: %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"lint", "types", "check", "test"}) {
+		t.Errorf("unexpected order: %q", order)
+	}
+
+	if _, err := taskOrder(scripts, "loop-a"); err == nil || err.Error() != "tasks depend on each other: loop-a -> loop-b -> loop-a" {
+		t.Errorf("expected a dependency cycle to fail, received %v", err)
+	}
+
+	if _, err := taskOrder(map[string]scriptConfig{"test": {Depends: []string{"lint"}}}, "test"); err == nil {
+		t.Errorf("expected an unknown dependency to fail")
+	}
+}
+
+func TestDecodeTasks(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	content := "[scripts]\ntest = \"pytest -q\"\nci = { cmd = \"pytest --cov\", depends = [\"lint\"] }\nlint = \"ruff check .\"\n"
+	if err := os.WriteFile("pvm.toml", []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+
+	config, err := loadProjectConfig()
+	if err != nil {
+		t.Fatalf("loadProjectConfig failed: %v", err)
+	}
+
+	expected := map[string]scriptConfig{
+		"test": {Command: "pytest -q"},
+		"ci":   {Command: "pytest --cov", Depends: []string{"lint"}},
+		"lint": {Command: "ruff check ."},
+	}
+	if !reflect.DeepEqual(config.Scripts, expected) {
+		t.Errorf("unexpected tasks: %+v", config.Scripts)
+	}
+
+	if err := os.WriteFile("pvm.toml", []byte("[scripts]\ntest = { command = \"pytest\" }\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+	if _, err := loadProjectConfig(); err == nil {
+		t.Errorf("expected an unknown task setting to fail")
+	}
+}
+
+func TestVenvEnvironmentPrependsPath(t *testing.T) {
+	setupTempDirectory(t)
+	t.Setenv("PATH", "/usr/bin")
+
+	if err := os.MkdirAll(filepath.Join(".venv", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".venv", "bin", "python"), nil, 0755); err != nil {
+		t.Fatalf("failed to create venv python: %v", err)
+	}
+
+	env, err := venvEnvironment()
+	if err != nil {
+		t.Fatalf("venvEnvironment failed: %v", err)
+	}
+
+	root, _ := getProjectRoot()
+	expected := "PATH=" + filepath.Join(root, ".venv", "bin") + string(os.PathListSeparator) + "/usr/bin"
+	if !slices.Contains(env, expected) {
+		t.Errorf("expected %q in the environment", expected)
+	}
+}
+
+func TestPassThroughArgs(t *testing.T) {
+	if args := passThroughArgs([]string{"--", "-k", "--"}); !reflect.DeepEqual(args, []string{"-k", "--"}) {
+		t.Errorf("expected only the first separator to be dropped, received %q", args)
+	}
+	if args := passThroughArgs([]string{"-v"}); !reflect.DeepEqual(args, []string{"-v"}) {
+		t.Errorf("expected the arguments to be kept, received %q", args)
+	}
+}
+
+func TestExitCodeOf(t *testing.T) {
+	if _, exited := exitCodeOf(nil); exited {
+		t.Errorf("expected no exit code without an error")
+	}
+	if _, exited := exitCodeOf(os.ErrNotExist); exited {
+		t.Errorf("expected no exit code for an error of pvm itself")
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found on system, skipping test")
+	}
+
+	err = exec.Command(sh, "-c", "exit 42").Run()
+	if code, exited := exitCodeOf(fmt.Errorf("task failed: %w", err)); !exited || code != 42 {
+		t.Errorf("expected exit code 42, received %d, %v", code, exited)
+	}
+}
+
+func TestRunScriptForwardsArguments(t *testing.T) {
+	setupTempDirectory(t)
+
+	if err := createVirtualEnvironment(); err != nil {
+		t.Skip("Could not create virtual environment (is python installed?):", err)
+	}
+
+	script := "import sys\nopen('args.txt', 'w').write(' '.join(sys.argv[1:]))\nsys.exit(5)\n"
+	if err := os.WriteFile("script.py", []byte(script), 0644); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	err := runScript("script.py", "--name", "a b")
+	if code, exited := exitCodeOf(err); !exited || code != 5 {
+		t.Errorf("expected the exit code of the script, received %v", err)
+	}
+
+	data, err := os.ReadFile("args.txt")
+	if err != nil {
+		t.Fatalf("script did not run: %v", err)
+	}
+	if string(data) != "--name a b" {
+		t.Errorf("unexpected arguments: %q", data)
+	}
+
+	if err := runModule("py_compile", []string{"script.py"}); err != nil {
+		t.Errorf("runModule failed: %v", err)
+	}
+}
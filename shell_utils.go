@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// shells pvm can activate the virtual environment in
+var supportedShells = []string{"bash", "zsh", "fish", "sh"}
+
+// what activating the virtual environment sets up
+type venvActivation struct {
+	VenvPath string // directory of the virtual environment, the value of VIRTUAL_ENV
+	BinDir   string // directory of its executables, put first on PATH
+	Prompt   string // name shown in front of the shell prompt
+}
+
+// returns the kind of shell, one of supportedShells, and its executable
+// the name wins over the SHELL variable of the user; POSIX shells such
+// as dash or ksh are handled like sh
+func detectShell(name string) (string, string, error) {
+	path := name
+	if path == "" {
+		path = os.Getenv("SHELL")
+		if path == "" {
+			return "", "", fmt.Errorf("could not detect your shell, pass it with --shell (%s)", strings.Join(supportedShells, ", "))
+		}
+	}
+
+	kind := strings.TrimSuffix(filepath.Base(path), ".exe")
+	switch kind {
+	case "bash", "zsh", "fish", "sh":
+	case "dash", "ash", "ksh", "mksh":
+		kind = "sh"
+	default:
+		return "", "", fmt.Errorf("unsupported shell %s, pvm supports %s", kind, strings.Join(supportedShells, ", "))
+	}
+
+	if !filepath.IsAbs(path) {
+		lookedUp, err := exec.LookPath(path)
+		if err != nil {
+			return "", "", fmt.Errorf("shell %s not found", path)
+		}
+		path = lookedUp
+	}
+
+	return kind, path, nil
+}
+
+// returns the activation of the virtual environment of the project
+func getVenvActivation() (venvActivation, error) {
+	pythonPath, err := getVenvPythonPath()
+	if err != nil {
+		return venvActivation{}, err
+	}
+	binDir := filepath.Dir(pythonPath)
+	venvPath := filepath.Dir(binDir)
+
+	// like the activate script, use the prompt given to the venv module
+	// and the name of the project otherwise
+	root, err := getProjectRoot()
+	if err != nil {
+		return venvActivation{}, err
+	}
+	prompt := filepath.Base(root)
+
+	config, err := readVenvConfig()
+	if err == nil && config != nil && config.Prompt != "" {
+		prompt = config.Prompt
+	}
+
+	return venvActivation{VenvPath: venvPath, BinDir: binDir, Prompt: prompt}, nil
+}
+
+// quotes the value for bash, zsh and sh
+func quotePosix(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// quotes the value for fish
+func quoteFish(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// returns the shell code activating the virtual environment in the
+// kind of shell, with a deactivate function undoing it
+// running it again first deactivates the earlier activation
+func activationScript(kind string, activation venvActivation) string {
+	prefix := "(" + activation.Prompt + ") "
+
+	if kind == "fish" {
+		return strings.Join([]string{
+			"set -q _pvm_old_path; and deactivate",
+			"set -g _pvm_old_path $PATH",
+			"set -gx VIRTUAL_ENV " + quoteFish(activation.VenvPath),
+			"set -gx VIRTUAL_ENV_PROMPT " + quoteFish(activation.Prompt),
+			"set -gx PATH " + quoteFish(activation.BinDir) + " $PATH",
+			"if set -q PYTHONHOME; set -g _pvm_old_pythonhome $PYTHONHOME; set -e PYTHONHOME; end",
+			"functions -c fish_prompt _pvm_old_fish_prompt",
+			"function fish_prompt",
+			"    set -l old_status $status",
+			"    printf '%s' " + quoteFish(prefix),
+			`    echo "exit $old_status" | source`,
+			"    _pvm_old_fish_prompt",
+			"end",
+			"function deactivate",
+			"    set -gx PATH $_pvm_old_path",
+			"    if set -q _pvm_old_pythonhome; set -gx PYTHONHOME $_pvm_old_pythonhome; end",
+			"    functions -e fish_prompt",
+			"    functions -c _pvm_old_fish_prompt fish_prompt",
+			"    functions -e _pvm_old_fish_prompt",
+			"    set -e VIRTUAL_ENV",
+			"    set -e VIRTUAL_ENV_PROMPT",
+			"    set -e _pvm_old_path",
+			"    set -e _pvm_old_pythonhome",
+			"    functions -e deactivate",
+			"end",
+		}, "\n") + "\n"
+	}
+
+	return strings.Join([]string{
+		`if [ -n "${_PVM_OLD_PATH+set}" ]; then deactivate; fi`,
+		`_PVM_OLD_PATH="$PATH"`,
+		`_PVM_OLD_PS1="${PS1-}"`,
+		"export VIRTUAL_ENV=" + quotePosix(activation.VenvPath),
+		"export VIRTUAL_ENV_PROMPT=" + quotePosix(activation.Prompt),
+		"export PATH=" + quotePosix(activation.BinDir) + `:"$PATH"`,
+		`if [ -n "${PYTHONHOME+set}" ]; then _PVM_OLD_PYTHONHOME="$PYTHONHOME"; unset PYTHONHOME; fi`,
+		"PS1=" + quotePosix(prefix) + `"${PS1-}"`,
+		"deactivate () {",
+		`    PATH="$_PVM_OLD_PATH"; export PATH`,
+		`    PS1="$_PVM_OLD_PS1"`,
+		`    if [ -n "${_PVM_OLD_PYTHONHOME+set}" ]; then PYTHONHOME="$_PVM_OLD_PYTHONHOME"; export PYTHONHOME; fi`,
+		"    unset VIRTUAL_ENV VIRTUAL_ENV_PROMPT _PVM_OLD_PATH _PVM_OLD_PS1 _PVM_OLD_PYTHONHOME",
+		"    unset -f deactivate",
+		"    hash -r 2>/dev/null",
+		"}",
+		"hash -r 2>/dev/null",
+	}, "\n") + "\n"
+}
+
+// returns the command telling the user how to evaluate the
+// activation script in the kind of shell
+func activationHint(kind string) string {
+	if kind == "fish" {
+		return "pvm activate --print | source"
+	}
+	return `eval "$(pvm activate --print)"`
+}
+
+// returns the command starting the shell with the activation script run
+// after the startup files of the user, which would otherwise override the
+// prompt and PATH, and the files it needs in dir
+func activatedShellCommand(kind string, path string, script string, dir string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	env := os.Environ()
+
+	switch kind {
+	case "bash":
+		rcFile := filepath.Join(dir, "bashrc")
+		content := "if [ -f ~/.bashrc ]; then . ~/.bashrc; fi\n" + script
+		if err := os.WriteFile(rcFile, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(path, "--rcfile", rcFile, "-i")
+	case "zsh":
+		// zsh reads its startup files from ZDOTDIR, which points to dir
+		// until the .zshrc of the user is sourced
+		userDir := os.Getenv("ZDOTDIR")
+		if userDir == "" {
+			userDir = os.Getenv("HOME")
+		}
+		userEnv := quotePosix(filepath.Join(userDir, ".zshenv"))
+		files := map[string]string{
+			".zshenv": "if [ -f " + userEnv + " ]; then . " + userEnv + "; fi\n",
+			".zshrc": "ZDOTDIR=" + quotePosix(userDir) + "\n" +
+				"if [ -f \"$ZDOTDIR/.zshrc\" ]; then . \"$ZDOTDIR/.zshrc\"; fi\n" + script,
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				return nil, err
+			}
+		}
+		cmd = exec.Command(path, "-i")
+		env = append(env, "ZDOTDIR="+dir)
+	case "fish":
+		cmd = exec.Command(path, "--init-command", script)
+	default:
+		// interactive POSIX shells run the file named by ENV
+		rcFile := filepath.Join(dir, "shrc")
+		content := script
+		if userFile := os.Getenv("ENV"); userFile != "" {
+			content = "if [ -f " + quotePosix(userFile) + " ]; then . " + quotePosix(userFile) + "; fi\n" + script
+		}
+		if err := os.WriteFile(rcFile, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(path, "-i")
+		env = append(env, "ENV="+rcFile)
+	}
+
+	cmd.Env = env
+	return cmd, nil
+}
+
+// starts the shell of the user with the virtual environment activated
+// and waits for it to exit
+func spawnActivatedShell(shellName string) error {
+	kind, path, err := detectShell(shellName)
+	if err != nil {
+		return err
+	}
+
+	activation, err := getVenvActivation()
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "pvm-shell-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd, err := activatedShellCommand(kind, path, activationScript(kind, activation), dir)
+	if err != nil {
+		return err
+	}
+
+	return runAttached(cmd)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectShell(t *testing.T) {
+	cases := map[string]string{
+		"/bin/bash":           "bash",
+		"/usr/local/bin/zsh":  "zsh",
+		"/opt/homebrew/fish":  "fish",
+		"/bin/sh":             "sh",
+		"/usr/bin/dash":       "sh",
+		"/usr/local/bin/mksh": "sh",
+	}
+
+	for path, expected := range cases {
+		t.Setenv("SHELL", path)
+		kind, shellPath, err := detectShell("")
+		if err != nil {
+			t.Errorf("detectShell with SHELL=%s failed: %v", path, err)
+			continue
+		}
+		if kind != expected || shellPath != path {
+			t.Errorf("SHELL=%s: expected %s at %s, received %s at %s", path, expected, path, kind, shellPath)
+		}
+	}
+
+	t.Setenv("SHELL", "/bin/bash")
+	if kind, _, err := detectShell("/usr/bin/fish"); err != nil || kind != "fish" {
+		t.Errorf("expected the shell name to win over SHELL, received %s, %v", kind, err)
+	}
+
+	t.Setenv("SHELL", "/usr/bin/tcsh")
+	if _, _, err := detectShell(""); err == nil {
+		t.Errorf("expected tcsh to be unsupported")
+	}
+
+	t.Setenv("SHELL", "")
+	if _, _, err := detectShell(""); err == nil {
+		t.Errorf("expected a missing SHELL to fail")
+	}
+}
+
+func TestQuoteShellValues(t *testing.T) {
+	if quoted := quotePosix("it's here"); quoted != `'it'\''s here'` {
+		t.Errorf("unexpected posix quoting: %s", quoted)
+	}
+	if quoted := quoteFish(`it's a\b`); quoted != `'it\'s a\\b'` {
+		t.Errorf("unexpected fish quoting: %s", quoted)
+	}
+}
+
+func TestActivationScriptInPosixShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found, skipping test")
+	}
+
+	dir := t.TempDir()
+	activation := venvActivation{
+		VenvPath: filepath.Join(dir, "it's .venv"),
+		BinDir:   filepath.Join(dir, "it's .venv", "bin"),
+		Prompt:   "project",
+	}
+	script := activationScript("sh", activation)
+
+	// activating twice must not stack the prompt or PATH entries
+	check := script + script + `printf '%s\n' "$VIRTUAL_ENV" "$PS1" "${PATH%%:*}"` + "\n" +
+		"deactivate\n" + `printf '%s\n' "[${VIRTUAL_ENV-}]" "$PS1" "$PATH"` + "\n"
+
+	cmd := exec.Command(sh, "-c", check)
+	cmd.Env = append(os.Environ(), "PS1=$ ", "PATH=/usr/bin:/bin")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("the activation script failed: %v\n%s", err, output)
+	}
+
+	expected := []string{
+		activation.VenvPath, "(project) $ ", activation.BinDir,
+		"[]", "$ ", "/usr/bin:/bin",
+	}
+	if lines := strings.Split(strings.TrimSpace(string(output)), "\n"); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, received %q", expected, lines)
+	}
+}
+
+func TestActivationScriptForFish(t *testing.T) {
+	activation := venvActivation{VenvPath: "/project/.venv", BinDir: "/project/.venv/bin", Prompt: "project"}
+	script := activationScript("fish", activation)
+
+	for _, line := range []string{
+		"set -gx VIRTUAL_ENV '/project/.venv'",
+		"set -gx PATH '/project/.venv/bin' $PATH",
+		"function deactivate",
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("expected %q in the fish activation script", line)
+		}
+	}
+}
+
+func TestGetVenvActivationUsesVenvPrompt(t *testing.T) {
+	setupTempDirectory(t)
+
+	if err := os.MkdirAll(filepath.Join(".venv", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".venv", "bin", "python"), nil, 0755); err != nil {
+		t.Fatalf("failed to create venv python: %v", err)
+	}
+
+	root, _ := getProjectRoot()
+
+	activation, err := getVenvActivation()
+	if err != nil {
+		t.Fatalf("getVenvActivation failed: %v", err)
+	}
+	if activation.Prompt != filepath.Base(root) || activation.VenvPath != filepath.Join(root, ".venv") {
+		t.Errorf("unexpected activation %+v", activation)
+	}
+
+	if err := os.WriteFile(filepath.Join(".venv", "pyvenv.cfg"), []byte("prompt = 'custom'\n"), 0644); err != nil {
+		t.Fatalf("failed to write pyvenv.cfg: %v", err)
+	}
+
+	activation, err = getVenvActivation()
+	if err != nil {
+		t.Fatalf("getVenvActivation failed: %v", err)
+	}
+	if activation.Prompt != "custom" {
+		t.Errorf("expected the prompt of pyvenv.cfg, received %s", activation.Prompt)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// a single change pvm sync makes to the virtual environment
+type syncAction struct {
+	Name      string
+	Installed string                // installed version, empty when the package is missing
+	Wanted    string                // wanted version or specifier, empty when removing
+	Scripts   []string              // commands removed with the package
+	req       requirement           // requirement passed to pip when installing
+	dist      installedDistribution // installed distribution, set when removing
+}
+
+// the changes needed to make the virtual environment
+// match the declared packages
+type syncPlan struct {
+	Install []syncAction // declared packages that are missing
+	Change  []syncAction // installed packages with the wrong version
+	Remove  []syncAction // installed packages nothing declares
+	Locked  bool         // true if the plan was computed from pvm.lock
+}
+
+// returns true if the plan does not change anything
+func (p syncPlan) empty() bool {
+	return len(p.Install) == 0 && len(p.Change) == 0 && len(p.Remove) == 0
+}
+
+// returns the plan as human readable lines
+func (p syncPlan) lines() []string {
+	var lines []string
+	for _, action := range p.Install {
+		lines = append(lines, fmt.Sprintf("+ %s %s", action.Name, action.Wanted))
+	}
+	for _, action := range p.Change {
+		lines = append(lines, fmt.Sprintf("~ %s %s -> %s", action.Name, action.Installed, action.Wanted))
+	}
+	for _, action := range p.Remove {
+		line := fmt.Sprintf("- %s %s", action.Name, action.Installed)
+		if len(action.Scripts) > 0 {
+			line += fmt.Sprintf(" (removes %s)", strings.Join(action.Scripts, ", "))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// returns true if the installed version satisfies the specifier
+// installed pre-releases are compared like final releases, and versions
+// or specifiers pvm cannot parse are only checked for === pins
+func satisfiesSpecifier(specifier string, version string) bool {
+	specifiers, err := pep440.ParseSpecifierSet(specifier)
+	if err != nil {
+		return true
+	}
+
+	parsed, err := pep440.Parse(version)
+	if err != nil {
+		for _, spec := range specifiers {
+			if spec.Operator == "===" && !strings.EqualFold(spec.Version, version) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return specifiers.Contains(parsed, true)
+}
+
+// returns the removals for every installed distribution that is
+// not part of the kept set and is not packaging tooling
+func planRemovals(distributions []installedDistribution, keep func(key string) bool) []syncAction {
+	var removals []syncAction
+	for _, dist := range distributions {
+		key := normalizeName(dist.Name)
+		if !keep(key) && !isPipTooling(key) {
+			// the scripts are only shown, a distribution pvm cannot read them from is still removed
+			scripts, _ := dist.installedScripts()
+			removals = append(removals, syncAction{Name: key, Installed: dist.Version, Scripts: scripts, dist: dist})
+		}
+	}
+	return removals
+}
+
+// computes the plan that makes the installed distributions match
+// the top-level requirements and everything they depend on
+// requirements that do not apply to the environment are not installed,
+// but kept when they are
+func planSyncFromRequirements(requirements []requirement, distributions []installedDistribution, env markerEnvironment) (syncPlan, error) {
+	var plan syncPlan
+
+	installed := make(map[string]installedDistribution)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist
+	}
+
+	var present []requirement
+	for _, req := range requirements {
+		if !req.appliesTo(env) {
+			continue
+		}
+
+		dist, found := installed[req.key()]
+		action := syncAction{Name: req.key(), Wanted: req.Specifier, req: req}
+		if action.Wanted == "" {
+			action.Wanted = req.URL
+		}
+
+		if !found {
+			plan.Install = append(plan.Install, action)
+			continue
+		}
+
+		if req.URL == "" && !satisfiesSpecifier(req.Specifier, dist.Version) {
+			action.Installed = dist.Version
+			plan.Change = append(plan.Change, action)
+		}
+
+		// the current dependencies are kept, pip updates them when needed
+		present = append(present, req)
+	}
+
+	closure, err := dependencyClosure(present, distributions, env)
+	if err != nil {
+		return plan, err
+	}
+
+	declared := make(map[string]struct{})
+	for _, req := range requirements {
+		declared[req.key()] = struct{}{}
+	}
+
+	plan.Remove = planRemovals(distributions, func(key string) bool {
+		_, inClosure := closure[key]
+		_, isDeclared := declared[key]
+		return inClosure || isDeclared
+	})
+
+	return plan, nil
+}
+
+// computes the plan that makes the installed distributions
+// match the lock file exactly
+// locked packages whose marker does not apply to the environment are
+// treated as if they were not locked
+func planSyncFromLockFile(lock lockFile, distributions []installedDistribution, env markerEnvironment) (syncPlan, error) {
+	plan := syncPlan{Locked: true}
+
+	installed := make(map[string]installedDistribution)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist
+	}
+
+	locked := make(map[string]struct{})
+	for _, pkg := range lock.Packages {
+		if !pkg.appliesTo(env) {
+			continue
+		}
+		locked[normalizeName(pkg.Name)] = struct{}{}
+
+		dist, found := installed[normalizeName(pkg.Name)]
+		if found && dist.Version == pkg.Version {
+			continue
+		}
+
+		req, err := lockedRequirement(pkg)
+		if err != nil {
+			return plan, err
+		}
+
+		action := syncAction{Name: normalizeName(pkg.Name), Wanted: pkg.Version, req: req}
+		if found {
+			action.Installed = dist.Version
+			plan.Change = append(plan.Change, action)
+		} else {
+			plan.Install = append(plan.Install, action)
+		}
+	}
+
+	plan.Remove = planRemovals(distributions, func(key string) bool {
+		_, found := locked[key]
+		return found
+	})
+
+	return plan, nil
+}
+
+// computes the sync plan for the main dependencies and the selected
+// groups, using the pvm.lock file when it exists and the project manifest otherwise
+// fails when the lock file does not match the manifest anymore, instead of
+// removing the packages installed since it was written
+func planSync(groups []string) (syncPlan, error) {
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return syncPlan{}, err
+	}
+
+	env, err := getMarkerEnvironment()
+	if err != nil {
+		return syncPlan{}, err
+	}
+
+	lockPath, err := getFilePath(lockFileName)
+	if err != nil {
+		return syncPlan{}, err
+	}
+
+	if lockPath != "" {
+		lock, err := readLockFile()
+		if err != nil {
+			return syncPlan{}, err
+		}
+
+		// the lock file covers every group, not only the selected ones
+		allGroups, err := listDependencyGroups()
+		if err != nil {
+			return syncPlan{}, err
+		}
+
+		declared, err := getRequirementsOfGroups(allGroups)
+		if err != nil {
+			return syncPlan{}, err
+		}
+
+		if err := lock.checkCurrent(declared, env); err != nil {
+			return syncPlan{}, err
+		}
+		return planSyncFromLockFile(lock.forGroups(groups), distributions, env)
+	}
+
+	requirements, err := getRequirementsOfGroups(groups)
+	if err != nil {
+		return syncPlan{}, err
+	}
+
+	return planSyncFromRequirements(requirements, distributions, env)
+}
+
+// applies the sync plan to the virtual environment
+func applySyncPlan(plan syncPlan) error {
+	if len(plan.Remove) > 0 {
+		venvPath, err := getVenvPath()
+		if err != nil {
+			return err
+		}
+
+		// distributions without a RECORD file are left to pip
+		var names []string
+		for _, action := range plan.Remove {
+			if _, err := os.Stat(filepath.Join(action.dist.Path, "RECORD")); action.dist.Path == "" || err != nil {
+				names = append(names, action.Name)
+				continue
+			}
+			if err := removeDistribution(action.dist, venvPath); err != nil {
+				return err
+			}
+		}
+
+		if len(names) > 0 {
+			if err := uninstallPackages(names); err != nil {
+				return err
+			}
+		}
+	}
+
+	actions := slices.Concat(plan.Install, plan.Change)
+	if len(actions) == 0 {
+		return nil
+	}
+
+	var lines []string
+	for _, action := range actions {
+		lines = append(lines, action.req.String())
+	}
+
+	if plan.Locked {
+		return installRequirementLines(lines, "--require-hashes", "--no-deps")
+	}
+
+	return installRequirementLines(lines)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSatisfiesSpecifier(t *testing.T) {
+	cases := []struct {
+		specifier string
+		version   string
+		expected  bool
+	}{
+		{"", "1.0", true},
+		{"==1.0", "1.0", true},
+		{"==1.0", "1.1", false},
+		{"==1.*", "1.4.2", true},
+		{"==1.*", "10.0", false},
+		{"===1.0-foo", "1.0-foo", true},
+		{">=1.0,==2.0", "2.0", true},
+		{">=1.0,==2.0", "1.5", false},
+		{">=3.0", "1.0", false},
+		{">=1.0,<2", "1.5", true},
+		{"==1.0", "1.0.0", true},
+		{"==2.1.0", "2.1.0+cpu", true},
+		{"~=1.4", "2.0", false},
+		{">=1.0", "2.0rc1", true},
+		{"===1.0", "1.0.0", false},
+		{"==1.0", "not-a-version", true},
+	}
+
+	for _, c := range cases {
+		if actual := satisfiesSpecifier(c.specifier, c.version); actual != c.expected {
+			t.Errorf("satisfiesSpecifier(%q, %q): expected %v, received %v", c.specifier, c.version, c.expected, actual)
+		}
+	}
+}
+
+func TestPlanSyncFromRequirements(t *testing.T) {
+	requirements := []requirement{
+		{Name: "Flask", Specifier: "==2.0.0"},
+		{Name: "requests"},
+		{Name: "django", Specifier: ">=5"},
+		{Name: "pywin32", Marker: `sys_platform == "win32"`},
+		{Name: "black", Marker: `sys_platform == "win32"`},
+	}
+
+	plan, err := planSyncFromRequirements(requirements, testDistributions(), testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("planSyncFromRequirements failed: %v", err)
+	}
+
+	expected := []string{
+		"+ django >=5",
+		"~ flask 3.0.0 -> ==2.0.0",
+		"- pysocks 1.7.1",
+	}
+
+	if !reflect.DeepEqual(plan.lines(), expected) {
+		t.Errorf("unexpected plan: %q", plan.lines())
+	}
+}
+
+func TestPlanSyncFromLockFile(t *testing.T) {
+	lock := lockFile{Version: lockFileVersion, Packages: []lockedPackage{
+		{Name: "idna", Version: "3.6", SHA256: "aa"},
+		{Name: "requests", Version: "2.32.0", SHA256: "bb"},
+		{Name: "urllib3", Version: "2.1.0", SHA256: "cc"},
+		{Name: "pywin32", Version: "306", SHA256: "dd", Marker: `sys_platform == "win32"`},
+	}}
+
+	distributions := []installedDistribution{
+		{Name: "idna", Version: "3.6"},
+		{Name: "requests", Version: "2.31.0"},
+		{Name: "black", Version: "24.1.0"},
+		{Name: "pip", Version: "23.2.1"},
+	}
+
+	plan, err := planSyncFromLockFile(lock, distributions, testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("planSyncFromLockFile failed: %v", err)
+	}
+
+	expected := []string{
+		"+ urllib3 2.1.0",
+		"~ requests 2.31.0 -> 2.32.0",
+		"- black 24.1.0",
+	}
+
+	if !reflect.DeepEqual(plan.lines(), expected) {
+		t.Errorf("unexpected plan: %q", plan.lines())
+	}
+
+	if !plan.Locked || plan.Install[0].req.String() != "urllib3==2.1.0 --hash=sha256:cc" {
+		t.Errorf("expected locked packages to be installed with hashes: %+v", plan.Install[0].req)
+	}
+}
+
+func TestPlanSyncInSync(t *testing.T) {
+	distributions := []installedDistribution{
+		{Name: "idna", Version: "3.6"},
+		{Name: "pip", Version: "23.2.1"},
+	}
+
+	plan, err := planSyncFromRequirements([]requirement{{Name: "idna", Specifier: "==3.6"}}, distributions, testMarkerEnvironment())
+	if err != nil {
+		t.Fatalf("planSyncFromRequirements failed: %v", err)
+	}
+
+	if !plan.empty() {
+		t.Errorf("expected an empty plan, received %q", plan.lines())
+	}
+}
+
+func TestSyncPlanShowsRemovedScripts(t *testing.T) {
+	plan := syncPlan{Remove: []syncAction{
+		{Name: "black", Installed: "24.1.0", Scripts: []string{"black", "blackd"}},
+		{Name: "idna", Installed: "3.6"},
+	}}
+
+	expected := []string{"- black 24.1.0 (removes black, blackd)", "- idna 3.6"}
+	if !reflect.DeepEqual(plan.lines(), expected) {
+		t.Errorf("unexpected plan: %q", plan.lines())
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// a package in the dependency tree printed by pvm tree
+type dependencyNode struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version,omitempty"`   // empty when the package is not installed
+	Specifier    string            `json:"specifier,omitempty"` // version required on the edge to the parent
+	Declared     bool              `json:"declared,omitempty"`  // a top-level requirement of the project, set in reverse trees
+	Missing      bool              `json:"missing,omitempty"`   // required but not installed
+	Cycle        bool              `json:"cycle,omitempty"`     // already on the path from the root, not expanded again
+	Dependencies []*dependencyNode `json:"dependencies,omitempty"`
+}
+
+// a package requiring another one
+type dependentEdge struct {
+	Name string      // canonical name of the package requiring it
+	Req  requirement // the requirement it declares
+}
+
+// the installed distributions and the requirements linking them
+type dependencyGraph struct {
+	versions   map[string]string          // installed versions keyed by canonical name
+	edges      map[string][]requirement   // requirements of every installed distribution
+	dependents map[string][]dependentEdge // packages requiring every package
+	roots      []requirement              // top-level requirements of the project
+}
+
+// builds the dependency graph of the installed distributions
+// the extras the top-level requirements and the dependencies ask for are
+// followed; requirements whose environment marker does not apply to the
+// environment are left out, the others are kept even when not installed
+func buildDependencyGraph(roots []requirement, distributions []installedDistribution, env markerEnvironment) dependencyGraph {
+	graph := dependencyGraph{
+		versions:   make(map[string]string),
+		edges:      make(map[string][]requirement),
+		dependents: make(map[string][]dependentEdge),
+	}
+
+	installed := make(map[string]installedDistribution)
+	for _, dist := range distributions {
+		installed[normalizeName(dist.Name)] = dist
+		graph.versions[normalizeName(dist.Name)] = dist.Version
+	}
+
+	// top-level requirements that do not apply to the environment are left out
+	roots = slices.DeleteFunc(slices.Clone(roots), func(req requirement) bool {
+		return !req.appliesTo(env)
+	})
+
+	// collect the extras every distribution is needed with
+	extras := make(map[string][]string)
+	queue := slices.Clone(roots)
+	for len(queue) > 0 {
+		req := queue[0]
+		queue = queue[1:]
+
+		dist, found := installed[req.key()]
+		if !found {
+			continue
+		}
+
+		followed, seen := extras[req.key()]
+		var newExtras []string
+		for _, extra := range req.Extras {
+			if !slices.Contains(followed, normalizeName(extra)) {
+				newExtras = append(newExtras, normalizeName(extra))
+			}
+		}
+		if seen && len(newExtras) == 0 {
+			continue
+		}
+		extras[req.key()] = append(followed, newExtras...)
+
+		queue = append(queue, distributionDependencies(dist, extras[req.key()], env)...)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(installed)) {
+		for _, dependency := range distributionDependencies(installed[key], extras[key], env) {
+			graph.edges[key] = append(graph.edges[key], dependency)
+			graph.dependents[dependency.key()] = append(graph.dependents[dependency.key()], dependentEdge{Name: key, Req: dependency})
+		}
+
+		slices.SortFunc(graph.edges[key], func(a, b requirement) int {
+			return strings.Compare(a.key(), b.key())
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		if !seen[root.key()] {
+			seen[root.key()] = true
+			graph.roots = append(graph.roots, root)
+		}
+	}
+
+	return graph
+}
+
+// returns the part of a requirement describing the versions it accepts
+func requirementConstraint(req requirement) string {
+	if req.URL != "" {
+		return req.URL
+	}
+	if req.Specifier != "" {
+		return req.Specifier
+	}
+	return "any"
+}
+
+// returns true if the package is one of the top-level requirements
+func (g dependencyGraph) isRoot(key string) bool {
+	return slices.ContainsFunc(g.roots, func(req requirement) bool {
+		return req.key() == key
+	})
+}
+
+// returns the trees of the top-level requirements, each followed
+// by its dependencies down to depth levels, all of them when depth
+// is negative
+func (g dependencyGraph) tree(depth int) []*dependencyNode {
+	var visit func(req requirement, path []string, depth int) *dependencyNode
+	visit = func(req requirement, path []string, depth int) *dependencyNode {
+		node := &dependencyNode{Name: req.key(), Specifier: requirementConstraint(req)}
+
+		version, installed := g.versions[req.key()]
+		if !installed {
+			node.Missing = true
+			return node
+		}
+		node.Version = version
+
+		if slices.Contains(path, req.key()) {
+			node.Cycle = true
+			return node
+		}
+		if depth == 0 {
+			return node
+		}
+
+		path = append(path, req.key())
+		for _, dependency := range g.edges[req.key()] {
+			node.Dependencies = append(node.Dependencies, visit(dependency, path, depth-1))
+		}
+		return node
+	}
+
+	nodes := make([]*dependencyNode, 0, len(g.roots))
+	for _, root := range g.roots {
+		nodes = append(nodes, visit(root, nil, depth))
+	}
+	return nodes
+}
+
+// returns the tree of the packages requiring the package, each followed
+// by the packages requiring it down to depth levels, all of them when
+// depth is negative
+func (g dependencyGraph) reverseTree(name string, depth int) (*dependencyNode, error) {
+	key := normalizeName(name)
+	version, installed := g.versions[key]
+	if !installed {
+		return nil, fmt.Errorf("%s is not installed", name)
+	}
+
+	var visit func(node *dependencyNode, path []string, depth int)
+	visit = func(node *dependencyNode, path []string, depth int) {
+		if slices.Contains(path, node.Name) {
+			node.Cycle = true
+			return
+		}
+		if depth == 0 {
+			return
+		}
+
+		path = append(path, node.Name)
+		for _, dependent := range g.dependents[node.Name] {
+			child := &dependencyNode{
+				Name:      dependent.Name,
+				Version:   g.versions[dependent.Name],
+				Specifier: requirementConstraint(dependent.Req),
+				Declared:  g.isRoot(dependent.Name),
+			}
+			visit(child, path, depth-1)
+			node.Dependencies = append(node.Dependencies, child)
+		}
+	}
+
+	root := &dependencyNode{Name: key, Version: version, Declared: g.isRoot(key)}
+	visit(root, nil, depth)
+	return root, nil
+}
+
+// the most paths pvm why shows from a single top-level requirement, the
+// number of paths grows exponentially on graphs sharing many packages
+const maxPathsPerRoot = 10
+
+// returns the paths from the top-level requirements to the package, each
+// path holding the requirements followed from the top-level one down to
+// the package; paths do not visit a package twice
+// at most maxPathsPerRoot paths are returned for every top-level
+// requirement, the bool is true if paths were left out
+func (g dependencyGraph) paths(name string) ([][]requirement, bool, error) {
+	key := normalizeName(name)
+	if _, installed := g.versions[key]; !installed {
+		return nil, false, fmt.Errorf("%s is not installed", name)
+	}
+
+	// the packages the package can be reached from, so that the walk
+	// only follows requirements leading to it
+	reaches := map[string]bool{key: true}
+	queue := []string{key}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range g.dependents[current] {
+			if !reaches[edge.Name] {
+				reaches[edge.Name] = true
+				queue = append(queue, edge.Name)
+			}
+		}
+	}
+
+	var paths [][]requirement
+	truncated := false
+
+	for _, root := range g.roots {
+		if !reaches[root.key()] {
+			continue
+		}
+
+		found := 0
+		var visit func(path []requirement)
+		visit = func(path []requirement) {
+			if found == maxPathsPerRoot {
+				truncated = true
+				return
+			}
+
+			last := path[len(path)-1].key()
+			if last == key {
+				paths = append(paths, slices.Clone(path))
+				found++
+				return
+			}
+
+			for _, dependency := range g.edges[last] {
+				if !reaches[dependency.key()] || slices.ContainsFunc(path, func(req requirement) bool { return req.key() == dependency.key() }) {
+					continue
+				}
+				visit(append(path, dependency))
+			}
+		}
+		visit([]requirement{root})
+	}
+
+	return paths, truncated, nil
+}
+
+// returns the path as the requirements followed, separated by arrows
+func formatDependencyPath(path []requirement) string {
+	steps := make([]string, 0, len(path))
+	for _, req := range path {
+		step := req.key()
+		if req.Extras != nil {
+			step += "[" + strings.Join(req.Extras, ",") + "]"
+		}
+		switch {
+		case req.URL != "":
+			step += " @ " + req.URL
+		case req.Specifier != "":
+			step += req.Specifier
+		}
+		steps = append(steps, step)
+	}
+	return strings.Join(steps, " -> ")
+}
+
+// returns the dependency graph of the virtual environment, rooted at the
+// requirements of the main dependencies and of every dependency group
+func loadDependencyGraph() (dependencyGraph, error) {
+	groups, err := getDeclaredGroups()
+	if err != nil {
+		return dependencyGraph{}, err
+	}
+
+	distributions, err := inspectVirtualEnvironment()
+	if err != nil {
+		return dependencyGraph{}, err
+	}
+
+	env, err := getMarkerEnvironment()
+	if err != nil {
+		return dependencyGraph{}, err
+	}
+
+	roots := groups[mainGroup]
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		if name != mainGroup {
+			roots = append(roots, groups[name]...)
+		}
+	}
+
+	return buildDependencyGraph(roots, distributions, env), nil
+}
+
+// writes the trees with box drawing lines
+// required versions are shown as "required" in dependency trees and as
+// "requires" in reverse trees, where the edge points the other way
+func writeDependencyTree(w io.Writer, nodes []*dependencyNode, reverse bool) error {
+	var write func(node *dependencyNode, prefix string, connector string, top bool) error
+	write = func(node *dependencyNode, prefix string, connector string, top bool) error {
+		line := node.Name
+		if node.Version != "" {
+			line += " " + node.Version
+		}
+		if node.Specifier != "" && !top {
+			if reverse {
+				line += " [requires: " + node.Specifier + "]"
+			} else {
+				line += " [required: " + node.Specifier + "]"
+			}
+		}
+		if node.Declared && !top {
+			line += " (declared)"
+		}
+		if node.Missing {
+			line += " (not installed)"
+		}
+		if node.Cycle {
+			line += " (cycle)"
+		}
+
+		if _, err := fmt.Fprintln(w, prefix+connector+line); err != nil {
+			return err
+		}
+
+		childPrefix := prefix
+		switch connector {
+		case "├── ":
+			childPrefix += "│   "
+		case "└── ":
+			childPrefix += "    "
+		}
+
+		for i, child := range node.Dependencies {
+			childConnector := "├── "
+			if i == len(node.Dependencies)-1 {
+				childConnector = "└── "
+			}
+			if err := write(child, childPrefix, childConnector, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, node := range nodes {
+		if err := write(node, "", "", true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes the trees as a Graphviz digraph, with an edge from every
+// package to each package it requires
+func writeDependencyDot(w io.Writer, nodes []*dependencyNode, reverse bool) error {
+	var lines []string
+	seen := make(map[string]bool)
+
+	add := func(line string) {
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+
+	var visit func(node *dependencyNode)
+	visit = func(node *dependencyNode) {
+		label := node.Name
+		if node.Version != "" {
+			label += "\\n" + node.Version
+		}
+		add(fmt.Sprintf("\t%q [label=\"%s\"];", node.Name, strings.ReplaceAll(label, `"`, `\"`)))
+
+		for _, child := range node.Dependencies {
+			from, to := node.Name, child.Name
+			if reverse {
+				from, to = to, from
+			}
+			add(fmt.Sprintf("\t%q -> %q [label=%q];", from, to, child.Specifier))
+			visit(child)
+		}
+	}
+
+	for _, node := range nodes {
+		visit(node)
+	}
+
+	_, err := fmt.Fprintf(w, "digraph dependencies {\n%s\n}\n", strings.Join(lines, "\n"))
+	return err
+}
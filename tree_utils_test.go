@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// distributions with a cycle between a and b, an extra and a
+// dependency that is not installed
+func testGraphDistributions() []installedDistribution {
+	return []installedDistribution{
+		{Name: "app", Version: "1.0", RequiresDist: []string{"a>=1", "c[fast]", "ghost; sys_platform == \"win32\""}},
+		{Name: "a", Version: "1.2", RequiresDist: []string{"b<3"}},
+		{Name: "b", Version: "2.0", RequiresDist: []string{"a", "missing>=0.5"}},
+		{Name: "c", Version: "0.9", RequiresDist: []string{"speedups; extra == \"fast\"", "docs; extra == \"docs\""}},
+		{Name: "speedups", Version: "4.1"},
+		{Name: "docs", Version: "1.0"},
+	}
+}
+
+func TestDependencyTree(t *testing.T) {
+	graph := buildDependencyGraph([]requirement{{Name: "app", Specifier: "==1.0"}}, testGraphDistributions(), testMarkerEnvironment())
+
+	var output bytes.Buffer
+	if err := writeDependencyTree(&output, graph.tree(-1), false); err != nil {
+		t.Fatalf("writeDependencyTree failed: %v", err)
+	}
+
+	expected := `app 1.0
+├── a 1.2 [required: >=1]
+│   └── b 2.0 [required: <3]
+│       ├── a 1.2 [required: any] (cycle)
+│       └── missing [required: >=0.5] (not installed)
+└── c 0.9 [required: any]
+    └── speedups 4.1 [required: any]
+`
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\nreceived:\n%s", expected, output.String())
+	}
+}
+
+func TestDependencyTreeDepth(t *testing.T) {
+	graph := buildDependencyGraph([]requirement{{Name: "app"}}, testGraphDistributions(), testMarkerEnvironment())
+
+	nodes := graph.tree(1)
+	if len(nodes) != 1 || len(nodes[0].Dependencies) != 2 {
+		t.Fatalf("expected app with two dependencies, received %+v", nodes)
+	}
+	for _, child := range nodes[0].Dependencies {
+		if len(child.Dependencies) != 0 {
+			t.Errorf("expected %s not to be expanded at depth 1", child.Name)
+		}
+	}
+
+	if nodes := graph.tree(0); len(nodes[0].Dependencies) != 0 {
+		t.Errorf("expected only the top-level packages at depth 0")
+	}
+}
+
+func TestReverseDependencyTree(t *testing.T) {
+	graph := buildDependencyGraph([]requirement{{Name: "app"}}, testGraphDistributions(), testMarkerEnvironment())
+
+	if _, err := graph.reverseTree("ghost", -1); err == nil {
+		t.Errorf("expected a package that is not installed to fail")
+	}
+
+	node, err := graph.reverseTree("B", -1)
+	if err != nil {
+		t.Fatalf("reverseTree failed: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := writeDependencyTree(&output, []*dependencyNode{node}, true); err != nil {
+		t.Fatalf("writeDependencyTree failed: %v", err)
+	}
+
+	expected := `b 2.0
+└── a 1.2 [requires: <3]
+    ├── app 1.0 [requires: >=1] (declared)
+    └── b 2.0 [requires: any] (cycle)
+`
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\nreceived:\n%s", expected, output.String())
+	}
+}
+
+func TestDependencyDot(t *testing.T) {
+	graph := buildDependencyGraph([]requirement{{Name: "app"}}, testGraphDistributions(), testMarkerEnvironment())
+
+	node, err := graph.reverseTree("speedups", -1)
+	if err != nil {
+		t.Fatalf("reverseTree failed: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := writeDependencyDot(&output, []*dependencyNode{node}, true); err != nil {
+		t.Fatalf("writeDependencyDot failed: %v", err)
+	}
+
+	for _, line := range []string{
+		`"speedups" [label="speedups\n4.1"];`,
+		`"c" -> "speedups" [label="any"];`,
+		`"app" -> "c" [label="any"];`,
+	} {
+		if !strings.Contains(output.String(), line) {
+			t.Errorf("expected %q in:\n%s", line, output.String())
+		}
+	}
+	if !strings.HasPrefix(output.String(), "digraph dependencies {\n") {
+		t.Errorf("expected a digraph, received:\n%s", output.String())
+	}
+}
+
+func TestDependencyPaths(t *testing.T) {
+	roots := []requirement{{Name: "app", Specifier: "==1.0"}, {Name: "b"}, {Name: "c", Extras: []string{"fast"}}}
+	graph := buildDependencyGraph(roots, testGraphDistributions(), testMarkerEnvironment())
+
+	paths, truncated, err := graph.paths("B")
+	if err != nil {
+		t.Fatalf("paths failed: %v", err)
+	}
+
+	var formatted []string
+	for _, path := range paths {
+		formatted = append(formatted, formatDependencyPath(path))
+	}
+
+	expected := []string{"app==1.0 -> a>=1 -> b<3", "b"}
+	if strings.Join(formatted, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, received %q", expected, formatted)
+	}
+
+	paths, truncated, err = graph.paths("speedups")
+	if err != nil {
+		t.Fatalf("paths failed: %v", err)
+	}
+	if truncated || len(paths) != 2 || formatDependencyPath(paths[0]) != "app==1.0 -> c[fast] -> speedups" ||
+		formatDependencyPath(paths[1]) != "c[fast] -> speedups" {
+		t.Errorf("unexpected paths to speedups: %v", paths)
+	}
+
+	if paths, _, err := graph.paths("docs"); err != nil || len(paths) != 0 {
+		t.Errorf("expected no path to docs, received %v, %v", paths, err)
+	}
+	if _, _, err := graph.paths("ghost"); err == nil {
+		t.Errorf("expected a package that is not installed to fail")
+	}
+}
+
+func TestDependencyPathsOnDiamonds(t *testing.T) {
+	// 25 stacked diamonds hold 2^25 paths from app to the bottom package
+	distributions := []installedDistribution{{Name: "app", Version: "1.0", RequiresDist: []string{"left0", "right0"}}}
+	for i := 0; i < 25; i++ {
+		next := fmt.Sprintf("join%d", i)
+		distributions = append(distributions,
+			installedDistribution{Name: fmt.Sprintf("left%d", i), Version: "1.0", RequiresDist: []string{next}},
+			installedDistribution{Name: fmt.Sprintf("right%d", i), Version: "1.0", RequiresDist: []string{next}},
+			installedDistribution{Name: next, Version: "1.0", RequiresDist: []string{fmt.Sprintf("left%d", i+1), fmt.Sprintf("right%d", i+1), "unrelated"}},
+		)
+	}
+	distributions = append(distributions,
+		installedDistribution{Name: "left25", Version: "1.0", RequiresDist: []string{"bottom"}},
+		installedDistribution{Name: "right25", Version: "1.0", RequiresDist: []string{"bottom"}},
+		installedDistribution{Name: "bottom", Version: "1.0"},
+		installedDistribution{Name: "unrelated", Version: "1.0"},
+	)
+
+	graph := buildDependencyGraph([]requirement{{Name: "app"}, {Name: "bottom"}}, distributions, testMarkerEnvironment())
+
+	paths, truncated, err := graph.paths("bottom")
+	if err != nil {
+		t.Fatalf("paths failed: %v", err)
+	}
+	if !truncated || len(paths) != maxPathsPerRoot+1 {
+		t.Errorf("expected %d paths from app and the one of bottom itself, received %d", maxPathsPerRoot, len(paths))
+	}
+	if formatDependencyPath(paths[len(paths)-1]) != "bottom" {
+		t.Errorf("expected the declared bottom package to be listed, received %s", formatDependencyPath(paths[len(paths)-1]))
+	}
+}
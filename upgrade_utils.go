@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+// how far pvm upgrade may move a package
+type upgradeMode string
+
+const (
+	upgradeCompatible upgradeMode = "compatible" // newest version the declared specifier allows
+	upgradePatch      upgradeMode = "patch"      // newest version with the same major and minor version
+	upgradeMinor      upgradeMode = "minor"      // newest version with the same major version
+	upgradeLatest     upgradeMode = "latest"     // newest version
+)
+
+// a package pvm upgrade moves to a newer version
+type upgradeAction struct {
+	Name    string
+	Current string // installed version, empty when the package is not installed
+	Target  string // version the package is upgraded to
+	old     requirement
+	req     requirement // the requirement rewritten for the target version
+}
+
+// returns the upgrade as a human readable line
+func (a upgradeAction) line() string {
+	current := a.Current
+	if current == "" {
+		current = "(not installed)"
+	}
+
+	line := fmt.Sprintf("~ %s %s -> %s", a.Name, current, a.Target)
+	if a.old.Specifier != a.req.Specifier {
+		line += fmt.Sprintf(" (%s -> %s)", specifierOrAny(a.old.Specifier), specifierOrAny(a.req.Specifier))
+	}
+	return line
+}
+
+func specifierOrAny(specifier string) string {
+	if specifier == "" {
+		return "any"
+	}
+	return specifier
+}
+
+// returns the newest version the mode allows the package to move to
+// returns false when no version is newer than the current one
+func upgradeTarget(mode upgradeMode, req requirement, versions []pep440.Version, current string) (pep440.Version, bool, error) {
+	var installed *pep440.Version
+	if current != "" {
+		version, err := pep440.Parse(current)
+		if err != nil {
+			return pep440.Version{}, false, err
+		}
+		installed = &version
+	}
+
+	// pre-releases are only picked when the project already uses one
+	prereleases := installed != nil && installed.IsPrerelease()
+
+	specifier := ""
+	switch mode {
+	case upgradeCompatible:
+		specifier = req.Specifier
+	case upgradePatch, upgradeMinor:
+		if installed == nil {
+			return pep440.Version{}, false, fmt.Errorf("%s is not installed, its current version is unknown", req.Name)
+		}
+		segments := 2
+		if mode == upgradeMinor {
+			segments = 1
+		}
+		prefix := installed.Base()
+		prefix.Release = slices.Clone(installed.Release[:min(segments, len(installed.Release))])
+		for len(prefix.Release) < segments {
+			prefix.Release = append(prefix.Release, 0)
+		}
+		specifier = "==" + prefix.String() + ".*"
+	}
+
+	target, found, err := newestAllowedVersion(versions, specifier, prereleases)
+	if err != nil || !found {
+		return pep440.Version{}, false, err
+	}
+	if installed != nil && target.Compare(*installed) <= 0 {
+		return pep440.Version{}, false, nil
+	}
+	return target, true, nil
+}
+
+// returns the release of the version cut or padded with zeros
+// to the number of segments
+func releaseWithSegments(version pep440.Version, segments int) pep440.Version {
+	if len(version.Release) > segments {
+		if version.IsPrerelease() {
+			// cutting the release would exclude the pre-release
+			return version.Public()
+		}
+		base := version.Base()
+		base.Release = version.Release[:segments]
+		return base
+	}
+
+	version = version.Public()
+	version.Release = slices.Clone(version.Release)
+	for len(version.Release) < segments {
+		version.Release = append(version.Release, 0)
+	}
+	return version
+}
+
+// rewrites the specifier for the new version, keeping the operators
+// the user chose
+// lower bounds and pins move to the new version, upper bounds and
+// exclusions are kept when they still allow it and dropped otherwise
+// a specifier left without any clause is replaced using the pin policy
+func upgradeSpecifier(specifier string, version pep440.Version, policy pinPolicy) (string, error) {
+	set, err := pep440.ParseSpecifierSet(specifier)
+	if err != nil || len(set) == 0 {
+		return "", err
+	}
+
+	var clauses []string
+	for _, spec := range set {
+		written, err := pep440.Parse(strings.TrimSuffix(spec.Version, ".*"))
+		if err != nil && spec.Operator != "===" {
+			return "", err
+		}
+
+		switch {
+		case spec.Operator == "===":
+			clauses = append(clauses, "==="+version.String())
+		case spec.Operator == "==" && spec.IsWildcard():
+			clauses = append(clauses, "=="+releaseWithSegments(version.Base(), len(written.Release)).String()+".*")
+		case spec.Operator == "==":
+			clauses = append(clauses, "=="+version.String())
+		case spec.Operator == "~=":
+			clauses = append(clauses, "~="+releaseWithSegments(version, len(written.Release)).String())
+		case spec.Operator == ">=" || spec.Operator == ">":
+			clauses = append(clauses, ">="+version.Public().String())
+		case spec.Contains(version, true):
+			clauses = append(clauses, spec.String())
+		}
+	}
+
+	if len(clauses) == 0 {
+		return pinSpecifier(policy, version.String()), nil
+	}
+	return strings.Join(clauses, ","), nil
+}
+
+// plans the upgrade of the named requirements of the manifest section,
+// or of all of them when no name is passed
+func planUpgrade(m manifest, names []string, mode upgradeMode, policy pinPolicy) ([]upgradeAction, error) {
+	declared, err := m.requirements()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []requirement
+	if len(names) == 0 {
+		for _, req := range declared {
+			if req.URL == "" {
+				selected = append(selected, req)
+			}
+		}
+	} else {
+		for _, name := range names {
+			index := slices.IndexFunc(declared, func(req requirement) bool {
+				return req.key() == normalizeName(name)
+			})
+			if index < 0 {
+				return nil, fmt.Errorf("%s is not declared in %s", name, m.fileName())
+			}
+			if declared[index].URL != "" {
+				return nil, fmt.Errorf("%s is installed from %s and cannot be upgraded from the package index", name, declared[index].URL)
+			}
+			selected = append(selected, declared[index])
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	var keys []string
+	for _, req := range selected {
+		keys = append(keys, req.key())
+	}
+
+	installed, err := getInstalledPackageVersions(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := getPackageIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, failures := fetchVersionsOfProjects(indexes, keys)
+	for _, key := range keys {
+		if err, failed := failures[key]; failed {
+			return nil, err
+		}
+	}
+
+	var actions []upgradeAction
+	for _, req := range selected {
+		action, found, err := planRequirementUpgrade(req, versions[req.key()], installed[req.key()], mode, policy)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions, nil
+}
+
+// plans the upgrade of a single requirement
+// returns false when the package is already at the newest version the mode allows
+func planRequirementUpgrade(req requirement, versions []pep440.Version, installed string, mode upgradeMode, policy pinPolicy) (upgradeAction, bool, error) {
+	// a package that is not installed is compared with its pin
+	current := outdatedPackage{Specifier: req.Specifier, Installed: installed}.current()
+
+	target, found, err := upgradeTarget(mode, req, versions, current)
+	if err != nil || !found {
+		return upgradeAction{}, false, err
+	}
+
+	specifier, err := upgradeSpecifier(req.Specifier, target, policy)
+	if err != nil {
+		return upgradeAction{}, false, fmt.Errorf("%s: %v", req.Name, err)
+	}
+
+	upgraded := req
+	upgraded.Specifier = specifier
+	// the hashes belong to the old version
+	upgraded.Hashes = nil
+
+	return upgradeAction{Name: req.key(), Current: installed, Target: target.String(), old: req, req: upgraded}, true, nil
+}
+
+// installs the new versions with pip and rewrites the requirements
+// of the manifest in place
+func applyUpgrade(m manifest, actions []upgradeAction) error {
+	var lines []string
+	for _, action := range actions {
+		pinned := action.req
+		pinned.Specifier = "==" + action.Target
+		lines = append(lines, pinned.String())
+	}
+
+	if err := installRequirementLines(lines); err != nil {
+		return err
+	}
+
+	for _, action := range actions {
+		if _, err := m.set(action.req); err != nil {
+			return err
+		}
+	}
+	return m.save()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TomasBivainis/pvm/pep440"
+)
+
+func TestUpgradeSpecifier(t *testing.T) {
+	tests := []struct {
+		specifier string
+		version   string
+		expected  string
+	}{
+		{"", "2.0", ""},
+		{"==1.0", "1.2.3", "==1.2.3"},
+		{"===1.0", "1.2.3", "===1.2.3"},
+		{"==1.4.*", "1.6.2", "==1.6.*"},
+		{"==1.*", "2.0.1", "==2.*"},
+		{"~=1.4.2", "1.4.9", "~=1.4.9"},
+		{"~=1.4.2", "2.1", "~=2.1.0"},
+		{"~=1.4", "1.9.3", "~=1.9"},
+		{"~=1.4", "2.0b1", "~=2.0b1"},
+		{">=1.0,<2", "1.5", ">=1.5,<2"},
+		{">=1.0,<2", "2.3", ">=2.3"},
+		{">1.0, !=1.3", "1.4+local", ">=1.4,!=1.3"},
+		{"<2", "3.0", "==3.0"},
+		{"!=1.5,<=1.6", "1.6", "!=1.5,<=1.6"},
+	}
+
+	for _, test := range tests {
+		version, err := pep440.Parse(test.version)
+		if err != nil {
+			t.Fatalf("pep440.Parse(%q) failed: %v", test.version, err)
+		}
+		specifier, err := upgradeSpecifier(test.specifier, version, pinExact)
+		if err != nil {
+			t.Errorf("upgradeSpecifier(%q, %s) failed: %v", test.specifier, test.version, err)
+		} else if specifier != test.expected {
+			t.Errorf("upgradeSpecifier(%q, %s) = %q, expected %q", test.specifier, test.version, specifier, test.expected)
+		}
+	}
+
+	version, _ := pep440.Parse("3.0")
+	if specifier, err := upgradeSpecifier("<2", version, pinNone); err != nil || specifier != "" {
+		t.Errorf("expected the pin policy none to leave no specifier, received %q, %v", specifier, err)
+	}
+}
+
+func TestUpgradeTarget(t *testing.T) {
+	var versions []pep440.Version
+	for _, text := range []string{"3.0a1", "2.5.0", "2.4.7", "2.4.1", "1.9", "1.2"} {
+		version, _ := pep440.Parse(text)
+		versions = append(versions, version)
+	}
+
+	tests := []struct {
+		mode      upgradeMode
+		specifier string
+		current   string
+		expected  string
+	}{
+		{upgradeCompatible, "~=2.4.0", "2.4.1", "2.4.7"},
+		{upgradeCompatible, "==2.4.1", "2.4.1", ""},
+		{upgradePatch, "==2.4.1", "2.4.1", "2.4.7"},
+		{upgradeMinor, "==2.4.1", "2.4.1", "2.5.0"},
+		{upgradeLatest, "<2", "1.2", "2.5.0"},
+		{upgradeLatest, "", "3.0.dev1", "3.0a1"},
+		{upgradeLatest, "", "2.5.0", ""},
+		{upgradeCompatible, ">=1", "", "2.5.0"},
+	}
+
+	for _, test := range tests {
+		target, found, err := upgradeTarget(test.mode, requirement{Name: "demo", Specifier: test.specifier}, versions, test.current)
+		if err != nil {
+			t.Fatalf("upgradeTarget(%s, %q, %s) failed: %v", test.mode, test.specifier, test.current, err)
+		}
+		received := ""
+		if found {
+			received = target.String()
+		}
+		if received != test.expected {
+			t.Errorf("upgradeTarget(%s, %q, %s) = %q, expected %q", test.mode, test.specifier, test.current, received, test.expected)
+		}
+	}
+
+	if _, _, err := upgradeTarget(upgradeMinor, requirement{Name: "demo"}, versions, ""); err == nil {
+		t.Errorf("expected --minor without an installed version to fail")
+	}
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	setupTempDirectory(t)
+	setupUserConfig(t, "")
+
+	server := setupTestIndex(t, map[string][]string{
+		"requests": {"requests-2.31.0.tar.gz", "requests-2.32.3-py3-none-any.whl", "requests-3.0.0.tar.gz"},
+		"flask":    {"flask-3.0.0.tar.gz", "flask-3.1.0.tar.gz"},
+	})
+
+	if err := os.WriteFile("pvm.toml", []byte("index-url = \""+server.URL+"/simple\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pvm.toml: %v", err)
+	}
+	content := "requests[socks]>=2.31,<3 ; python_version >= \"3.8\"  # api client\nflask==3.1.0\n./local\n"
+	if err := os.WriteFile("requirements.txt", []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write requirements.txt: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(".venv", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create venv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".venv", "bin", "python"), nil, 0755); err != nil {
+		t.Fatalf("failed to create venv python: %v", err)
+	}
+	writeDistribution(t, filepath.Join(".venv", "lib", "python3.12", "site-packages"), "requests-2.31.0.dist-info", map[string]string{
+		"METADATA": "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\n",
+	})
+
+	m, err := openManifest(dependencySection{})
+	if err != nil {
+		t.Fatalf("openManifest failed: %v", err)
+	}
+
+	actions, err := planUpgrade(m, nil, upgradeCompatible, pinExact)
+	if err != nil {
+		t.Fatalf("planUpgrade failed: %v", err)
+	}
+	if len(actions) != 1 || actions[0].line() != "~ requests 2.31.0 -> 2.32.3 (>=2.31,<3 -> >=2.32.3,<3)" {
+		t.Fatalf("unexpected upgrades %+v", actions)
+	}
+
+	actions, err = planUpgrade(m, []string{"Requests"}, upgradeLatest, pinExact)
+	if err != nil {
+		t.Fatalf("planUpgrade failed: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Target != "3.0.0" {
+		t.Fatalf("unexpected upgrades %+v", actions)
+	}
+
+	// the line is rewritten in place, keeping the extras, marker and comment
+	if _, err := m.set(actions[0].req); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := m.save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	written, _ := os.ReadFile("requirements.txt")
+	expected := "requests[socks]>=3.0.0; python_version >= \"3.8\"  # api client\nflask==3.1.0\n./local\n"
+	if string(written) != expected {
+		t.Errorf("expected %q, received %q", expected, string(written))
+	}
+
+	if _, err := planUpgrade(m, []string{"numpy"}, upgradeLatest, pinExact); err == nil || !strings.Contains(err.Error(), "not declared") {
+		t.Errorf("expected a package that is not declared to fail, received %v", err)
+	}
+}
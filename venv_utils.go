@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 // returns the path to the global python application
@@ -22,21 +26,26 @@ func getGlobalPythonPath() (string, error) {
 
 // returns the path of the virtual environments python application
 func getVenvPythonPath() (string, error) {
-	cwd, err := os.Getwd()
+	root, err := getProjectRoot()
 	if err != nil {
 		return "", err
 	}
 
-	venvDirs := []string{"venv", ".venv", "env"}
+	config, err := loadProjectConfig()
+	if err != nil {
+		return "", err
+	}
+
+	venvDirs := config.venvDirs()
 
 	for _, venvDir := range venvDirs {
 		// Adjust for OS
-		venvPython := filepath.Join(cwd, venvDir, "bin", "python")
+		venvPython := filepath.Join(root, venvDir, "bin", "python")
 		if _, err := os.Stat(venvPython); err == nil {
 			return venvPython, nil
 		}
 
-		venvPythonWin := filepath.Join(cwd, venvDir, "Scripts", "python.exe")
+		venvPythonWin := filepath.Join(root, venvDir, "Scripts", "python.exe")
 		if _, err := os.Stat(venvPythonWin); err == nil {
 			return venvPythonWin, nil
 		}
@@ -45,23 +54,91 @@ func getVenvPythonPath() (string, error) {
 	return "", fmt.Errorf("python not found in virtual environment")
 }
 
+// returns the path of the virtual environment directory
+func getVenvPath() (string, error) {
+	pythonPath, err := getVenvPythonPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Dir(filepath.Dir(pythonPath)), nil
+}
+
+// settings of the pyvenv.cfg file written by the venv module
+type venvConfig struct {
+	Home       string // directory of the interpreter the venv was created with
+	Version    string // python version of that interpreter
+	Executable string // path of that interpreter, written by python 3.11 and later
+	Prompt     string // prompt prefix given with --prompt, without its quotes
+}
+
+// reads the pyvenv.cfg file of the virtual environment
+// returns nil if the project has no virtual environment
+func readVenvConfig() (*venvConfig, error) {
+	venvPath, err := getVenvPath()
+	if err != nil {
+		return nil, nil
+	}
+
+	file, err := os.Open(filepath.Join(venvPath, "pyvenv.cfg"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseVenvConfig(file)
+}
+
+// parses the key = value lines of a pyvenv.cfg file
+func parseVenvConfig(reader io.Reader) (*venvConfig, error) {
+	config := &venvConfig{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "home":
+			config.Home = value
+		case "version", "version_info":
+			config.Version = value
+		case "executable":
+			config.Executable = value
+		case "prompt":
+			// the venv module writes the repr of the prompt
+			config.Prompt = strings.Trim(value, `'"`)
+		}
+	}
+
+	return config, scanner.Err()
+}
+
 // returns the path to the virtual environments pip
 func getVenvPipPath() (string, error) {
-	cwd, err := os.Getwd()
+	root, err := getProjectRoot()
+	if err != nil {
+		return "", err
+	}
+
+	config, err := loadProjectConfig()
 	if err != nil {
 		return "", err
 	}
 
-	venvDirs := []string{"venv", ".venv", "env"}
+	venvDirs := config.venvDirs()
 
 	for _, venvDir := range venvDirs {
 		// Adjust for OS
-		venvPip := filepath.Join(cwd, venvDir, "bin", "pip")
+		venvPip := filepath.Join(root, venvDir, "bin", "pip")
 		if _, err := os.Stat(venvPip); err == nil {
 			return venvPip, nil
 		}
 
-		venvPipWin := filepath.Join(cwd, venvDir, "Scripts", "pip.exe")
+		venvPipWin := filepath.Join(root, venvDir, "Scripts", "pip.exe")
 		if _, err := os.Stat(venvPipWin); err == nil {
 			return venvPipWin, nil
 		}
@@ -70,20 +147,25 @@ func getVenvPipPath() (string, error) {
 	return "", fmt.Errorf("pip not found in virtual environment")
 }
 
-// returns true if a virtual environment was 
+// returns true if a virtual environment was
 // initiated in the current working directory
 // otherwise, returns false
 func detectVirtualEnvironment() (bool, error) {
-	cwd, err := os.Getwd()
+	root, err := getProjectRoot()
 	if err != nil {
 		return false, err
 	}
 
-	venvDirs := []string{"venv", ".venv", "env"}
+	config, err := loadProjectConfig()
+	if err != nil {
+		return false, err
+	}
+
+	venvDirs := config.venvDirs()
 	pythonNames := []string{"bin/python", "Scripts/python.exe"}
 
 	for _, venv := range venvDirs {
-		venvPath := filepath.Join(cwd, venv)
+		venvPath := filepath.Join(root, venv)
 		info, err := os.Stat(venvPath)
 		if err == nil && info.IsDir() {
 			// Check for python executable inside venv
@@ -95,20 +177,87 @@ func detectVirtualEnvironment() (bool, error) {
 			}
 		}
 	}
-	
+
 	return false, nil
 }
 
 // creates a virtual environment
 func createVirtualEnvironment() error {
-    pythonPath, err := getGlobalPythonPath()
-    if err != nil {
-        return err
-    }
-    cmd := exec.Command(pythonPath, "-m", "venv", ".venv")
-    cmd.Stdout = os.Stdout
-    cmd.Stderr = os.Stderr
-    return cmd.Run()
+	pythonPath, err := getGlobalPythonPath()
+	if err != nil {
+		return err
+	}
+	venvPath, err := getNewVenvPath()
+	if err != nil {
+		return err
+	}
+	return createVirtualEnvironmentWith(pythonPath, venvPath)
+}
+
+// returns the path a new virtual environment is created at
+func getNewVenvPath() (string, error) {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return "", err
+	}
+
+	root, err := getProjectRoot()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, config.newVenvDir()), nil
+}
+
+// creates a virtual environment at the passed path
+// with the passed python interpreter
+func createVirtualEnvironmentWith(pythonPath string, venvPath string) error {
+	cmd := exec.Command(pythonPath, "-m", "venv", venvPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// recreates the virtual environment with the passed interpreter and
+// reinstalls the main dependencies and the selected groups
+// the previous virtual environment is restored if anything fails
+func rebuildVirtualEnvironment(interpreter pythonInterpreter, groups []string) error {
+	venvPath, err := getVenvPath()
+	if err != nil {
+		return err
+	}
+
+	backupPath := venvPath + ".old"
+	if err := os.RemoveAll(backupPath); err != nil {
+		return err
+	}
+	if err := os.Rename(venvPath, backupPath); err != nil {
+		return err
+	}
+
+	restore := func(cause error) error {
+		if err := os.RemoveAll(venvPath); err != nil {
+			return fmt.Errorf("%v, the previous virtual environment was kept at %s", cause, backupPath)
+		}
+		if err := os.Rename(backupPath, venvPath); err != nil {
+			return fmt.Errorf("%v, the previous virtual environment was kept at %s", cause, backupPath)
+		}
+		return cause
+	}
+
+	if err := createVirtualEnvironmentWith(interpreter.Path, venvPath); err != nil {
+		return restore(err)
+	}
+
+	plan, err := planSync(groups)
+	if err != nil {
+		return restore(err)
+	}
+	if err := applySyncPlan(plan); err != nil {
+		return restore(err)
+	}
+
+	return os.RemoveAll(backupPath)
 }
 
 // installs the passed list of packages and writes new packages
@@ -119,22 +268,98 @@ func installPackages(packages []string) error {
 		return err
 	}
 
-	cmd := exec.Command(pipCommand, (append([]string{"install"}, packages...))...)
+	args, err := pipInstallArgs(packages...)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(pipCommand, args...)
 	cmd.Stdout = nil
 	cmd.Stderr = nil
 	return cmd.Run()
 }
 
-// installs all of the packages named in the requirements.txt file
-func installPackagesFromRequirements() error {
+// returns the arguments of a pip install command, selecting
+// the package indexes of the project configuration
+func pipInstallArgs(args ...string) ([]string, error) {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Concat([]string{"install"}, config.indexOptions(), args), nil
+}
+
+// installs all of the packages declared in the selected
+// section of the project manifest
+func installPackagesFromManifest(section dependencySection) error {
+	m, err := openManifest(section)
+	if err != nil {
+		return err
+	}
+
+	if requirementsFile, ok := m.(*requirementsManifest); ok {
+		// let pip read the file itself so includes and options apply
+		pipCommand, err := getVenvPipPath()
+		if err != nil {
+			return err
+		}
+
+		args, err := pipInstallArgs("-r", requirementsFile.path)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(pipCommand, args...)
+		cmd.Stdout = nil
+		cmd.Stderr = nil
+		return cmd.Run()
+	}
+
+	requirements, err := m.requirements()
+	if err != nil {
+		return err
+	}
+	if len(requirements) == 0 {
+		return nil
+	}
+
+	var lines []string
+	for _, req := range requirements {
+		lines = append(lines, req.String())
+	}
+
+	return installRequirementLines(lines)
+}
+
+// installs the passed requirement lines through a temporary
+// requirements file, so options like --hash are understood by pip
+func installRequirementLines(lines []string, options ...string) error {
+	file, err := os.CreateTemp("", "pvm-requirements-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	file.Close()
+	if err != nil {
+		return err
+	}
+
 	pipCommand, err := getVenvPipPath()
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command(pipCommand, "install", "-r", "requirements.txt")
+	args, err := pipInstallArgs(append(options, "-r", file.Name())...)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(pipCommand, args...)
 	cmd.Stdout = nil
-	cmd.Stderr = nil
+	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
@@ -152,34 +377,13 @@ func uninstallPackages(packages []string) error {
 	return cmd.Run()
 }
 
-// returns true if the passed python package is installed
-// false otherwise
-func isPythonPackageInstalled(pkg string) (bool, error) {
-	pipPath, err := getVenvPipPath()
-	if err != nil {
-		return false, err
-	}
-
-	cmd := exec.Command(pipPath, "show", pkg)
-	err = cmd.Run()
-	if err == nil {
-		return true, nil
-	}
-	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-		return false, nil // Not installed
-	}
-	return false, err // Some other error
-}
-
 // runs the passed script in the virtual environment
-func runScript(scriptName string) error {
+// with the passed arguments
+func runScript(scriptName string, args ...string) error {
 	pythonPath, err := getVenvPythonPath()
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command(pythonPath, scriptName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
\ No newline at end of file
+	return execInVenv(pythonPath, append([]string{scriptName}, args...))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -10,7 +11,7 @@ func setupTempDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	oldDir, _ := os.Getwd()
 	os.Chdir(tmpDir)
-	
+
 	t.Cleanup(func() { os.Chdir(oldDir) })
 }
 
@@ -114,7 +115,7 @@ func TestInstallPackagesFromRequirements(t *testing.T) {
 		t.Skip("Could not create virtual environment (is python installed?):", err)
 	}
 
-	err = installPackagesFromRequirements()
+	err = installPackagesFromManifest(dependencySection{})
 	if err != nil {
 		t.Errorf("Could not install packages from requirements: %v", err)
 	}
@@ -175,7 +176,7 @@ print("Hello from Python script!")
 print(f"Python version: {sys.version}")
 sys.exit(0)
 `
-	
+
 	scriptPath := "test_script.py"
 	err = os.WriteFile(scriptPath, []byte(scriptContent), 0755)
 	if err != nil {
@@ -213,4 +214,20 @@ func TestRunScriptWithoutVirtualEnvironment(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error when running script without virtual environment, but got none")
 	}
-}
\ No newline at end of file
+}
+
+func TestParseVenvConfig(t *testing.T) {
+	content := "home = /usr/bin\ninclude-system-site-packages = false\nversion = 3.11.7\n" +
+		"executable = /usr/bin/python3.11\ncommand = /usr/bin/python3 -m venv /tmp/project/.venv\n" +
+		"prompt = 'project'\n"
+
+	config, err := parseVenvConfig(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parseVenvConfig failed: %v", err)
+	}
+
+	expected := venvConfig{Home: "/usr/bin", Version: "3.11.7", Executable: "/usr/bin/python3.11", Prompt: "project"}
+	if *config != expected {
+		t.Errorf("expected %+v, received %+v", expected, *config)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// the compatibility tags of a wheel file name, as described by PEP 427
+// each tag may hold several values separated by dots, such as py2.py3
+type wheelTags struct {
+	Python   []string
+	ABI      []string
+	Platform []string
+}
+
+// parses the tags of a wheel file name
+// returns false for files that are not wheels
+func parseWheelTags(filename string) (wheelTags, bool) {
+	base, isWheel := strings.CutSuffix(filename, ".whl")
+	if !isWheel {
+		return wheelTags{}, false
+	}
+
+	// name-version(-build)?-python-abi-platform
+	parts := strings.Split(base, "-")
+	if len(parts) < 5 || len(parts) > 6 {
+		return wheelTags{}, false
+	}
+	parts = parts[len(parts)-3:]
+
+	return wheelTags{
+		Python:   strings.Split(strings.ToLower(parts[0]), "."),
+		ABI:      strings.Split(strings.ToLower(parts[1]), "."),
+		Platform: strings.Split(strings.ToLower(parts[2]), "."),
+	}, true
+}
+
+// returns true if the platform tag names the machine of the environment
+// the glibc and macOS versions of manylinux and macosx tags are not checked
+func platformTagMatches(tag string, env markerEnvironment) bool {
+	if tag == "any" {
+		return true
+	}
+
+	machine := strings.ToLower(env["platform_machine"])
+	switch env["sys_platform"] {
+	case "linux":
+		if machine == "amd64" {
+			machine = "x86_64"
+		}
+		for _, prefix := range []string{"manylinux", "musllinux", "linux"} {
+			if strings.HasPrefix(tag, prefix) && strings.HasSuffix(tag, "_"+machine) {
+				return true
+			}
+		}
+	case "darwin":
+		if !strings.HasPrefix(tag, "macosx_") {
+			return false
+		}
+		arch := tag[strings.LastIndex(tag, "_")+1:]
+		return arch == machine || arch == "universal2" || arch == "universal" || (arch == "intel" && machine == "x86_64")
+	case "win32":
+		switch machine {
+		case "amd64", "x86_64":
+			return tag == "win_amd64"
+		case "arm64":
+			return tag == "win_arm64"
+		default:
+			return tag == "win32"
+		}
+	}
+	return false
+}
+
+// returns true if the interpreter of the environment accepts the
+// python and abi tags
+func interpreterTagMatches(python string, abi string, env markerEnvironment) bool {
+	major, minor, _ := strings.Cut(env["python_version"], ".")
+	minorNumber, err := strconv.Atoi(minor)
+	if err != nil {
+		return false
+	}
+
+	implementation := env["implementation_name"]
+	switch implementation {
+	case "cpython":
+		implementation = "cp"
+	case "pypy":
+		implementation = "pp"
+	}
+
+	// the version digits of a tag such as py3, py39 or cp312
+	versionOf := func(tag string, prefix string) (int, bool) {
+		digits, found := strings.CutPrefix(tag, prefix+major)
+		if !found {
+			return 0, false
+		}
+		if digits == "" {
+			return -1, true
+		}
+		number, err := strconv.Atoi(digits)
+		return number, err == nil
+	}
+
+	switch {
+	case strings.HasPrefix(python, "py"):
+		// generic tags of older minor versions are accepted, like pip does
+		version, ok := versionOf(python, "py")
+		return ok && version <= minorNumber && abi == "none"
+	case strings.HasPrefix(python, implementation):
+		version, ok := versionOf(python, implementation)
+		if !ok || version < 0 {
+			return false
+		}
+		switch {
+		case abi == "none" || strings.TrimSuffix(abi, "m") == implementation+major+minor:
+			return version == minorNumber
+		case abi == "abi3":
+			// the stable abi also runs on later minor versions
+			return implementation == "cp" && version <= minorNumber
+		case implementation == "pp" && strings.HasPrefix(abi, "pypy"+major+minor):
+			return version == minorNumber
+		}
+	}
+	return false
+}
+
+// returns true if pip would install the wheel in the environment
+// the tags are checked like pip does, except for the glibc and macOS
+// versions hidden in manylinux and macosx platform tags
+func wheelSupported(filename string, env markerEnvironment) bool {
+	tags, ok := parseWheelTags(filename)
+	if !ok {
+		return false
+	}
+
+	platformMatches := false
+	for _, platform := range tags.Platform {
+		if platformTagMatches(platform, env) {
+			platformMatches = true
+			break
+		}
+	}
+	if !platformMatches {
+		return false
+	}
+
+	for _, python := range tags.Python {
+		for _, abi := range tags.ABI {
+			if interpreterTagMatches(python, abi, env) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reads the METADATA file of the .dist-info directory of a wheel
+func readWheelMetadata(data []byte) (installedDistribution, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return installedDistribution{}, err
+	}
+
+	for _, file := range archive.File {
+		dir, name := path.Split(file.Name)
+		if name != "METADATA" || strings.Count(dir, "/") != 1 || !strings.HasSuffix(dir, ".dist-info/") {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return installedDistribution{}, err
+		}
+		defer reader.Close()
+
+		return parseDistributionMetadata(reader)
+	}
+
+	return installedDistribution{}, fmt.Errorf("the wheel has no .dist-info/METADATA file")
+}
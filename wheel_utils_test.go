@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseWheelTags(t *testing.T) {
+	tags, ok := parseWheelTags("numpy-1.26.4-1-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl")
+	if !ok {
+		t.Fatalf("expected the wheel to be parsed")
+	}
+
+	expected := wheelTags{
+		Python:   []string{"cp312"},
+		ABI:      []string{"cp312"},
+		Platform: []string{"manylinux_2_17_x86_64", "manylinux2014_x86_64"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %+v, received %+v", expected, tags)
+	}
+
+	for _, filename := range []string{"numpy-1.26.4.tar.gz", "numpy-cp312.whl"} {
+		if _, ok := parseWheelTags(filename); ok {
+			t.Errorf("expected %s not to be parsed", filename)
+		}
+	}
+}
+
+func TestWheelSupported(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected bool
+	}{
+		{"idna-3.6-py3-none-any.whl", true},
+		{"six-1.16.0-py2.py3-none-any.whl", true},
+		{"tomli-2.0.1-py313-none-any.whl", false},
+		{"old-1.0-py2-none-any.whl", false},
+		{"numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", true},
+		{"numpy-1.26.4-cp312-cp312-musllinux_1_1_x86_64.whl", true},
+		{"numpy-1.26.4-cp312-cp312-manylinux_2_17_aarch64.whl", false},
+		{"numpy-1.26.4-cp311-cp311-manylinux_2_17_x86_64.whl", false},
+		{"numpy-1.26.4-cp312-cp312-win_amd64.whl", false},
+		{"numpy-1.26.4-cp312-cp312-macosx_11_0_arm64.whl", false},
+		{"cryptography-42.0.5-cp39-abi3-manylinux_2_28_x86_64.whl", true},
+		{"cryptography-42.0.5-cp313-abi3-manylinux_2_28_x86_64.whl", false},
+		{"numpy-1.26.4-pp39-pypy39_pp73-manylinux_2_17_x86_64.whl", false},
+	}
+
+	env := testMarkerEnvironment()
+	for _, test := range tests {
+		if supported := wheelSupported(test.filename, env); supported != test.expected {
+			t.Errorf("wheelSupported(%q) = %v, expected %v", test.filename, supported, test.expected)
+		}
+	}
+
+	env["sys_platform"], env["platform_machine"] = "darwin", "arm64"
+	if !wheelSupported("numpy-1.26.4-cp312-cp312-macosx_11_0_arm64.whl", env) || !wheelSupported("black-24.1.0-cp312-cp312-macosx_10_9_universal2.whl", env) {
+		t.Errorf("expected arm64 and universal2 wheels to be supported on apple silicon")
+	}
+
+	env["sys_platform"], env["platform_machine"] = "win32", "AMD64"
+	if !wheelSupported("numpy-1.26.4-cp312-cp312-win_amd64.whl", env) || wheelSupported("numpy-1.26.4-cp312-cp312-win32.whl", env) {
+		t.Errorf("expected only win_amd64 wheels to be supported on 64-bit windows")
+	}
+}
+
+func TestReadWheelMetadata(t *testing.T) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for name, content := range map[string]string{
+		"demo/__init__.py":                         "",
+		"demo/vendor/other-1.0.dist-info/METADATA": "Name: other\nVersion: 1.0\n",
+		"demo-1.0.dist-info/METADATA":              "Metadata-Version: 2.1\nName: demo\nVersion: 1.0\nRequires-Dist: idna>=3\n",
+	} {
+		file, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create the wheel: %v", err)
+		}
+		file.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to create the wheel: %v", err)
+	}
+
+	dist, err := readWheelMetadata(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("readWheelMetadata failed: %v", err)
+	}
+	if dist.Name != "demo" || dist.Version != "1.0" || !reflect.DeepEqual(dist.RequiresDist, []string{"idna>=3"}) {
+		t.Errorf("unexpected metadata %+v", dist)
+	}
+
+	if _, err := readWheelMetadata([]byte("not a wheel")); err == nil {
+		t.Errorf("expected a file that is not a zip archive to fail")
+	}
+}